@@ -22,12 +22,14 @@ import (
 
 	"github.com/open-policy-agent/opa/format"
 	"github.com/snyk/policy-engine/pkg/input"
+	"github.com/snyk/policy-engine/pkg/postprocess"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cmdFixturePackage string
+	cmdFixturePackage   string
+	cmdFixtureSensitive bool
 )
 
 var fixtureCmd = &cobra.Command{
@@ -74,7 +76,11 @@ var fixtureCmd = &cobra.Command{
 		if len(states) != 1 {
 			return fmt.Errorf("Expected a single state but got %d", len(states))
 		}
-		bytes, err := json.MarshalIndent(states[0], "", "  ")
+		state := states[0]
+		if !cmdFixtureSensitive {
+			postprocess.RedactSensitiveState(&state)
+		}
+		bytes, err := json.MarshalIndent(state, "", "  ")
 		if err != nil {
 			return err
 		}
@@ -93,4 +99,5 @@ mock_input = %s`, packageName, string(bytes)))
 
 func init() {
 	fixtureCmd.PersistentFlags().StringVar(&cmdFixturePackage, "package", "", "Explicitly set package name")
+	fixtureCmd.PersistentFlags().BoolVar(&cmdFixtureSensitive, "show-sensitive", false, "Include sensitive values in the fixture. These are redacted by default.")
 }
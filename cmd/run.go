@@ -19,11 +19,14 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/snyk/policy-engine/pkg/data"
 	"github.com/snyk/policy-engine/pkg/engine"
+	"github.com/snyk/policy-engine/pkg/hcl_interpreter"
 	"github.com/snyk/policy-engine/pkg/input"
 	"github.com/snyk/policy-engine/pkg/metrics"
 	"github.com/snyk/policy-engine/pkg/postprocess"
@@ -36,7 +39,19 @@ import (
 var (
 	runCmdRules   []string
 	runVarFiles   []string
+	runVars       []string
+	runVarSets    []string
+	runWorkspace  string
+	runPlanConfig string
+	runSensitive  bool
 	runCmdWorkers *int
+
+	runCfnPseudoParams map[string]string
+	runCfnParamFiles   []string
+	runCfnCrossStack   bool
+
+	runArmContext    map[string]string
+	runArmParamFiles []string
 )
 
 var runCmd = &cobra.Command{
@@ -71,6 +86,25 @@ var runCmd = &cobra.Command{
 			return err
 		}
 		loader := input.NewLoader(detector)
+		detectOpts := input.DetectOptions{
+			VarFiles:             runVarFiles,
+			Vars:                 runVars,
+			Env:                  os.Environ(),
+			Workspace:            runWorkspace,
+			PlanConfigurationDir: runPlanConfig,
+			CfnPseudoParameters:  runCfnPseudoParams,
+			CfnParameterFiles:    runCfnParamFiles,
+			CfnCrossStack:        runCfnCrossStack,
+			ArmContext:           runArmContext,
+			ArmParameterFiles:    runArmParamFiles,
+		}
+		for _, arg := range runVarSets {
+			set, err := parseVarSet(arg)
+			if err != nil {
+				return err
+			}
+			detectOpts.VariableSets = append(detectOpts.VariableSets, set)
+		}
 		fsys := afero.OsFs{}
 		for _, p := range args {
 			var detectable input.Detectable
@@ -95,9 +129,7 @@ var runCmd = &cobra.Command{
 					return err
 				}
 			}
-			loaded, err := loader.Load(detectable, input.DetectOptions{
-				VarFiles: runVarFiles,
-			})
+			loaded, err := loader.Load(detectable, detectOpts)
 			if err != nil {
 				return err
 			}
@@ -106,9 +138,7 @@ var runCmd = &cobra.Command{
 			}
 			if dir, ok := detectable.(*input.Directory); ok {
 				walkFunc := func(d input.Detectable, depth int) (bool, error) {
-					return loader.Load(d, input.DetectOptions{
-						VarFiles: runVarFiles,
-					})
+					return loader.Load(d, detectOpts)
 				}
 				if err := dir.Walk(walkFunc); err != nil {
 					return err
@@ -118,6 +148,17 @@ var runCmd = &cobra.Command{
 		ctx := context.Background()
 		for path, errs := range loader.Errors() {
 			for _, err := range errs {
+				// Diagnostics that point to source code are printed in full,
+				// with a snippet.
+				var diag *hcl_interpreter.Diagnostic
+				if errors.As(err, &diag) && diag.Range != nil {
+					// Keep any context, e.g. the variable set.
+					if prefix := strings.TrimSuffix(err.Error(), diag.Error()); prefix != "" {
+						fmt.Fprintf(os.Stderr, "[%s] ", strings.TrimSuffix(prefix, ": "))
+					}
+					fmt.Fprintln(os.Stderr, diag.Format())
+					continue
+				}
 				logger.Warn(ctx, fmt.Sprintf("%s: %s", path, err))
 			}
 		}
@@ -136,6 +177,9 @@ var runCmd = &cobra.Command{
 			Workers: *runCmdWorkers,
 		})
 		postprocess.AddSourceLocs(results, loader)
+		if !runSensitive {
+			postprocess.RedactSensitive(results)
+		}
 
 		bytes, err := json.MarshalIndent(results, "  ", "  ")
 		if err != nil {
@@ -151,4 +195,29 @@ func init() {
 	runCmdWorkers = runCmd.PersistentFlags().IntP("workers", "w", 0, "Number of workers. When 0 (the default) will use num CPUs + 1.")
 	runCmd.PersistentFlags().StringSliceVarP(&runCmdRules, "rule", "r", runCmdRules, "Select specific rules")
 	runCmd.PersistentFlags().StringSliceVar(&runVarFiles, "var-file", runVarFiles, "Pass in variable files")
+	runCmd.PersistentFlags().StringArrayVar(&runVars, "var", runVars, "Set a variable using name=value, overriding variable files. TF_VAR_name environment variables are also read.")
+	runCmd.PersistentFlags().StringArrayVar(&runVarSets, "var-set", runVarSets, "Evaluate Terraform once per named variable set, given as name=file1.tfvars,file2.tfvars. May be repeated.")
+	runCmd.PersistentFlags().StringVar(&runWorkspace, "workspace", runWorkspace, "Set terraform.workspace. Defaults to TF_WORKSPACE, or \"default\".")
+	runCmd.PersistentFlags().StringVar(&runPlanConfig, "plan-configuration", runPlanConfig, "Directory of the Terraform configuration that plans were generated from. Used to report source locations in the HCL files.")
+	runCmd.PersistentFlags().StringToStringVar(&runCfnPseudoParams, "cfn-pseudo-param", runCfnPseudoParams, "Set CloudFormation pseudo parameters using name=value, e.g. AWS::Region=us-east-1.")
+	runCmd.PersistentFlags().StringArrayVar(&runCfnParamFiles, "cfn-parameters", runCfnParamFiles, "Pass in a CloudFormation parameter file, optionally for a single template using template=file. May be repeated.")
+	runCmd.PersistentFlags().BoolVar(&runCfnCrossStack, "cfn-cross-stack", runCfnCrossStack, "Resolve Fn::ImportValue in CloudFormation templates using the exports of other templates in the same directory.")
+	runCmd.PersistentFlags().StringToStringVar(&runArmContext, "arm-context", runArmContext, "Describe the deployment of ARM templates using name=value, e.g. resourceGroup=rg or location=westeurope. Supported names are subscriptionId, tenantId, resourceGroup, location and deploymentName.")
+	runCmd.PersistentFlags().StringArrayVar(&runArmParamFiles, "arm-parameters", runArmParamFiles, "Pass in an ARM parameter file, optionally for a single template using template=file. May be repeated. Files named like azuredeploy.parameters.json are used automatically.")
+	runCmd.PersistentFlags().BoolVar(&runSensitive, "show-sensitive", runSensitive, "Include sensitive values in the input states of the output. These are redacted by default.")
+}
+
+// parseVarSet parses a --var-set argument of the form name=file1,file2.
+func parseVarSet(arg string) (input.VariableSet, error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return input.VariableSet{}, fmt.Errorf("Invalid variable set %q: expected name=file,...", arg)
+	}
+	set := input.VariableSet{Name: parts[0]}
+	for _, file := range strings.Split(parts[1], ",") {
+		if file != "" {
+			set.VarFiles = append(set.VarFiles, file)
+		}
+	}
+	return set, nil
 }
@@ -136,6 +136,10 @@ func PureRegoLibProvider() Provider {
 		if err != nil {
 			return nil
 		}
+		err = regoParser(ctx, "", "snyk/sensitive.rego", bytes.NewReader(embed.SnykSensitiveRego), consumer)
+		if err != nil {
+			return nil
+		}
 		return nil
 	}
 }
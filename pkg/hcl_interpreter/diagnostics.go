@@ -0,0 +1,171 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+type DiagnosticSeverity string
+
+const (
+	DiagnosticError   DiagnosticSeverity = "error"
+	DiagnosticWarning DiagnosticSeverity = "warning"
+)
+
+// Diagnostic is a non-fatal problem encountered while loading or evaluating
+// a configuration.  It implements error so it can be returned alongside
+// other errors, but carries enough information to point the user to the
+// offending resource and source code.
+type Diagnostic struct {
+	Severity DiagnosticSeverity
+	Summary  string
+	Detail   string
+
+	// Range is the source range the diagnostic refers to, if known.
+	Range *hcl.Range
+
+	// Resource is the address of the resource the diagnostic refers to, and
+	// Attribute the path of the attribute within that resource.  Both are
+	// empty if the diagnostic does not belong to a resource.
+	Resource  string
+	Attribute []interface{}
+
+	// Snippet holds the source lines covered by Range, if available.
+	Snippet string
+}
+
+func (d *Diagnostic) Message() string {
+	if d.Detail == "" {
+		return d.Summary
+	}
+	return d.Summary + "; " + d.Detail
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Range != nil {
+		return fmt.Sprintf("%s: %s", d.Range.String(), d.Message())
+	}
+	return d.Message()
+}
+
+// Format renders the diagnostic in a human-readable way, including the
+// source snippet if there is one:
+//
+//     Error: Unsupported argument
+//       on main.tf line 3, in resource.aws_s3_bucket.bucket:
+//        3:   acl = "private"
+//
+//     An argument named "acl" is not expected here.
+func (d *Diagnostic) Format() string {
+	buf := &bytes.Buffer{}
+	severity := "Error"
+	if d.Severity == DiagnosticWarning {
+		severity = "Warning"
+	}
+	fmt.Fprintf(buf, "%s: %s\n", severity, d.Summary)
+	if d.Range != nil {
+		fmt.Fprintf(buf, "  on %s line %d", d.Range.Filename, d.Range.Start.Line)
+		if d.Resource != "" {
+			fmt.Fprintf(buf, ", in %s", d.Resource)
+		}
+		fmt.Fprintf(buf, ":\n")
+		if d.Snippet != "" {
+			for i, line := range strings.Split(d.Snippet, "\n") {
+				fmt.Fprintf(buf, "  %4d: %s\n", d.Range.Start.Line+i, line)
+			}
+		}
+	}
+	if d.Detail != "" {
+		fmt.Fprintf(buf, "\n%s\n", d.Detail)
+	}
+	return buf.String()
+}
+
+// Meta returns the representation of the diagnostic that is stored in the
+// resource meta.
+func (d *Diagnostic) Meta() map[string]interface{} {
+	meta := map[string]interface{}{
+		"severity": string(d.Severity),
+		"message":  d.Message(),
+	}
+	if d.Attribute != nil {
+		meta["attribute"] = d.Attribute
+	}
+	if d.Range != nil {
+		meta["filepath"] = d.Range.Filename
+		meta["range"] = map[string]interface{}{
+			"start": map[string]interface{}{
+				"line":   d.Range.Start.Line,
+				"column": d.Range.Start.Column,
+			},
+			"end": map[string]interface{}{
+				"line":   d.Range.End.Line,
+				"column": d.Range.End.Column,
+			},
+		}
+	}
+	return meta
+}
+
+// newDiagnostics converts HCL diagnostics.  sources maps filenames to their
+// contents and is used to fill in snippets.
+func newDiagnostics(
+	diags hcl.Diagnostics,
+	sources map[string][]byte,
+) []*Diagnostic {
+	out := []*Diagnostic{}
+	for _, diag := range diags {
+		d := &Diagnostic{
+			Severity: DiagnosticError,
+			Summary:  diag.Summary,
+			Detail:   diag.Detail,
+		}
+		if diag.Severity == hcl.DiagWarning {
+			d.Severity = DiagnosticWarning
+		}
+		if diag.Subject != nil {
+			rng := *diag.Subject
+			d.Range = &rng
+			d.Snippet = sourceSnippet(sources, rng)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// sourceSnippet returns the full lines covered by a range.
+func sourceSnippet(sources map[string][]byte, rng hcl.Range) string {
+	src, ok := sources[rng.Filename]
+	if !ok || rng.Start.Line < 1 {
+		return ""
+	}
+	lines := strings.Split(string(src), "\n")
+	start, end := rng.Start.Line, rng.End.Line
+	if end < start {
+		end = start
+	}
+	if start > len(lines) {
+		return ""
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return strings.TrimRight(strings.Join(lines[start-1:end], "\n"), "\r\n")
+}
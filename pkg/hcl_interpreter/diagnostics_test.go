@@ -0,0 +1,59 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluationDiagnostics(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "src/main.tf", []byte(`resource "aws_s3_bucket" "bucket" {
+  bucket = "my-bucket"
+  tags = {
+    Owner = file("missing.txt")
+  }
+}
+`), 0644)
+	mtree, err := ParseDirectory(nil, fs, "src", VariableInputs{})
+	require.NoError(t, err)
+	evaluation, err := EvaluateAnalysis(AnalyzeModuleTree(mtree), EvaluationOptions{})
+	require.NoError(t, err)
+
+	errs := evaluation.Errors()
+	require.Len(t, errs, 1)
+	diag, ok := errs[0].(*Diagnostic)
+	require.True(t, ok)
+	assert.Equal(t, DiagnosticError, diag.Severity)
+	assert.Equal(t, "aws_s3_bucket.bucket", diag.Resource)
+	assert.Equal(t, []interface{}{"tags"}, diag.Attribute)
+	assert.Equal(t, "src/main.tf", diag.Range.Filename)
+	assert.Equal(t, 4, diag.Range.Start.Line)
+	assert.Equal(t, `    Owner = file("missing.txt")`, diag.Snippet)
+	assert.Contains(t, diag.Format(), "on src/main.tf line 4, in aws_s3_bucket.bucket:")
+	assert.Contains(t, diag.Format(), `     4:     Owner = file("missing.txt")`)
+
+	resources := evaluation.Resources()
+	require.Len(t, resources, 1)
+	tfmeta := resources[0].Meta["terraform"].(map[string]interface{})
+	diags := tfmeta["diagnostics"].([]interface{})
+	require.Len(t, diags, 1)
+	assert.Equal(t, "error", diags[0].(map[string]interface{})["severity"])
+	assert.Equal(t, []interface{}{"tags"}, diags[0].(map[string]interface{})["attribute"])
+}
@@ -17,12 +17,15 @@
 package hcl_interpreter
 
 import (
-	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/hashicorp/hcl/v2"
 	"github.com/spf13/afero"
 	"github.com/zclconf/go-cty/cty"
 
 	"github.com/snyk/policy-engine/pkg/hcl_interpreter/funcs"
+	"github.com/snyk/policy-engine/pkg/internal/terraform/configs"
 	"github.com/snyk/policy-engine/pkg/internal/terraform/lang"
 	"github.com/snyk/policy-engine/pkg/models"
 	"github.com/snyk/policy-engine/pkg/topsort"
@@ -53,6 +56,9 @@ type Analysis struct {
 
 	// Any bad keys that we attempted to reference or failed to parse
 	badKeys map[string]struct{}
+
+	// Contents of the parsed files, used for diagnostics.
+	sources map[string][]byte
 }
 
 func AnalyzeModuleTree(mtree *ModuleTree) *Analysis {
@@ -65,6 +71,7 @@ func AnalyzeModuleTree(mtree *ModuleTree) *Analysis {
 		Blocks:              []FullName{},
 		currentResource:     nil,
 		badKeys:             map[string]struct{}{},
+		sources:             mtree.Sources(),
 	}
 	mtree.Walk(analysis)
 	return analysis
@@ -127,8 +134,11 @@ func (v *Analysis) dependencies(name FullName, expr hcl.Expression) []dependency
 			asModuleInput := full.AsModuleInput()
 			isModuleInput := false
 			if asModuleInput != nil {
-				if _, ok := v.Expressions[asModuleInput.ToString()]; ok {
-					deps = append(deps, dependency{full, asModuleInput, nil})
+				// The module call sets the variable as a whole, so we depend
+				// on that for references to nested attributes as well.
+				input := FullName{asModuleInput.Module, asModuleInput.Local[:3]}
+				if _, ok := v.Expressions[input.ToString()]; ok {
+					deps = append(deps, dependency{*asVar, &input, nil})
 					isModuleInput = true
 				}
 			}
@@ -217,17 +227,46 @@ func (v *Analysis) order() ([]FullName, error) {
 	return sortedNames, nil
 }
 
+// EvaluationOptions holds the values that Terraform takes from its
+// environment rather than from the configuration.
+type EvaluationOptions struct {
+	// Workspace is the value of terraform.workspace.  Defaults to "default".
+	Workspace string
+	// PathRoot is the value of path.root.  Defaults to the directory of the
+	// root module.
+	PathRoot string
+	// PathCwd is the value of path.cwd.  Defaults to PathRoot, as if
+	// terraform was run from the root module.
+	PathCwd string
+}
+
 type Evaluation struct {
 	Analysis *Analysis
 	Modules  map[string]ValTree
 
+	// Options used for this evaluation, with defaults filled in.
+	Options EvaluationOptions
+
 	errors []error // Errors encountered during evaluation
 }
 
-func EvaluateAnalysis(analysis *Analysis) (*Evaluation, error) {
+func EvaluateAnalysis(analysis *Analysis, options EvaluationOptions) (*Evaluation, error) {
+	if options.Workspace == "" {
+		options.Workspace = "default"
+	}
+	if options.PathRoot == "" {
+		if root, ok := analysis.Modules[ModuleNameToString(EmptyModuleName)]; ok {
+			options.PathRoot = root.Dir
+		}
+	}
+	if options.PathCwd == "" {
+		options.PathCwd = options.PathRoot
+	}
+
 	eval := &Evaluation{
 		Analysis: analysis,
 		Modules:  map[string]ValTree{},
+		Options:  options,
 	}
 
 	for moduleKey := range analysis.Modules {
@@ -245,7 +284,16 @@ func (v *Evaluation) prepareVariables(name FullName, expr hcl.Expression) ValTre
 	sparse := EmptyObjectValTree()
 	for _, dep := range v.Analysis.dependencies(name, expr) {
 		var dependency ValTree
-		if dep.source != nil {
+		if variable, source := v.moduleInputVariable(dep); variable != nil {
+			// Values passed to a module are converted to the type constraint
+			// of the variable, so that optional attributes get defaults.
+			sourceModule := ModuleNameToString(source.Module)
+			val := ValTreeToValue(LookupValTree(v.Modules[sourceModule], source.Local))
+			dependency = SingletonValTree(
+				dep.destination.Local,
+				applyVariableType(variable, val),
+			)
+		} else if dep.source != nil {
 			sourceModule := ModuleNameToString(dep.source.Module)
 			dependency = BuildValTree(
 				dep.destination.Local,
@@ -254,6 +302,10 @@ func (v *Evaluation) prepareVariables(name FullName, expr hcl.Expression) ValTre
 		} else if dep.value != nil {
 			dependency = SingletonValTree(dep.destination.Local, *dep.value)
 		}
+		if dependency != nil && v.sensitiveVariable(dep.destination) {
+			val := ValTreeToValue(LookupValTree(dependency, dep.destination.Local))
+			dependency = SingletonValTree(dep.destination.Local, val.Mark(sensitiveMark))
+		}
 		if dependency != nil {
 			sparse = MergeValTree(sparse, dependency)
 		}
@@ -261,6 +313,54 @@ func (v *Evaluation) prepareVariables(name FullName, expr hcl.Expression) ValTre
 	return sparse
 }
 
+// sensitiveVariable checks if a name refers to a variable that is declared
+// with `sensitive = true`, or to an attribute of one.
+func (v *Evaluation) sensitiveVariable(name FullName) bool {
+	if len(name.Local) < 2 || name.Local[0] != "var" {
+		return false
+	}
+	key, ok := name.Local[1].(string)
+	if !ok {
+		return false
+	}
+	module, ok := v.Analysis.Modules[ModuleNameToString(name.Module)]
+	if !ok {
+		return false
+	}
+	variable, ok := module.variables[key]
+	return ok && variable.Sensitive
+}
+
+// moduleInputVariable checks if a dependency is a reference to a variable
+// with optional attributes that is set by the parent module.  If so, it
+// returns the variable declaration, and the name of the input value in the
+// parent module.
+func (v *Evaluation) moduleInputVariable(dep dependency) (*configs.Variable, *FullName) {
+	dest, source := dep.destination, dep.source
+	if source == nil || len(dest.Local) != 2 || dest.Local[0] != "var" {
+		return nil, nil
+	}
+	if len(source.Local) != 3 || source.Local[0] != "input" {
+		return nil, nil
+	}
+	name, ok := dest.Local[1].(string)
+	if !ok {
+		return nil, nil
+	}
+	module, ok := v.Analysis.Modules[ModuleNameToString(dest.Module)]
+	if !ok {
+		return nil, nil
+	}
+	variable, ok := module.variables[name]
+	if !ok || variable.ConstraintType == cty.NilType {
+		return nil, nil
+	}
+	if variable.TypeDefaults == nil && variable.ConstraintType.Equals(variable.Type) {
+		return nil, nil
+	}
+	return variable, source
+}
+
 func (v *Evaluation) evaluate() error {
 	// Obtain order
 	order, err := v.Analysis.order()
@@ -283,7 +383,9 @@ func (v *Evaluation) evaluate() error {
 
 		vars := v.prepareVariables(name, expr)
 		vars = MergeValTree(vars, SingletonValTree(LocalName{"path", "module"}, cty.StringVal(moduleMeta.Dir)))
-		vars = MergeValTree(vars, SingletonValTree(LocalName{"terraform", "workspace"}, cty.StringVal("default")))
+		vars = MergeValTree(vars, SingletonValTree(LocalName{"path", "root"}, cty.StringVal(v.Options.PathRoot)))
+		vars = MergeValTree(vars, SingletonValTree(LocalName{"path", "cwd"}, cty.StringVal(v.Options.PathCwd)))
+		vars = MergeValTree(vars, SingletonValTree(LocalName{"terraform", "workspace"}, cty.StringVal(v.Options.Workspace)))
 
 		// Add count.index if inside a counted resource.
 		resourceName, _, _ := name.AsResourceName()
@@ -308,9 +410,18 @@ func (v *Evaluation) evaluate() error {
 		}
 
 		val, diags := expr.Value(&ctx)
+		for _, diag := range v.diagnostics(name, diags) {
+			v.errors = append(v.errors, diag)
+		}
 		if diags.HasErrors() {
-			v.errors = append(v.errors, fmt.Errorf("evaluate: error: %s", diags))
-			val = cty.NullVal(val.Type())
+			// We could not evaluate this expression.  Rather than pretending
+			// the value is null, mark it as unknown so policies can tell the
+			// difference.
+			if val == cty.NilVal {
+				val = cty.DynamicVal
+			} else {
+				val = cty.UnknownVal(val.Type())
+			}
 		}
 
 		singleton := SingletonValTree(name.Local, val)
@@ -320,9 +431,38 @@ func (v *Evaluation) evaluate() error {
 	return nil
 }
 
+// diagnostics converts the HCL diagnostics produced while evaluating the
+// expression with the given name, linking them to the resource and attribute
+// the expression belongs to.
+func (v *Evaluation) diagnostics(name FullName, diags hcl.Diagnostics) []*Diagnostic {
+	out := newDiagnostics(diags, v.Analysis.sources)
+	resourceName, _, trailing := name.AsResourceName()
+	if resourceName == nil {
+		return out
+	}
+	resourceKey := resourceName.ToString()
+	if _, ok := v.Analysis.Resources[resourceKey]; !ok {
+		return out
+	}
+	for _, diag := range out {
+		diag.Resource = resourceKey
+		diag.Attribute = make([]interface{}, len(trailing))
+		copy(diag.Attribute, trailing)
+	}
+	return out
+}
+
 func (v *Evaluation) Resources() []models.ResourceState {
 	resources := []models.ResourceState{}
 
+	// Diagnostics that belong to resources go into their meta.
+	resourceDiags := map[string][]interface{}{}
+	for _, err := range v.errors {
+		if diag, ok := err.(*Diagnostic); ok && diag.Resource != "" {
+			resourceDiags[diag.Resource] = append(resourceDiags[diag.Resource], diag.Meta())
+		}
+	}
+
 	for resourceKey, resource := range v.Analysis.Resources {
 		resourceName, err := StringToFullName(resourceKey)
 		if err != nil || resourceName == nil {
@@ -353,18 +493,32 @@ func (v *Evaluation) Resources() []models.ResourceState {
 		}
 
 		attrs := map[string]interface{}{}
-		iface, errs := ValueToInterface(ValTreeToValue(attributes))
-		v.errors = append(v.errors, errs...)
+		attrsVal := ValTreeToValue(attributes)
+		iface, errs := ValueToInterface(attrsVal)
+		for _, err := range errs {
+			location := resource.Location
+			diag := &Diagnostic{
+				Severity: DiagnosticError,
+				Summary:  err.Error(),
+				Range:    &location,
+				Resource: resourceKey,
+				Snippet:  sourceSnippet(v.Analysis.sources, location),
+			}
+			v.errors = append(v.errors, diag)
+			resourceDiags[resourceKey] = append(resourceDiags[resourceKey], diag.Meta())
+		}
 		if obj, ok := iface.(map[string]interface{}); ok {
 			attrs = obj
 		}
 
 		metaTree := EmptyObjectValTree()
-		providerConfName := ProviderConfigName(resourceName.Module, resource.ProviderName)
-		providerConf := LookupValTree(
-			v.Modules[module],
-			providerConfName.Local,
-		)
+		var providerConf ValTree
+		if resource.ProviderConfig != nil {
+			providerConf = LookupValTree(
+				v.Modules[ModuleNameToString(resource.ProviderConfig.Module)],
+				resource.ProviderConfig.Local,
+			)
+		}
 		if obj, ok := providerConf.(map[string]interface{}); ok && len(obj) > 0 {
 			metaTree = MergeValTree(
 				metaTree,
@@ -375,6 +529,16 @@ func (v *Evaluation) Resources() []models.ResourceState {
 			)
 		}
 
+		if resource.ProviderAlias != "" {
+			metaTree = MergeValTree(
+				metaTree,
+				SingletonValTree(
+					[]interface{}{"terraform", "provider_alias"},
+					cty.StringVal(resource.ProviderAlias),
+				),
+			)
+		}
+
 		if resource.ProviderVersionConstraint != "" {
 			metaTree = MergeValTree(
 				metaTree,
@@ -392,11 +556,75 @@ func (v *Evaluation) Resources() []models.ResourceState {
 			}
 		}
 
-		// Add meta.region if present
+		// Add paths to sensitive attributes.
+		if sensitive := SensitivePaths(attrsVal); len(sensitive) > 0 {
+			sensitiveAttrs := make([]interface{}, len(sensitive))
+			for i, path := range sensitive {
+				sensitiveAttrs[i] = path
+			}
+			meta["sensitive_attributes"] = sensitiveAttrs
+		}
+
+		// Add paths to attributes we could not evaluate.
+		if unknown := UnknownPaths(attrsVal); len(unknown) > 0 {
+			tfmeta, ok := meta["terraform"].(map[string]interface{})
+			if !ok {
+				tfmeta = map[string]interface{}{}
+				meta["terraform"] = tfmeta
+			}
+			unknownAttrs := make([]interface{}, len(unknown))
+			for i, path := range unknown {
+				unknownAttrs[i] = path
+			}
+			tfmeta["unknown_attributes"] = unknownAttrs
+		}
+
+		if diags, ok := resourceDiags[resourceKey]; ok {
+			tfmeta, ok := meta["terraform"].(map[string]interface{})
+			if !ok {
+				tfmeta = map[string]interface{}{}
+				meta["terraform"] = tfmeta
+			}
+			tfmeta["diagnostics"] = diags
+		}
+
+		if len(resource.MovedFrom) > 0 || resource.Import != nil {
+			tfmeta, ok := meta["terraform"].(map[string]interface{})
+			if !ok {
+				tfmeta = map[string]interface{}{}
+				meta["terraform"] = tfmeta
+			}
+			if len(resource.MovedFrom) > 0 {
+				movedFrom := make([]interface{}, len(resource.MovedFrom))
+				for i, addr := range resource.MovedFrom {
+					movedFrom[i] = addr
+				}
+				tfmeta["moved_from"] = movedFrom
+			}
+			if resource.Import != nil {
+				imp := map[string]interface{}{}
+				idTree := LookupValTree(
+					v.Modules[ModuleNameToString(resource.Import.ID.Module)],
+					resource.Import.ID.Local,
+				)
+				if idVal, ok := idTree.(cty.Value); ok {
+					if id, errs := ValueToInterface(idVal); len(errs) == 0 && id != nil {
+						imp["id"] = id
+					}
+				}
+				tfmeta["import"] = imp
+			}
+		}
+
+		// Add meta.region and account hints if present
 		if tfmeta, ok := meta["terraform"].(map[string]interface{}); ok {
 			if pc, ok := tfmeta["provider_config"].(map[string]interface{}); ok {
 				if region, ok := pc["region"].(string); ok {
 					meta["region"] = region
+					tfmeta["region"] = region
+				}
+				if accountIds := providerAccountIds(pc); len(accountIds) > 0 {
+					tfmeta["account_ids"] = accountIds
 				}
 			}
 		}
@@ -413,11 +641,58 @@ func (v *Evaluation) Resources() []models.ResourceState {
 	return resources
 }
 
+// providerAccountIds collects the AWS account IDs a provider configuration
+// hints at, from `allowed_account_ids` and the role ARNs in `assume_role`
+// blocks.
+func providerAccountIds(providerConf map[string]interface{}) []interface{} {
+	seen := map[string]struct{}{}
+	if allowed, ok := providerConf["allowed_account_ids"].([]interface{}); ok {
+		for _, id := range allowed {
+			if str, ok := id.(string); ok {
+				seen[str] = struct{}{}
+			}
+		}
+	}
+	if assumeRoles, ok := providerConf["assume_role"].([]interface{}); ok {
+		for _, assumeRole := range assumeRoles {
+			if obj, ok := assumeRole.(map[string]interface{}); ok {
+				if arn, ok := obj["role_arn"].(string); ok {
+					// arn:partition:iam::account-id:role/role-name
+					parts := strings.SplitN(arn, ":", 6)
+					if len(parts) == 6 && parts[4] != "" {
+						seen[parts[4]] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+
+	sorted := []string{}
+	for id := range seen {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	accountIds := make([]interface{}, len(sorted))
+	for i, id := range sorted {
+		accountIds[i] = id
+	}
+	return accountIds
+}
+
 // Errors returns the non-fatal errors encountered during evaluation
 func (e *Evaluation) Errors() []error {
+	badKeys := []string{}
+	for badKey := range e.Analysis.badKeys {
+		badKeys = append(badKeys, badKey)
+	}
+	sort.Strings(badKeys)
 	errors := []error{}
-	for _, badKey := range e.Analysis.badKeys {
-		errors = append(errors, fmt.Errorf("Bad dependency key: %s", badKey))
+	for _, badKey := range badKeys {
+		errors = append(errors, &Diagnostic{
+			Severity: DiagnosticError,
+			Summary:  "Bad dependency key",
+			Detail:   badKey,
+		})
 	}
 	errors = append(errors, e.errors...)
 	return errors
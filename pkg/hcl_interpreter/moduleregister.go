@@ -16,6 +16,7 @@ package hcl_interpreter
 
 import (
 	"encoding/json"
+	"errors"
 	"path/filepath"
 
 	"github.com/spf13/afero"
@@ -29,6 +30,10 @@ import (
 type TerraformModuleRegister struct {
 	data terraformModuleRegisterFile
 	dir  string
+
+	// Resolver is an optional ModuleResolver that is used for remote modules
+	// that are not present in the register.
+	Resolver ModuleResolver
 }
 
 type terraformModuleRegisterFile struct {
@@ -57,6 +62,9 @@ func NewTerraformRegister(fsys afero.Fs, dir string) *TerraformModuleRegister {
 }
 
 func (r *TerraformModuleRegister) GetDir(source string) *string {
+	if r == nil {
+		return nil
+	}
 	for _, entry := range r.data.Modules {
 		if entry.Source == source {
 			joined := TfFilePathJoin(r.dir, entry.Dir)
@@ -65,3 +73,17 @@ func (r *TerraformModuleRegister) GetDir(source string) *string {
 	}
 	return nil
 }
+
+// Resolve tries to fetch a module that is not present in the register using
+// the Resolver.  Returns nil if there is no Resolver, or if it does not support
+// the source, so the module is only reported as missing.
+func (r *TerraformModuleRegister) Resolve(source string, version string) (*ResolvedModule, error) {
+	if r == nil || r.Resolver == nil {
+		return nil, nil
+	}
+	resolved, err := r.Resolver.ResolveModule(source, version)
+	if errors.Is(err, UnsupportedModuleSource) {
+		return nil, nil
+	}
+	return resolved, err
+}
@@ -0,0 +1,298 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// When a module call uses a source that is not a local path and that we cannot
+// find in `.terraform/modules/modules.json`, we can optionally try to fetch it
+// ourselves using a `ModuleResolver`.  Resolvers are opt-in: without one,
+// these modules are listed in `ModuleMeta.MissingRemoteModules`, as are
+// modules whose source is not supported by the resolver.
+
+// UnsupportedModuleSource is returned by a ModuleResolver that does not know
+// how to handle a given module source.  This allows combining resolvers using
+// NewMultiModuleResolver.
+var UnsupportedModuleSource = errors.New("Unsupported module source")
+
+// ModuleResolver locates the source code for a remote module.
+type ModuleResolver interface {
+	// ResolveModule returns the location of the module with the given source
+	// address and version constraint.  The version constraint may be empty.
+	// If the resolver does not support the given source, it should return an
+	// error wrapping UnsupportedModuleSource.
+	ResolveModule(source string, version string) (*ResolvedModule, error)
+}
+
+// ResolvedModule is the location of a module that was fetched by a
+// ModuleResolver.
+type ResolvedModule struct {
+	// Fs is the filesystem that the module lives on.  This may be different
+	// from the filesystem of the root module, e.g. when modules are cached on
+	// disk and the root module is read from an archive.
+	Fs afero.Fs
+	// Dir is the directory of the module within Fs.
+	Dir string
+	// Version is the exact version that was resolved, if applicable.
+	Version string
+}
+
+// MultiModuleResolver tries a number of resolvers in order.
+type MultiModuleResolver struct {
+	resolvers []ModuleResolver
+}
+
+func NewMultiModuleResolver(resolvers ...ModuleResolver) *MultiModuleResolver {
+	return &MultiModuleResolver{
+		resolvers: resolvers,
+	}
+}
+
+func (r *MultiModuleResolver) ResolveModule(source string, version string) (*ResolvedModule, error) {
+	for _, resolver := range r.resolvers {
+		resolved, err := resolver.ResolveModule(source, version)
+		if errors.Is(err, UnsupportedModuleSource) {
+			continue
+		}
+		return resolved, err
+	}
+	return nil, fmt.Errorf("%w: %s", UnsupportedModuleSource, source)
+}
+
+// ModuleCache is an on-disk cache of fetched modules, keyed by source address
+// and version.  Resolvers consult the cache before going to the network, so
+// once a module has been fetched, later runs can work offline.
+//
+// The layout is:
+//
+//     <dir>/<hash of source>/source
+//     <dir>/<hash of source>/<escaped version>/...module contents...
+//     <dir>/<hash of source>/<escaped version>.complete
+//
+// Unversioned sources use "_" as their version directory.  The marker file is
+// written last so interrupted downloads are not picked up.
+type ModuleCache struct {
+	fs  afero.Fs
+	dir string
+}
+
+func NewModuleCache(fs afero.Fs, dir string) *ModuleCache {
+	return &ModuleCache{
+		fs:  fs,
+		dir: dir,
+	}
+}
+
+const moduleCacheUnversioned = "_"
+const moduleCacheCompleteExt = ".complete"
+
+func (c *ModuleCache) sourceDir(source string) string {
+	hash := sha256.Sum256([]byte(source))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])[:32])
+}
+
+func (c *ModuleCache) versionDir(source string, version string) string {
+	if version == "" {
+		version = moduleCacheUnversioned
+	}
+	return filepath.Join(c.sourceDir(source), url.PathEscape(version))
+}
+
+// Lookup returns the cached module for the given source and exact version, or
+// nil if it is not present.
+func (c *ModuleCache) Lookup(source string, version string) *ResolvedModule {
+	dir := c.versionDir(source, version)
+	if _, err := c.fs.Stat(dir + moduleCacheCompleteExt); err == nil {
+		return &ResolvedModule{Fs: c.fs, Dir: dir, Version: version}
+	}
+	return nil
+}
+
+// Versions returns all versions that are cached for the given source.
+func (c *ModuleCache) Versions(source string) []string {
+	entries, err := afero.ReadDir(c.fs, c.sourceDir(source))
+	if err != nil {
+		return nil
+	}
+	versions := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, moduleCacheCompleteExt) {
+			continue
+		}
+		name = strings.TrimSuffix(name, moduleCacheCompleteExt)
+		if name == moduleCacheUnversioned {
+			continue
+		}
+		if version, err := url.PathUnescape(name); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Store adds a module to the cache.  The fill function is called with the
+// directory that it should write the module contents into.  The entry only
+// becomes visible to Lookup once fill has completed successfully.
+func (c *ModuleCache) Store(
+	source string,
+	version string,
+	fill func(fs afero.Fs, dir string) error,
+) (*ResolvedModule, error) {
+	sourceDir := c.sourceDir(source)
+	if err := c.fs.MkdirAll(sourceDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := afero.WriteFile(c.fs, filepath.Join(sourceDir, "source"), []byte(source), 0644); err != nil {
+		return nil, err
+	}
+
+	// Clean up any leftovers from an interrupted download.
+	dir := c.versionDir(source, version)
+	if err := c.fs.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := c.fs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := fill(c.fs, dir); err != nil {
+		c.fs.RemoveAll(dir)
+		return nil, err
+	}
+	if err := afero.WriteFile(c.fs, dir+moduleCacheCompleteExt, []byte{}, 0644); err != nil {
+		return nil, err
+	}
+	return &ResolvedModule{Fs: c.fs, Dir: dir, Version: version}, nil
+}
+
+// moduleSourceAddr is a parsed go-getter style source address, e.g.:
+//
+//     git::https://example.com/network.git//modules/vpc?ref=v1.2.0
+//
+// Has getter "git", url "https://example.com/network.git?ref=v1.2.0" and
+// subdir "modules/vpc".
+type moduleSourceAddr struct {
+	getter string
+	url    string
+	subdir string
+}
+
+func parseModuleSourceAddr(source string) moduleSourceAddr {
+	addr := moduleSourceAddr{}
+	if idx := strings.Index(source, "::"); idx > 0 && !strings.ContainsAny(source[:idx], "/:") {
+		addr.getter = source[:idx]
+		source = source[idx+2:]
+	}
+
+	// The subdirectory is separated using a double slash, but we need to
+	// skip the one that is part of the scheme.
+	offset := 0
+	if idx := strings.Index(source, "://"); idx >= 0 {
+		offset = idx + 3
+	}
+	query := ""
+	if idx := strings.Index(source, "?"); idx >= 0 {
+		query = source[idx:]
+		source = source[:idx]
+	}
+	if idx := strings.Index(source[offset:], "//"); idx >= 0 {
+		addr.subdir = source[offset+idx+2:]
+		source = source[:offset+idx]
+	}
+	addr.url = source + query
+	return addr
+}
+
+// String returns the address without the subdirectory.  This is used as key in
+// the cache, since different subdirectories share the same download.
+func (addr moduleSourceAddr) String() string {
+	if addr.getter != "" {
+		return addr.getter + "::" + addr.url
+	}
+	return addr.url
+}
+
+// resolveSubdir finds the requested subdirectory in a fetched module.  Like
+// go-getter, we allow glob patterns here, e.g. "*" to select the single
+// top-level directory in an archive.
+func (addr moduleSourceAddr) resolveSubdir(resolved *ResolvedModule) (*ResolvedModule, error) {
+	if addr.subdir == "" {
+		return resolved, nil
+	}
+	pattern, ok := joinWithin(resolved.Dir, addr.subdir)
+	if !ok {
+		return nil, fmt.Errorf("subdirectory %s is outside of the module", addr.subdir)
+	}
+	matches, err := afero.Glob(resolved.Fs, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) != 1 {
+		return nil, fmt.Errorf("subdirectory %s matched %d entries", addr.subdir, len(matches))
+	}
+	return &ResolvedModule{Fs: resolved.Fs, Dir: matches[0], Version: resolved.Version}, nil
+}
+
+// joinWithin joins a slash-separated path from a module source or archive to a
+// directory.  It returns false if the result would be outside of the directory,
+// since these paths come from untrusted input.
+func joinWithin(dir string, path string) (string, bool) {
+	dir = filepath.Clean(dir)
+	joined := filepath.Join(dir, filepath.FromSlash(path))
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	if joined != dir && !strings.HasPrefix(joined, prefix) {
+		return "", false
+	}
+	return joined, true
+}
+
+// copyDir recursively copies a directory from one filesystem to another.
+func copyDir(srcFs afero.Fs, src string, dstFs afero.Fs, dst string) error {
+	return afero.Walk(srcFs, src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return dstFs.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := afero.ReadFile(srcFs, path)
+		if err != nil {
+			return err
+		}
+		return afero.WriteFile(dstFs, target, contents, info.Mode().Perm())
+	})
+}
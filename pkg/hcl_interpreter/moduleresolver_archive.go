@@ -0,0 +1,267 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/snyk/policy-engine/pkg/internal/terraform/httpclient"
+)
+
+// ArchiveModuleResolver resolves module sources that point to an archive,
+// either by extension or using the go-getter "archive" parameter:
+//
+//     https://example.com/vpc-module.zip
+//     https://example.com/vpc-module?archive=tar.gz
+//     file:///opt/modules/vpc.tgz//vpc
+//
+// Local archives (file URLs and absolute paths) are read from Fs, or from the
+// OS filesystem if Fs is nil.  HTTP(S) archives are downloaded using Client.
+type ArchiveModuleResolver struct {
+	// Fs is used to read local archives.
+	Fs afero.Fs
+	// Client is used to download remote archives.  If nil, only local
+	// archives and cached downloads can be resolved.
+	Client *http.Client
+	// Cache is required, since the archive is extracted into it.
+	Cache *ModuleCache
+}
+
+// NewArchiveModuleResolver returns an ArchiveModuleResolver that downloads
+// remote archives using the default HTTP client.
+func NewArchiveModuleResolver(cache *ModuleCache) *ArchiveModuleResolver {
+	return &ArchiveModuleResolver{
+		Fs:     afero.NewOsFs(),
+		Client: httpclient.New(),
+		Cache:  cache,
+	}
+}
+
+var archiveExts = []string{
+	".tar.gz",
+	".tgz",
+	".tar.bz2",
+	".tbz2",
+	".tar",
+	".zip",
+}
+
+func (r *ArchiveModuleResolver) ResolveModule(source string, _ string) (*ResolvedModule, error) {
+	addr := parseModuleSourceAddr(source)
+	location, format, ok := archiveLocation(addr)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", UnsupportedModuleSource, source)
+	}
+	if r.Cache == nil {
+		return nil, fmt.Errorf("a module cache is required to extract %s", source)
+	}
+
+	key := addr.String()
+	if cached := r.Cache.Lookup(key, ""); cached != nil {
+		return addr.resolveSubdir(cached)
+	}
+
+	contents, err := r.read(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", location, err)
+	}
+	resolved, err := r.Cache.Store(key, "", func(fs afero.Fs, dir string) error {
+		return extractArchive(format, contents, fs, dir)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return addr.resolveSubdir(resolved)
+}
+
+// archiveLocation determines the location and format of an archive, or returns
+// false if the address does not look like an archive.
+func archiveLocation(addr moduleSourceAddr) (*url.URL, string, bool) {
+	switch addr.getter {
+	case "", "http", "https", "file":
+	default:
+		return nil, "", false
+	}
+
+	u, err := url.Parse(addr.url)
+	if err != nil {
+		return nil, "", false
+	}
+	if u.Scheme == "" && filepath.IsAbs(addr.url) {
+		u = &url.URL{Scheme: "file", Path: filepath.ToSlash(addr.url)}
+	}
+	switch u.Scheme {
+	case "http", "https", "file":
+	default:
+		return nil, "", false
+	}
+
+	query := u.Query()
+	format := query.Get("archive")
+	if format != "" {
+		query.Del("archive")
+		u.RawQuery = query.Encode()
+	} else {
+		for _, ext := range archiveExts {
+			if strings.HasSuffix(u.Path, ext) {
+				format = strings.TrimPrefix(ext, ".")
+				break
+			}
+		}
+	}
+	if format == "" {
+		return nil, "", false
+	}
+	return u, format, true
+}
+
+func (r *ArchiveModuleResolver) read(location *url.URL) ([]byte, error) {
+	if location.Scheme == "file" {
+		fs := r.Fs
+		if fs == nil {
+			fs = afero.NewOsFs()
+		}
+		return afero.ReadFile(fs, filepath.FromSlash(location.Path))
+	}
+
+	if r.Client == nil {
+		return nil, fmt.Errorf("not cached and no HTTP client is configured")
+	}
+	resp, err := r.Client.Get(location.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func extractArchive(format string, contents []byte, fs afero.Fs, dir string) error {
+	switch format {
+	case "zip":
+		return extractZip(contents, fs, dir)
+	case "tar":
+		return extractTar(bytes.NewReader(contents), fs, dir)
+	case "tar.gz", "tgz":
+		gz, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, fs, dir)
+	case "tar.bz2", "tbz2":
+		return extractTar(bzip2.NewReader(bytes.NewReader(contents)), fs, dir)
+	default:
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+func extractTar(reader io.Reader, fs afero.Fs, dir string) error {
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := archiveEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := fs.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveEntry(fs, target, tr, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZip(contents []byte, fs afero.Fs, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return err
+	}
+	for _, file := range zr.File {
+		target, err := archiveEntryPath(dir, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			if err := fs.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveEntry(fs, target, rc, file.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveEntryPath joins an archive entry name to the destination directory,
+// refusing entries that would escape it.
+func archiveEntryPath(dir string, name string) (string, error) {
+	target, ok := joinWithin(dir, name)
+	if !ok {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return target, nil
+}
+
+func writeArchiveEntry(fs afero.Fs, target string, reader io.Reader, mode os.FileMode) error {
+	if err := fs.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if mode.Perm() == 0 {
+		mode = 0644
+	}
+	f, err := fs.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, reader)
+	return err
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// GitModuleResolver resolves git module sources, such as:
+//
+//     git::https://example.com/network.git//modules/vpc?ref=v1.2.0
+//     git@github.com:example/network.git
+//     github.com/example/network
+//
+// Repositories are never fetched from the network.  Instead, they are cloned
+// from a local mirror directory which contains a clone (bare or not) of every
+// repository at "<host>/<path>", e.g. "github.com/example/network.git".  This
+// requires the git executable.
+type GitModuleResolver struct {
+	// MirrorDir is the directory with mirrored repositories.
+	MirrorDir string
+	// Cache is optional.  If set, checked out refs are stored there.
+	Cache *ModuleCache
+}
+
+var gitScpLikeRegex = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+\.[\w]+):([\w./~-]+?)(?:\.git)?(?:\?.*)?$`)
+var gitShorthandRegex = regexp.MustCompile(`^((?:github\.com|bitbucket\.org)/[\w.-]+/[\w.-]+?)(?:\.git)?$`)
+
+func (r *GitModuleResolver) ResolveModule(source string, _ string) (*ResolvedModule, error) {
+	addr := parseModuleSourceAddr(source)
+	repo, ref, ok := gitRepositoryPath(addr)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", UnsupportedModuleSource, source)
+	}
+
+	// The ref is passed to git, so make sure it can't be mistaken for an
+	// option.
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid ref %s in module source %s", ref, source)
+	}
+
+	key := addr.String()
+	if r.Cache != nil {
+		if cached := r.Cache.Lookup(key, ref); cached != nil {
+			return addr.resolveSubdir(cached)
+		}
+	}
+
+	mirror := ""
+	for _, candidate := range []string{repo, repo + ".git"} {
+		path, ok := joinWithin(r.MirrorDir, candidate)
+		if !ok {
+			return nil, fmt.Errorf("repository %s is outside of git mirror %s", repo, r.MirrorDir)
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			mirror = path
+			break
+		}
+	}
+	if mirror == "" {
+		return nil, fmt.Errorf("repository %s not found in git mirror %s", repo, r.MirrorDir)
+	}
+
+	checkout, err := ioutil.TempDir("", "policy-engine-git-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(checkout)
+	if err := gitCheckout(mirror, ref, checkout); err != nil {
+		return nil, err
+	}
+
+	// Without a cache, the checkout is kept in memory so we don't leave
+	// temporary directories behind.
+	var resolved *ResolvedModule
+	if r.Cache == nil {
+		fs := afero.NewMemMapFs()
+		if err := copyDir(afero.NewOsFs(), checkout, fs, "/module"); err != nil {
+			return nil, err
+		}
+		resolved = &ResolvedModule{Fs: fs, Dir: "/module", Version: ref}
+	} else {
+		resolved, err = r.Cache.Store(key, ref, func(fs afero.Fs, dir string) error {
+			return copyDir(afero.NewOsFs(), checkout, fs, dir)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return addr.resolveSubdir(resolved)
+}
+
+// gitRepositoryPath returns the "<host>/<path>" of the repository (without the
+// ".git" suffix), and the requested ref, if any.
+func gitRepositoryPath(addr moduleSourceAddr) (string, string, bool) {
+	raw := addr.url
+	ref := ""
+	if idx := strings.Index(raw, "?"); idx >= 0 {
+		if query, err := url.ParseQuery(raw[idx+1:]); err == nil {
+			ref = query.Get("ref")
+		}
+		raw = raw[:idx]
+	}
+
+	if addr.getter == "" {
+		if match := gitShorthandRegex.FindStringSubmatch(raw); match != nil {
+			return match[1], ref, true
+		}
+		if match := gitScpLikeRegex.FindStringSubmatch(raw); match != nil {
+			return match[1] + "/" + match[2], ref, true
+		}
+		return "", "", false
+	} else if addr.getter != "git" {
+		return "", "", false
+	}
+
+	if match := gitScpLikeRegex.FindStringSubmatch(raw); match != nil && !strings.Contains(raw, "://") {
+		return match[1] + "/" + match[2], ref, true
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	return u.Hostname() + "/" + path, ref, true
+}
+
+func gitCheckout(mirror string, ref string, dir string) error {
+	if err := runGit("", "clone", "--quiet", "--no-hardlinks", "--", mirror, dir); err != nil {
+		return err
+	}
+	if ref != "" {
+		if err := runGit(dir, "checkout", "--quiet", ref, "--"); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(dir, ".git"))
+}
+
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// Never prompt for credentials, the mirror is local.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/spf13/afero"
+
+	"github.com/snyk/policy-engine/pkg/internal/terraform/registry"
+	"github.com/snyk/policy-engine/pkg/internal/terraform/registry/regsrc"
+)
+
+// RegistryModuleResolver resolves module registry sources such as
+// "terraform-aws-modules/vpc/aws".  The registry is queried for the newest
+// version matching the constraint, and the download location it returns is
+// passed to Fetcher, which will typically be a combination of a
+// GitModuleResolver and an ArchiveModuleResolver.
+//
+// If a Cache is set, versions that were fetched before are used without
+// contacting the registry.
+type RegistryModuleResolver struct {
+	// Client is used to talk to the registry.  If this is nil, only cached
+	// modules can be resolved.
+	Client *registry.Client
+	// Fetcher downloads the location returned by the registry.
+	Fetcher ModuleResolver
+	// Cache is optional.
+	Cache *ModuleCache
+}
+
+func (r *RegistryModuleResolver) ResolveModule(source string, constraint string) (*ResolvedModule, error) {
+	if strings.Contains(source, "::") || strings.Contains(source, "://") {
+		return nil, fmt.Errorf("%w: %s", UnsupportedModuleSource, source)
+	}
+	module, err := regsrc.ParseModuleSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", UnsupportedModuleSource, source)
+	}
+
+	// Versions are shared across submodules, so use the root module as cache
+	// key.
+	submodule := module.RawSubmodule
+	module.RawSubmodule = ""
+	key := module.Normalized()
+
+	var constraints version.Constraints
+	if constraint != "" {
+		constraints, err = version.NewConstraint(constraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint for %s: %w", source, err)
+		}
+	}
+
+	var resolved *ResolvedModule
+	if r.Cache != nil {
+		if v := newestMatchingVersion(r.Cache.Versions(key), constraints); v != "" {
+			resolved = r.Cache.Lookup(key, v)
+		}
+	}
+
+	if resolved == nil {
+		resolved, err = r.fetch(module, key, constraints)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if submodule != "" {
+		dir, ok := joinWithin(resolved.Dir, submodule)
+		if !ok {
+			return nil, fmt.Errorf("submodule %s is outside of module %s", submodule, key)
+		}
+		resolved = &ResolvedModule{
+			Fs:      resolved.Fs,
+			Dir:     dir,
+			Version: resolved.Version,
+		}
+	}
+	return resolved, nil
+}
+
+func (r *RegistryModuleResolver) fetch(
+	module *regsrc.Module,
+	key string,
+	constraints version.Constraints,
+) (*ResolvedModule, error) {
+	if r.Client == nil {
+		return nil, fmt.Errorf("module %s is not cached and no registry client is configured", key)
+	}
+	if r.Fetcher == nil {
+		return nil, fmt.Errorf("no fetcher configured to download module %s", key)
+	}
+
+	response, err := r.Client.ModuleVersions(module)
+	if err != nil {
+		return nil, err
+	}
+	available := []string{}
+	for _, mod := range response.Modules {
+		for _, v := range mod.Versions {
+			available = append(available, v.Version)
+		}
+	}
+	v := newestMatchingVersion(available, constraints)
+	if v == "" {
+		return nil, fmt.Errorf("no version of %s matches constraint %s", key, constraints)
+	}
+
+	location, err := r.Client.ModuleLocation(module, v)
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := r.Fetcher.ResolveModule(location, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Cache == nil {
+		return &ResolvedModule{Fs: fetched.Fs, Dir: fetched.Dir, Version: v}, nil
+	}
+	return r.Cache.Store(key, v, func(fs afero.Fs, dir string) error {
+		return copyDir(fetched.Fs, fetched.Dir, fs, dir)
+	})
+}
+
+// newestMatchingVersion returns the newest version from the list that matches
+// the constraints, or the empty string if there is none.  Prereleases are only
+// considered when they are pinned exactly, like Terraform does.
+func newestMatchingVersion(available []string, constraints version.Constraints) string {
+	var newest *version.Version
+	for _, str := range available {
+		v, err := version.NewVersion(str)
+		if err != nil {
+			continue
+		}
+		if v.Prerelease() != "" && !pinsVersion(constraints, v) {
+			continue
+		}
+		if !constraints.Check(v) {
+			continue
+		}
+		if newest == nil || v.GreaterThan(newest) {
+			newest = v
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return newest.Original()
+}
+
+func pinsVersion(constraints version.Constraints, v *version.Version) bool {
+	for _, c := range constraints {
+		if strings.TrimLeft(c.String(), "= ") == v.Original() {
+			return true
+		}
+	}
+	return false
+}
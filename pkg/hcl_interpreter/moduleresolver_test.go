@@ -0,0 +1,311 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snyk/policy-engine/pkg/internal/terraform/registry"
+	registrytest "github.com/snyk/policy-engine/pkg/internal/terraform/registry/test"
+)
+
+func TestParseModuleSourceAddr(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected moduleSourceAddr
+	}{
+		{
+			source:   "git::https://example.com/network.git//modules/vpc?ref=v1.2.0",
+			expected: moduleSourceAddr{"git", "https://example.com/network.git?ref=v1.2.0", "modules/vpc"},
+		},
+		{
+			source:   "file:///download/foo/bar/0.2.3//*?archive=tar.gz",
+			expected: moduleSourceAddr{"", "file:///download/foo/bar/0.2.3?archive=tar.gz", "*"},
+		},
+		{
+			source:   "github.com/example/network",
+			expected: moduleSourceAddr{"", "github.com/example/network", ""},
+		},
+		{
+			source:   "git@github.com:example/network.git",
+			expected: moduleSourceAddr{"", "git@github.com:example/network.git", ""},
+		},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, parseModuleSourceAddr(test.source))
+	}
+}
+
+func TestGitRepositoryPath(t *testing.T) {
+	tests := []struct {
+		source string
+		repo   string
+		ref    string
+		ok     bool
+	}{
+		{"git::https://example.com/org/network.git//modules/vpc?ref=v1.2.0", "example.com/org/network", "v1.2.0", true},
+		{"git::ssh://git@example.com/org/network.git", "example.com/org/network", "", true},
+		{"git@github.com:example/network.git?ref=main", "github.com/example/network", "main", true},
+		{"github.com/example/network", "github.com/example/network", "", true},
+		{"terraform-aws-modules/vpc/aws", "", "", false},
+		{"https://example.com/vpc.zip", "", "", false},
+	}
+	for _, test := range tests {
+		repo, ref, ok := gitRepositoryPath(parseModuleSourceAddr(test.source))
+		assert.Equal(t, test.ok, ok, test.source)
+		assert.Equal(t, test.repo, repo, test.source)
+		assert.Equal(t, test.ref, ref, test.source)
+	}
+}
+
+func makeTarGz(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+const testModuleContents = `resource "aws_s3_bucket" "bucket" {
+  bucket_prefix = "resolved"
+}
+`
+
+func TestArchiveModuleResolver(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	archive := makeTarGz(t, map[string]string{
+		"network-1.0.0/vpc/main.tf": testModuleContents,
+	})
+	afero.WriteFile(fs, "/archives/network.tar.gz", archive, 0644)
+
+	resolver := &ArchiveModuleResolver{
+		Fs:    fs,
+		Cache: NewModuleCache(fs, "/cache"),
+	}
+
+	source := "file:///archives/network.tar.gz//*/vpc"
+	resolved, err := resolver.ResolveModule(source, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	contents, err := afero.ReadFile(resolved.Fs, filepath.Join(resolved.Dir, "main.tf"))
+	assert.Nil(t, err)
+	assert.Equal(t, testModuleContents, string(contents))
+
+	// The archive should now be cached.
+	fs.Remove("/archives/network.tar.gz")
+	cached, err := resolver.ResolveModule(source, "")
+	assert.Nil(t, err)
+	assert.Equal(t, resolved, cached)
+
+	_, err = resolver.ResolveModule("terraform-aws-modules/vpc/aws", "")
+	assert.True(t, errors.Is(err, UnsupportedModuleSource))
+}
+
+func TestRegistryModuleResolver(t *testing.T) {
+	archive := makeTarGz(t, map[string]string{
+		"main.tf":                testModuleContents,
+		"modules/nested/main.tf": testModuleContents,
+	})
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/modules/example/network/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"modules":[{"source":"example/network/aws","versions":[`+
+			`{"version":"1.0.0"},{"version":"1.2.0"},{"version":"1.3.0-beta"},{"version":"2.0.0"}]}]}`)
+	})
+	mux.HandleFunc("/v1/modules/example/network/aws/1.2.0/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Terraform-Get", "/archives/network-1.2.0.tar.gz")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/archives/network-1.2.0.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		downloads += 1
+		w.Write(archive)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+	cache := NewModuleCache(fs, "/cache")
+	resolver := &RegistryModuleResolver{
+		Client: registry.NewClient(registrytest.Disco(server), server.Client()),
+		Fetcher: &ArchiveModuleResolver{
+			Client: server.Client(),
+			Cache:  cache,
+		},
+		Cache: cache,
+	}
+
+	resolved, err := resolver.ResolveModule("example/network/aws", "~> 1.0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "1.2.0", resolved.Version)
+	_, err = afero.ReadFile(resolved.Fs, filepath.Join(resolved.Dir, "main.tf"))
+	assert.Nil(t, err)
+
+	// Further lookups, including submodules, are resolved from the cache
+	// without a registry.
+	resolver.Client = nil
+	nested, err := resolver.ResolveModule("example/network/aws//modules/nested", ">= 1.1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "1.2.0", nested.Version)
+	assert.Equal(t, filepath.Join(resolved.Dir, "modules", "nested"), nested.Dir)
+	assert.Equal(t, 1, downloads)
+
+	// Submodules can't be outside of the module.
+	_, err = resolver.ResolveModule("example/network/aws//../..", ">= 1.1")
+	assert.NotNil(t, err)
+
+	_, err = resolver.ResolveModule("example/network/aws", ">= 2.0")
+	assert.NotNil(t, err)
+}
+
+func TestGitModuleResolver(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	mirrorDir := t.TempDir()
+	repo := filepath.Join(mirrorDir, "example.com", "org", "network.git")
+	if err := os.MkdirAll(filepath.Join(repo, "modules", "vpc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if err := runGit(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "--quiet")
+	os.WriteFile(filepath.Join(repo, "modules", "vpc", "main.tf"), []byte(testModuleContents), 0644)
+	git("add", ".")
+	git("commit", "--quiet", "-m", "v1")
+	git("tag", "v1.0.0")
+	os.WriteFile(filepath.Join(repo, "modules", "vpc", "main.tf"), []byte("# v2\n"), 0644)
+	git("commit", "--quiet", "-am", "v2")
+
+	resolver := &GitModuleResolver{
+		MirrorDir: mirrorDir,
+		Cache:     NewModuleCache(afero.NewMemMapFs(), "/cache"),
+	}
+	resolved, err := resolver.ResolveModule("git::https://example.com/org/network.git//modules/vpc?ref=v1.0.0", "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "v1.0.0", resolved.Version)
+	contents, err := afero.ReadFile(resolved.Fs, filepath.Join(resolved.Dir, "main.tf"))
+	assert.Nil(t, err)
+	assert.Equal(t, testModuleContents, string(contents))
+
+	_, err = resolver.ResolveModule("git::https://example.com/org/missing.git", "")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, UnsupportedModuleSource))
+
+	// Module sources can't refer to paths outside of the mirror or the
+	// repository, and refs can't be passed to git as options.
+	for _, source := range []string{
+		"git@example.com:../../network",
+		"git::https://example.com/org/network.git//../..?ref=v1.0.0",
+		"git::https://example.com/org/network.git?ref=--orphan=x",
+	} {
+		_, err = resolver.ResolveModule(source, "")
+		assert.NotNil(t, err, source)
+		assert.False(t, errors.Is(err, UnsupportedModuleSource), source)
+	}
+
+	// Without a cache, the checkout is kept in memory rather than in a
+	// temporary directory.
+	resolver = &GitModuleResolver{MirrorDir: mirrorDir}
+	resolved, err = resolver.ResolveModule("git::https://example.com/org/network.git//modules/vpc?ref=v1.0.0", "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.IsType(t, &afero.MemMapFs{}, resolved.Fs)
+	contents, err = afero.ReadFile(resolved.Fs, filepath.Join(resolved.Dir, "main.tf"))
+	assert.Nil(t, err)
+	assert.Equal(t, testModuleContents, string(contents))
+}
+
+func TestParseDirectoryWithModuleResolver(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "src/main.tf", []byte(`
+module "remote" {
+  source = "https://example.com/remote.tar.gz"
+}
+
+module "missing" {
+  source = "example/missing/aws"
+}
+
+module "unsupported" {
+  source = "hg::https://example.com/unsupported"
+}
+`), 0644)
+
+	cache := NewModuleCache(fs, "/cache")
+	cache.Store("https://example.com/remote.tar.gz", "", func(fs afero.Fs, dir string) error {
+		return afero.WriteFile(fs, filepath.Join(dir, "main.tf"), []byte(testModuleContents), 0644)
+	})
+
+	register := NewTerraformRegister(fs, "src")
+	register.Resolver = NewMultiModuleResolver(
+		&ArchiveModuleResolver{Cache: cache},
+		&RegistryModuleResolver{Cache: cache},
+	)
+	mtree, err := ParseDirectory(register, fs, "src", VariableInputs{})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"example/missing/aws", "hg::https://example.com/unsupported"}, mtree.meta.MissingRemoteModules)
+	// Unsupported sources are only reported as missing, while the error from
+	// resolving the other module is kept.
+	assert.Len(t, mtree.Errors(), 2)
+
+	evaluation, err := EvaluateAnalysis(AnalyzeModuleTree(mtree), EvaluationOptions{})
+	assert.Nil(t, err)
+	resources := evaluation.Resources()
+	if !assert.Len(t, resources, 1) {
+		return
+	}
+	assert.Equal(t, "module.remote.aws_s3_bucket.bucket", resources[0].Id)
+	assert.Equal(t, "resolved", resources[0].Attributes["bucket_prefix"])
+}
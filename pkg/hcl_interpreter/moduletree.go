@@ -19,6 +19,7 @@ package hcl_interpreter
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
@@ -35,6 +36,10 @@ type ModuleMeta struct {
 	Filepaths            []string
 	MissingRemoteModules []string
 	Location             *hcl.Range
+
+	// Variable declarations, used to apply type constraints to values passed
+	// in by the parent module.
+	variables map[string]*configs.Variable
 }
 
 type ResourceMeta struct {
@@ -46,6 +51,26 @@ type ResourceMeta struct {
 	Count                     bool
 	Location                  hcl.Range
 	Body                      hcl.Body // For source code locations only.
+	DependsOn                 []hcl.Traversal
+
+	// The provider block that configures this resource, which may be in a
+	// parent module, and its alias.  ProviderConfig is nil if there is no
+	// provider block.
+	ProviderConfig *FullName
+	ProviderAlias  string
+
+	// Addresses this resource was moved from, according to moved blocks.
+	MovedFrom []string
+
+	// Set if an import block targets this resource.
+	Import *ResourceImport
+}
+
+type ResourceImport struct {
+	// Name of the import ID expression, which may refer to variables or
+	// locals in the module containing the import block.
+	ID       FullName
+	Location hcl.Range
 }
 
 // We load the entire tree of submodules in one pass.
@@ -56,14 +81,15 @@ type ModuleTree struct {
 	module         *configs.Module
 	variableValues map[string]cty.Value // Variables set
 	children       map[string]*ModuleTree
-	errors         []error // Non-fatal errors encountered during loading
+	sources        map[string][]byte // Contents of the files we parsed
+	errors         []error           // Non-fatal errors encountered during loading
 }
 
 func ParseDirectory(
 	moduleRegister *TerraformModuleRegister,
 	parserFs afero.Fs,
 	dir string,
-	varFiles []string,
+	inputs VariableInputs,
 ) (*ModuleTree, error) {
 	parser := configs.NewParser(parserFs)
 	var diags hcl.Diagnostics
@@ -86,8 +112,8 @@ func ParseDirectory(
 	}
 	// The order here is important so that var files that are explicitly specified get
 	// applied after any automatically-loaded var files.
-	varFiles = append(foundVarFiles, varFiles...)
-	return ParseFiles(moduleRegister, parserFs, true, dir, filepaths, varFiles)
+	inputs.VarFiles = append(foundVarFiles, inputs.VarFiles...)
+	return ParseFiles(moduleRegister, parserFs, true, dir, filepaths, inputs)
 }
 
 func ParseFiles(
@@ -96,7 +122,7 @@ func ParseFiles(
 	recurse bool,
 	dir string,
 	filepaths []string,
-	varfiles []string,
+	inputs VariableInputs,
 ) (*ModuleTree, error) {
 	meta := &ModuleMeta{
 		Dir:       dir,
@@ -117,19 +143,18 @@ func ParseFiles(
 	module, lDiags := configs.NewModule(parsedFiles, overrideFiles)
 	diags = append(diags, lDiags...)
 
-	// Deal with varfiles
+	// Deal with varfiles, environment and CLI variables
 	variableValues := map[string]cty.Value{}
-	for _, varfile := range varfiles {
-		values, lDiags := parser.LoadValuesFile(varfile)
-		for k, v := range values {
-			variableValues[k] = v
-		}
-		diags = append(diags, lDiags...)
+	if module != nil {
+		values, vDiags := inputs.values(parser, module)
+		variableValues = values
+		diags = append(diags, vDiags...)
 	}
 
+	sources := parser.Sources()
 	errors := []error{}
-	if diags.HasErrors() {
-		errors = append(errors, fmt.Errorf(diags.Error()))
+	for _, diag := range newDiagnostics(diags, sources) {
+		errors = append(errors, diag)
 	}
 	if module == nil {
 		// Only actually throw an error if we don't have a module.  We can
@@ -137,6 +162,8 @@ func ParseFiles(
 		return nil, fmt.Errorf(diags.Error())
 	}
 
+	meta.variables = module.Variables
+
 	children := map[string]*ModuleTree{}
 	if recurse {
 		for key, moduleCall := range module.ModuleCalls {
@@ -145,18 +172,34 @@ func ParseFiles(
 					if val, err := attr.Expr.Value(nil); err == nil && val.Type() == cty.String {
 						source := val.AsString()
 						childDir := TfFilePathJoin(dir, source)
+						childFs := parserFs
 
 						if register := moduleRegister.GetDir(source); register != nil {
 							childDir = *register
 						} else if !moduleIsLocal(source) {
-							meta.MissingRemoteModules = append(
-								meta.MissingRemoteModules,
-								source,
-							)
-							continue
+							version := ""
+							if moduleCall.Version.Required != nil {
+								version = moduleCall.Version.Required.String()
+							}
+							resolved, err := moduleRegister.Resolve(source, version)
+							if err != nil {
+								errors = append(
+									errors,
+									fmt.Errorf("Error resolving submodule '%s': %s", key, err),
+								)
+							}
+							if resolved == nil {
+								meta.MissingRemoteModules = append(
+									meta.MissingRemoteModules,
+									source,
+								)
+								continue
+							}
+							childFs = resolved.Fs
+							childDir = resolved.Dir
 						}
 
-						child, err := ParseDirectory(moduleRegister, parserFs, childDir, []string{})
+						child, err := ParseDirectory(moduleRegister, childFs, childDir, VariableInputs{})
 						if err == nil {
 							child.meta.Location = &moduleCall.SourceAddrRange
 							child.config = body
@@ -173,7 +216,7 @@ func ParseFiles(
 		}
 	}
 
-	return &ModuleTree{parserFs, meta, nil, module, variableValues, children, errors}, nil
+	return &ModuleTree{parserFs, meta, nil, module, variableValues, children, sources, errors}, nil
 }
 
 func (mtree *ModuleTree) Errors() []error {
@@ -205,6 +248,21 @@ func (mtree *ModuleTree) Errors() []error {
 	return errors
 }
 
+// Sources returns the contents of all files parsed for this module and its
+// children, by filename.
+func (mtree *ModuleTree) Sources() map[string][]byte {
+	sources := map[string][]byte{}
+	for filename, src := range mtree.sources {
+		sources[filename] = src
+	}
+	for _, child := range mtree.children {
+		for filename, src := range child.Sources() {
+			sources[filename] = src
+		}
+	}
+	return sources
+}
+
 func (mtree *ModuleTree) FilePath() string {
 	if mtree.meta.Recurse {
 		return mtree.meta.Dir
@@ -213,6 +271,22 @@ func (mtree *ModuleTree) FilePath() string {
 	}
 }
 
+// UnsetVariables returns the sorted names of the variables in this module that
+// have neither a value nor a default.  These are evaluated as unknown values.
+func (mtree *ModuleTree) UnsetVariables() []string {
+	unset := []string{}
+	for name, variable := range mtree.module.Variables {
+		if _, ok := mtree.variableValues[name]; ok {
+			continue
+		}
+		if variable.Default == cty.NilVal {
+			unset = append(unset, name)
+		}
+	}
+	sort.Strings(unset)
+	return unset
+}
+
 func (mtree *ModuleTree) LoadedFiles() []string {
 	filepaths := []string{filepath.Join(mtree.meta.Dir, ".terraform")}
 	if mtree.meta.Recurse {
@@ -246,12 +320,167 @@ type Visitor interface {
 }
 
 func (mtree *ModuleTree) Walk(v Visitor) {
-	walkModuleTree(v, EmptyModuleName, mtree)
+	refs := resourceRefs{
+		movedFrom: map[string][]string{},
+		imports:   map[string]*ResourceImport{},
+	}
+	collectResourceRefs(refs, EmptyModuleName, mtree)
+	walkModuleTree(v, EmptyModuleName, mtree, refs, providerConfigs{})
 }
 
-func walkModuleTree(v Visitor, moduleName ModuleName, mtree *ModuleTree) {
+// providerConfigs maps the provider configurations that are available in a
+// module, by their key in the module (e.g. "aws" or "aws.west"), to the
+// provider block that defines them.
+type providerConfigs map[string]providerConfig
+
+type providerConfig struct {
+	name  FullName
+	alias string
+}
+
+// moduleProviderConfigs adds the provider blocks in a module to the
+// configurations it inherited.
+func moduleProviderConfigs(
+	moduleName ModuleName,
+	module *configs.Module,
+	inherited providerConfigs,
+) providerConfigs {
+	providers := providerConfigs{}
+	for key, provider := range inherited {
+		providers[key] = provider
+	}
+	for key, provider := range module.ProviderConfigs {
+		providers[key] = providerConfig{
+			name:  ProviderConfigName(moduleName, key),
+			alias: provider.Alias,
+		}
+	}
+	return providers
+}
+
+// childProviderConfigs determines the configurations a module call passes
+// to the child module.  Like in Terraform, default configurations are
+// inherited unless the call has a `providers` argument, in which case only
+// the configurations listed there are passed.
+func childProviderConfigs(call *configs.ModuleCall, parent providerConfigs) providerConfigs {
+	child := providerConfigs{}
+	if call == nil {
+		return child
+	}
+	if len(call.Providers) == 0 {
+		for key, provider := range parent {
+			if !strings.Contains(key, ".") {
+				child[key] = provider
+			}
+		}
+		return child
+	}
+	for _, passed := range call.Providers {
+		if provider, ok := parent[passed.InParent.String()]; ok {
+			child[passed.InChild.String()] = provider
+		}
+	}
+	return child
+}
+
+// resourceRefs holds information from moved and import blocks, indexed by
+// the key of the resource they target.  These blocks may appear in a parent
+// module of the resource, so we collect them before walking the tree.
+type resourceRefs struct {
+	movedFrom map[string][]string
+	imports   map[string]*ResourceImport
+}
+
+func collectResourceRefs(refs resourceRefs, moduleName ModuleName, mtree *ModuleTree) {
+	for _, moved := range mtree.module.Moved {
+		to, ok := resourceAddress(moduleName, moved.To)
+		if !ok {
+			continue
+		}
+		from := TraversalToString(moved.From)
+		if len(moduleName) > 0 {
+			from = ModuleNameToString(moduleName) + "." + from
+		}
+		key := to.ToString()
+		refs.movedFrom[key] = append(refs.movedFrom[key], from)
+	}
+
+	for _, imp := range mtree.module.Import {
+		to, ok := resourceAddress(moduleName, imp.To)
+		if !ok || imp.ID == nil {
+			continue
+		}
+		refs.imports[to.ToString()] = &ResourceImport{
+			ID:       importIdName(moduleName, *to),
+			Location: imp.DeclRange,
+		}
+	}
+
+	for key, child := range mtree.children {
+		childModuleName := make([]string, len(moduleName)+1)
+		copy(childModuleName, moduleName)
+		childModuleName[len(moduleName)] = key
+		collectResourceRefs(refs, childModuleName, child)
+	}
+}
+
+// resourceAddress resolves an address used in a moved or import block, such
+// as `module.child.aws_s3_bucket.bucket[0]`, relative to the module it
+// appears in.  Instance keys are dropped, since we evaluate every resource
+// as a single instance.
+func resourceAddress(moduleName ModuleName, traversal hcl.Traversal) (*FullName, bool) {
+	parts := []string{}
+	for _, traverser := range traversal {
+		switch t := traverser.(type) {
+		case hcl.TraverseRoot:
+			parts = append(parts, t.Name)
+		case hcl.TraverseAttr:
+			parts = append(parts, t.Name)
+		}
+	}
+
+	module := make([]string, len(moduleName))
+	copy(module, moduleName)
+	for len(parts) >= 2 && parts[0] == "module" {
+		module = append(module, parts[1])
+		parts = parts[2:]
+	}
+
+	n := 2
+	if len(parts) > 0 && parts[0] == "data" {
+		n = 3
+	}
+	if len(parts) != n {
+		return nil, false
+	}
+	local := LocalName{}
+	for _, part := range parts {
+		local = append(local, part)
+	}
+	return &FullName{module, local}, true
+}
+
+// importIdName returns the name under which we evaluate the ID of an
+// import block, in the module containing the block.
+func importIdName(moduleName ModuleName, to FullName) FullName {
+	local := LocalName{"import"}
+	for _, child := range to.Module[len(moduleName):] {
+		local = append(local, "module", child)
+	}
+	local = append(local, to.Local...)
+	return FullName{moduleName, append(local, "id")}
+}
+
+func walkModuleTree(
+	v Visitor,
+	moduleName ModuleName,
+	mtree *ModuleTree,
+	refs resourceRefs,
+	inherited providerConfigs,
+) {
+	providers := moduleProviderConfigs(moduleName, mtree.module, inherited)
 	v.VisitModule(moduleName, mtree.meta)
-	walkModule(v, moduleName, mtree.module, mtree.variableValues)
+	walkModule(v, moduleName, mtree.module, mtree.variableValues, refs, providers)
 	for key, child := range mtree.children {
 		childModuleName := make([]string, len(moduleName)+1)
 		copy(childModuleName, moduleName)
@@ -261,23 +490,43 @@ func walkModuleTree(v Visitor, moduleName ModuleName, mtree *ModuleTree) {
 		configName := FullName{moduleName, LocalName{"input", key}}
 		walkBlock(v, configName, child.config)
 
-		walkModuleTree(v, childModuleName, child)
+		childProviders := childProviderConfigs(mtree.module.ModuleCalls[key], providers)
+		walkModuleTree(v, childModuleName, child, refs, childProviders)
 	}
 }
 
-func walkModule(v Visitor, moduleName ModuleName, module *configs.Module, variableValues map[string]cty.Value) {
+func walkModule(
+	v Visitor,
+	moduleName ModuleName,
+	module *configs.Module,
+	variableValues map[string]cty.Value,
+	refs resourceRefs,
+	providers providerConfigs,
+) {
 	name := EmptyFullName(moduleName)
 
 	for _, variable := range module.Variables {
+		var expr *hclsyntax.LiteralValueExpr
 		if val, ok := variableValues[variable.Name]; ok {
-			expr := hclsyntax.LiteralValueExpr{Val: val}
-			v.VisitExpr(name.AddKey("variable").AddKey(variable.Name), &expr)
+			expr = &hclsyntax.LiteralValueExpr{Val: val}
 		} else if !variable.Default.IsNull() {
-			expr := hclsyntax.LiteralValueExpr{
+			expr = &hclsyntax.LiteralValueExpr{
 				Val:      variable.Default,
 				SrcRange: variable.DeclRange,
 			}
-			v.VisitExpr(name.AddKey("variable").AddKey(variable.Name), &expr)
+		} else if variable.Default == cty.NilVal {
+			// Variables that are not set fall back to an unknown value, like
+			// they would in `terraform plan` without input.
+			expr = &hclsyntax.LiteralValueExpr{
+				Val:      cty.UnknownVal(variable.Type),
+				SrcRange: variable.DeclRange,
+			}
+		}
+		if expr != nil {
+			if variable.Sensitive {
+				expr.Val = expr.Val.Mark(sensitiveMark)
+			}
+			v.VisitExpr(name.AddKey("variable").AddKey(variable.Name), expr)
 		}
 	}
 
@@ -286,11 +535,17 @@ func walkModule(v Visitor, moduleName ModuleName, module *configs.Module, variab
 	}
 
 	for _, resource := range module.DataResources {
-		walkResource(v, moduleName, module, resource, true)
+		walkResource(v, moduleName, module, resource, true, refs, providers)
 	}
 
 	for _, resource := range module.ManagedResources {
-		walkResource(v, moduleName, module, resource, false)
+		walkResource(v, moduleName, module, resource, false, refs, providers)
+	}
+
+	for _, imp := range module.Import {
+		if to, ok := resourceAddress(moduleName, imp.To); ok && imp.ID != nil {
+			v.VisitExpr(importIdName(moduleName, *to), imp.ID)
+		}
 	}
 
 	for _, output := range module.Outputs {
@@ -312,6 +567,8 @@ func walkResource(
 	module *configs.Module,
 	resource *configs.Resource,
 	isDataResource bool,
+	refs resourceRefs,
+	providers providerConfigs,
 ) {
 	name := EmptyFullName(moduleName)
 	if isDataResource {
@@ -329,8 +586,19 @@ func walkResource(
 		Location:     resource.DeclRange,
 		Count:        haveCount,
 		Body:         resource.Config,
+		DependsOn:    resource.DependsOn,
 	}
 
+	if provider, ok := providers[providerName]; ok {
+		providerConfigName := provider.name
+		resourceMeta.ProviderConfig = &providerConfigName
+		resourceMeta.ProviderAlias = provider.alias
+	}
+
+	resourceKey := name.ToString()
+	resourceMeta.MovedFrom = refs.movedFrom[resourceKey]
+	resourceMeta.Import = refs.imports[resourceKey]
+
 	if providerReqs, ok := module.ProviderRequirements.RequiredProviders[resource.ProviderConfigAddr().LocalName]; ok {
 		resourceMeta.ProviderVersionConstraint = providerReqs.Requirement.Required.String()
 	}
@@ -0,0 +1,133 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// Relation is a reference from an attribute of one resource to another
+// resource.
+type Relation struct {
+	// From is the key of the referencing resource.
+	From string
+	// To is the key of the referenced resource.
+	To string
+	// Attribute is the path to the attribute of From that holds the
+	// reference.  This is "depends_on" for explicit dependencies.
+	Attribute LocalName
+}
+
+// Relations returns all references between resources.  References through
+// locals, variables and module inputs and outputs are followed, so the
+// relations may cross module boundaries.
+func (v *Analysis) Relations() []Relation {
+	memo := map[string]map[string]struct{}{}
+	relations := []Relation{}
+	for resourceKey, resourceMeta := range v.Resources {
+		resourceName, err := StringToFullName(resourceKey)
+		if err != nil {
+			continue
+		}
+
+		for _, exprName := range v.ResourceExpressions[resourceKey] {
+			expr, ok := v.Expressions[exprName.ToString()]
+			if !ok {
+				continue
+			}
+			_, _, attribute := exprName.AsResourceName()
+			for target := range v.referencedResources(exprName, expr, memo) {
+				if target != resourceKey {
+					relations = append(relations, Relation{resourceKey, target, attribute})
+				}
+			}
+		}
+
+		for _, traversal := range resourceMeta.DependsOn {
+			local, err := TraversalToLocalName(traversal)
+			if err != nil {
+				continue
+			}
+			full := FullName{Module: resourceName.Module, Local: local}
+			if target, _, _ := full.AsResourceName(); target != nil {
+				if _, ok := v.Resources[target.ToString()]; ok {
+					relations = append(relations, Relation{
+						From:      resourceKey,
+						To:        target.ToString(),
+						Attribute: LocalName{"depends_on"},
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(relations, func(i, j int) bool {
+		if relations[i].From != relations[j].From {
+			return relations[i].From < relations[j].From
+		}
+		if relations[i].To != relations[j].To {
+			return relations[i].To < relations[j].To
+		}
+		return LocalNameToString(relations[i].Attribute) < LocalNameToString(relations[j].Attribute)
+	})
+	return relations
+}
+
+// referencedResources returns the keys of the resources that an expression
+// depends on, either directly or through other expressions.  Results for
+// expressions that are not resource attributes are memoized.
+func (v *Analysis) referencedResources(
+	name FullName,
+	expr hcl.Expression,
+	memo map[string]map[string]struct{},
+) map[string]struct{} {
+	found := map[string]struct{}{}
+	for _, dep := range v.dependencies(name, expr) {
+		// Attributes that are absent from the resource have no source, but
+		// their destination still points to the resource.
+		target := dep.source
+		if target == nil && dep.value != nil {
+			target = &dep.destination
+		}
+		if target == nil {
+			continue
+		}
+
+		if resourceName, _, _ := target.AsResourceName(); resourceName != nil {
+			if _, ok := v.Resources[resourceName.ToString()]; ok {
+				found[resourceName.ToString()] = struct{}{}
+				continue
+			}
+		}
+
+		if dep.source == nil {
+			continue
+		}
+		sourceKey := dep.source.ToString()
+		if _, ok := memo[sourceKey]; !ok {
+			// Mark as visited before recursing to guard against cycles.
+			memo[sourceKey] = map[string]struct{}{}
+			if sourceExpr, ok := v.Expressions[sourceKey]; ok {
+				memo[sourceKey] = v.referencedResources(*dep.source, sourceExpr, memo)
+			}
+		}
+		for k := range memo[sourceKey] {
+			found[k] = struct{}{}
+		}
+	}
+	return found
+}
@@ -0,0 +1,687 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/afero"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+
+	"github.com/snyk/policy-engine/pkg/hcl_interpreter/funcs"
+	"github.com/snyk/policy-engine/pkg/internal/terraform/lang"
+)
+
+// TerragruntFilename is the name of Terragrunt configuration files.
+const TerragruntFilename = "terragrunt.hcl"
+
+// TerragruntConfig is the result of evaluating a Terragrunt configuration,
+// after merging in any included configurations.
+//
+// We support the parts of Terragrunt that determine what Terraform sees:
+// `include` blocks, `locals`, `dependency` blocks (using their mock outputs),
+// `inputs` and the `source` in the `terraform` block.  Other blocks, such as
+// `remote_state` or `generate`, are ignored.
+type TerragruntConfig struct {
+	// Path of the terragrunt.hcl file.
+	Path string
+
+	// Source is the `terraform.source` attribute, if set.
+	Source string
+
+	// ModuleDir is the directory containing the Terraform module to
+	// evaluate.  This is the directory of the configuration if no source is
+	// set.
+	ModuleDir string
+
+	// Inputs are passed to the module as variable values.
+	Inputs map[string]cty.Value
+
+	// Includes lists the paths of included configuration files.
+	Includes []string
+
+	// Non-fatal errors encountered while evaluating the configuration.
+	Errors []error
+}
+
+// ParseTerragrunt reads and evaluates the Terragrunt configuration at the
+// given path.  env contains environment variables in "key=value" form, used
+// by the `get_env` function.
+func ParseTerragrunt(fs afero.Fs, path string, env []string) (*TerragruntConfig, error) {
+	// Files are read through fs, so paths are resolved relative to the
+	// given path rather than made absolute.  See terragruntParser.result for
+	// the paths returned by functions such as get_terragrunt_dir().
+	path = filepath.Clean(path)
+	p := &terragruntParser{
+		fs:      fs,
+		env:     env,
+		dir:     filepath.Dir(path),
+		sources: map[string][]byte{},
+	}
+
+	body, err := p.parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &TerragruntConfig{
+		Path:   path,
+		Inputs: map[string]cty.Value{},
+	}
+
+	// Included configurations are evaluated first, since the child may
+	// access their locals and inputs through `include` if they are exposed.
+	includes := p.includes(body)
+	parents := []*terragruntFile{}
+	exposed := map[string]cty.Value{}
+	includeDirs := map[string]string{}
+	for _, include := range includes {
+		parentBody, err := p.parse(include.path)
+		if err != nil {
+			return nil, err
+		}
+		includeDirs[include.name] = filepath.Dir(include.path)
+		parent := p.evaluate(parentBody, map[string]string{
+			include.name: filepath.Dir(include.path),
+		}, cty.EmptyObjectVal)
+		parent.mergeStrategy = include.mergeStrategy
+		parents = append(parents, parent)
+		config.Includes = append(config.Includes, include.path)
+		if include.expose {
+			exposed[include.name] = parent.object()
+		}
+	}
+
+	includeVal := cty.ObjectVal(exposed)
+	if val, ok := exposed[""]; ok && len(exposed) == 1 {
+		// Unlabeled include blocks are accessed as `include.locals`.
+		includeVal = val
+	}
+	child := p.evaluate(body, includeDirs, includeVal)
+
+	// Attributes in the child take precedence over the included ones.
+	deep := false
+	for _, parent := range parents {
+		switch parent.mergeStrategy {
+		case "no_merge":
+			continue
+		case "deep":
+			deep = true
+			config.Inputs = deepMergeValues(config.Inputs, parent.inputs)
+		default:
+			for k, v := range parent.inputs {
+				config.Inputs[k] = v
+			}
+		}
+		if parent.source != "" {
+			config.Source = parent.source
+		}
+	}
+	if deep {
+		config.Inputs = deepMergeValues(config.Inputs, child.inputs)
+	} else {
+		for k, v := range child.inputs {
+			config.Inputs[k] = v
+		}
+	}
+	if child.source != "" {
+		config.Source = child.source
+	}
+
+	config.ModuleDir = p.dir
+	if config.Source != "" {
+		moduleDir, err := terragruntSourceDir(p.dir, config.Source)
+		if err != nil {
+			return nil, err
+		}
+		config.ModuleDir = moduleDir
+	}
+
+	for _, diag := range newDiagnostics(p.diags, p.sources) {
+		config.Errors = append(config.Errors, diag)
+	}
+	return config, nil
+}
+
+// terragruntSourceDir resolves a local `terraform.source`, relative to the
+// directory of the configuration.  Sources may use a double slash to refer to
+// a subdirectory, as in `../modules//vpc`.
+func terragruntSourceDir(dir string, source string) (string, error) {
+	if strings.Contains(source, "::") || strings.Contains(source, "://") ||
+		!(strings.HasPrefix(source, ".") || filepath.IsAbs(source)) {
+		return "", fmt.Errorf("remote Terraform source %q is not supported", source)
+	}
+	path := source
+	if idx := strings.Index(source, "//"); idx >= 0 {
+		path = source[:idx] + "/" + source[idx+2:]
+	}
+	path = strings.SplitN(path, "?", 2)[0]
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	return filepath.Join(dir, filepath.FromSlash(path)), nil
+}
+
+type terragruntParser struct {
+	fs  afero.Fs
+	env []string
+
+	// Directory of the configuration we are evaluating.  Functions such as
+	// get_terragrunt_dir() refer to this even inside included files.
+	dir string
+
+	sources map[string][]byte
+	diags   hcl.Diagnostics
+	depth   int
+
+	terraformFunctions map[string]function.Function
+}
+
+type terragruntInclude struct {
+	name          string
+	path          string
+	expose        bool
+	mergeStrategy string
+}
+
+// terragruntFile holds the evaluated contents of a single file.
+type terragruntFile struct {
+	locals        map[string]cty.Value
+	inputs        map[string]cty.Value
+	source        string
+	mergeStrategy string
+}
+
+// object returns the representation of a file used by `include` and by
+// read_terragrunt_config().
+func (f *terragruntFile) object() cty.Value {
+	return cty.ObjectVal(map[string]cty.Value{
+		"locals": cty.ObjectVal(f.locals),
+		"inputs": cty.ObjectVal(f.inputs),
+	})
+}
+
+func (p *terragruntParser) parse(path string) (*hclsyntax.Body, error) {
+	src, err := afero.ReadFile(p.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	filename := path
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, newDiagnostics(diags, map[string][]byte{filename: src})[0]
+	}
+	p.sources[filename] = src
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("could not parse %s", path)
+	}
+	return body, nil
+}
+
+func (p *terragruntParser) includes(body *hclsyntax.Body) []terragruntInclude {
+	ctx := p.evalContext(nil, nil)
+	includes := []terragruntInclude{}
+	for _, block := range body.Blocks {
+		if block.Type != "include" {
+			continue
+		}
+		include := terragruntInclude{}
+		if len(block.Labels) > 0 {
+			include.name = block.Labels[0]
+		}
+		for name, attr := range block.Body.Attributes {
+			val := p.value(attr.Expr, ctx)
+			if !val.IsKnown() || val.IsNull() {
+				continue
+			}
+			switch name {
+			case "path":
+				if val.Type() == cty.String {
+					include.path = val.AsString()
+				}
+			case "expose":
+				include.expose = val.Type() == cty.Bool && val.True()
+			case "merge_strategy":
+				if val.Type() == cty.String {
+					include.mergeStrategy = val.AsString()
+				}
+			}
+		}
+		if include.path == "" {
+			p.diags = append(p.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid include",
+				Detail:   "Could not determine the path of the included configuration.",
+				Subject:  block.DefRange().Ptr(),
+			})
+			continue
+		}
+		if !filepath.IsAbs(include.path) {
+			include.path = filepath.Join(p.dir, include.path)
+		}
+		includes = append(includes, include)
+	}
+	return includes
+}
+
+// evaluate evaluates the locals, dependencies, inputs and source in a file.
+// includeDirs holds the directories of the included configurations, by the
+// name of their include block.
+func (p *terragruntParser) evaluate(
+	body *hclsyntax.Body,
+	includeDirs map[string]string,
+	include cty.Value,
+) *terragruntFile {
+	file := &terragruntFile{
+		locals: map[string]cty.Value{},
+		inputs: map[string]cty.Value{},
+	}
+
+	vars := map[string]cty.Value{
+		"include": include,
+	}
+
+	// Locals may refer to each other, so we evaluate them in dependency
+	// order, by repeatedly evaluating those that only refer to locals we
+	// already know.
+	pending := map[string]hcl.Expression{}
+	for _, block := range body.Blocks {
+		if block.Type == "locals" {
+			for name, attr := range block.Body.Attributes {
+				pending[name] = attr.Expr
+			}
+		}
+	}
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		for _, name := range sortedKeys(pending) {
+			expr := pending[name]
+			if !localsKnown(expr, pending) {
+				continue
+			}
+			vars["local"] = cty.ObjectVal(file.locals)
+			file.locals[name] = p.value(expr, p.evalContext(includeDirs, vars))
+			delete(pending, name)
+			progress = true
+		}
+	}
+	for _, name := range sortedKeys(pending) {
+		p.diags = append(p.diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Cyclic local value",
+			Detail:   fmt.Sprintf("The local value %q refers to itself through other locals.", name),
+			Subject:  pending[name].Range().Ptr(),
+		})
+		file.locals[name] = cty.DynamicVal
+	}
+	vars["local"] = cty.ObjectVal(file.locals)
+
+	// Dependencies are not applied, so their outputs are the mock outputs if
+	// there are any.
+	dependencies := map[string]cty.Value{}
+	for _, block := range body.Blocks {
+		if block.Type != "dependency" || len(block.Labels) < 1 {
+			continue
+		}
+		dependency := map[string]cty.Value{
+			"outputs": cty.DynamicVal,
+		}
+		for name, attr := range block.Body.Attributes {
+			switch name {
+			case "config_path":
+				dependency["config_path"] = p.value(attr.Expr, p.evalContext(includeDirs, vars))
+			case "mock_outputs":
+				dependency["outputs"] = p.value(attr.Expr, p.evalContext(includeDirs, vars))
+			}
+		}
+		dependencies[block.Labels[0]] = cty.ObjectVal(dependency)
+	}
+	vars["dependency"] = cty.ObjectVal(dependencies)
+
+	ctx := p.evalContext(includeDirs, vars)
+	if attr, ok := body.Attributes["inputs"]; ok {
+		val := p.value(attr.Expr, ctx)
+		if val.IsKnown() && !val.IsNull() &&
+			(val.Type().IsObjectType() || val.Type().IsMapType()) {
+			for k, v := range val.AsValueMap() {
+				file.inputs[k] = v
+			}
+		}
+	}
+
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" {
+			continue
+		}
+		if attr, ok := block.Body.Attributes["source"]; ok {
+			val := p.value(attr.Expr, ctx)
+			if val.IsKnown() && !val.IsNull() && val.Type() == cty.String {
+				file.source = val.AsString()
+			}
+		}
+	}
+
+	return file
+}
+
+// value evaluates an expression, recording diagnostics and falling back to
+// an unknown value on errors.
+func (p *terragruntParser) value(expr hcl.Expression, ctx *hcl.EvalContext) cty.Value {
+	val, diags := expr.Value(ctx)
+	p.diags = append(p.diags, diags...)
+	if diags.HasErrors() || val == cty.NilVal {
+		return cty.DynamicVal
+	}
+	return val
+}
+
+// localsKnown checks that an expression does not refer to any pending
+// locals.
+func localsKnown(expr hcl.Expression, pending map[string]hcl.Expression) bool {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			if _, isPending := pending[attr.Name]; isPending {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *terragruntParser) evalContext(
+	includeDirs map[string]string,
+	vars map[string]cty.Value,
+) *hcl.EvalContext {
+	// The Terraform functions are the same for every context, so we only
+	// build them once.
+	if p.terraformFunctions == nil {
+		p.terraformFunctions = funcs.Override(p.fs, lang.Scope{
+			BaseDir:  p.dir,
+			PureOnly: false,
+		})
+	}
+	functions := map[string]function.Function{}
+	for name, fn := range p.terraformFunctions {
+		functions[name] = fn
+	}
+	for name, fn := range p.functions(includeDirs) {
+		functions[name] = fn
+	}
+	return &hcl.EvalContext{
+		Functions: functions,
+		Variables: vars,
+	}
+}
+
+// functions returns the Terragrunt built-in functions.  Functions that
+// depend on the environment we run in, such as get_aws_account_id(), return
+// unknown values.
+func (p *terragruntParser) functions(includeDirs map[string]string) map[string]function.Function {
+	constant := func(val string) function.Function {
+		return function.New(&function.Spec{
+			Type: function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				return cty.StringVal(val), nil
+			},
+		})
+	}
+	unknown := function.New(&function.Spec{
+		VarParam: &function.Parameter{
+			Name:      "args",
+			Type:      cty.DynamicPseudoType,
+			AllowNull: true,
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.DynamicVal, nil
+		},
+	})
+
+	// Functions that refer to an included configuration take the name of
+	// its include block, which may be omitted if there is only one.
+	include := func(fn func(parentDir string) string) function.Function {
+		return function.New(&function.Spec{
+			VarParam: &function.Parameter{
+				Name: "name",
+				Type: cty.String,
+			},
+			Type: function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				parentDir, err := p.includeDir(includeDirs, args)
+				if err != nil {
+					return cty.NilVal, err
+				}
+				return cty.StringVal(fn(parentDir)), nil
+			},
+		})
+	}
+	rel := func(base string, target string) string {
+		if rel, err := filepath.Rel(base, target); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return "."
+	}
+
+	fns := map[string]function.Function{
+		"find_in_parent_folders":      p.findInParentFoldersFunc(),
+		"get_env":                     p.getEnvFunc(),
+		"get_terragrunt_dir":          constant(p.result(p.dir)),
+		"get_original_terragrunt_dir": constant(p.result(p.dir)),
+		"get_parent_terragrunt_dir": include(func(parentDir string) string {
+			return p.result(parentDir)
+		}),
+		"path_relative_to_include": include(func(parentDir string) string {
+			return rel(parentDir, p.dir)
+		}),
+		"path_relative_from_include": include(func(parentDir string) string {
+			return rel(p.dir, parentDir)
+		}),
+		"read_terragrunt_config": p.readTerragruntConfigFunc(),
+	}
+	for _, name := range []string{
+		"get_aws_account_id",
+		"get_aws_caller_identity_arn",
+		"get_aws_caller_identity_user_id",
+		"get_terraform_command",
+		"get_terraform_cli_args",
+		"get_platform",
+		"run_cmd",
+		"sops_decrypt_file",
+	} {
+		fns[name] = unknown
+	}
+	return fns
+}
+
+// result converts a path to the form returned by functions.  Like in
+// Terragrunt, paths are absolute if the configuration was given by an
+// absolute path.  Otherwise, they are relative to the directory of the
+// configuration, so they can be combined with other relative paths in the
+// same way.
+func (p *terragruntParser) result(path string) string {
+	if filepath.IsAbs(p.dir) {
+		return path
+	}
+	if rel, err := filepath.Rel(p.dir, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// includeDir returns the directory of the include block named in args.
+// Without a name, it returns the directory of the only include block, or of
+// the configuration itself if there is none.
+func (p *terragruntParser) includeDir(includeDirs map[string]string, args []cty.Value) (string, error) {
+	if len(args) > 0 {
+		name := args[0].AsString()
+		if dir, ok := includeDirs[name]; ok {
+			return dir, nil
+		}
+		return "", fmt.Errorf("there is no include block named %q", name)
+	}
+	if dir, ok := includeDirs[""]; ok {
+		return dir, nil
+	}
+	switch len(includeDirs) {
+	case 0:
+		return p.dir, nil
+	case 1:
+		for _, dir := range includeDirs {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("the name of an include block is required when there are several")
+}
+
+func (p *terragruntParser) findInParentFoldersFunc() function.Function {
+	return function.New(&function.Spec{
+		VarParam: &function.Parameter{
+			Name: "args",
+			Type: cty.String,
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			name := TerragruntFilename
+			if len(args) > 0 {
+				name = args[0].AsString()
+			}
+			for _, dir := range parentDirs(p.dir) {
+				path := filepath.Join(dir, name)
+				if exists, _ := afero.Exists(p.fs, path); exists {
+					return cty.StringVal(p.result(path)), nil
+				}
+			}
+			if len(args) > 1 {
+				return args[1], nil
+			}
+			return cty.NilVal, fmt.Errorf("could not find %s in any of the parent folders of %s", name, p.dir)
+		},
+	})
+}
+
+// parentDirs lists the parent directories of a path, closest first.  For
+// relative paths, this stops at the directory the path is relative to.
+func parentDirs(dir string) []string {
+	dirs := []string{}
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dirs = append(dirs, parent)
+		dir = parent
+	}
+}
+
+func (p *terragruntParser) getEnvFunc() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "name", Type: cty.String},
+		},
+		VarParam: &function.Parameter{
+			Name: "default",
+			Type: cty.String,
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			prefix := args[0].AsString() + "="
+			for _, kv := range p.env {
+				if strings.HasPrefix(kv, prefix) {
+					return cty.StringVal(strings.TrimPrefix(kv, prefix)), nil
+				}
+			}
+			if len(args) > 1 {
+				return args[1], nil
+			}
+			return cty.NilVal, fmt.Errorf("environment variable %s is not set", args[0].AsString())
+		},
+	})
+}
+
+// maxTerragruntReadDepth limits nested read_terragrunt_config() calls.
+const maxTerragruntReadDepth = 8
+
+func (p *terragruntParser) readTerragruntConfigFunc() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+		},
+		VarParam: &function.Parameter{
+			Name: "default",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := args[0].AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(p.dir, path)
+			}
+			if exists, _ := afero.Exists(p.fs, path); !exists && len(args) > 1 {
+				return args[1], nil
+			}
+			if p.depth >= maxTerragruntReadDepth {
+				return cty.NilVal, fmt.Errorf("too many nested configurations reading %s", path)
+			}
+			body, err := p.parse(path)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			p.depth += 1
+			defer func() { p.depth -= 1 }()
+			return p.evaluate(body, nil, cty.EmptyObjectVal).object(), nil
+		},
+	})
+}
+
+// deepMergeValues merges objects and maps recursively, with values in
+// override taking precedence.
+func deepMergeValues(base map[string]cty.Value, override map[string]cty.Value) map[string]cty.Value {
+	merged := map[string]cty.Value{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		if b, ok := merged[k]; ok && mergeable(b) && mergeable(v) {
+			merged[k] = cty.ObjectVal(deepMergeValues(b.AsValueMap(), v.AsValueMap()))
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func mergeable(val cty.Value) bool {
+	return val.IsKnown() && !val.IsNull() &&
+		(val.Type().IsObjectType() || val.Type().IsMapType())
+}
+
+func sortedKeys(m map[string]hcl.Expression) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -17,6 +17,7 @@ package hcl_interpreter
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/zclconf/go-cty/cty"
 )
@@ -25,6 +26,7 @@ func ValueToInt(val cty.Value) *int {
 	if !val.IsKnown() || val.IsNull() {
 		return nil
 	}
+	val, _ = val.Unmark()
 
 	if val.Type() == cty.Number {
 		b := val.AsBigFloat()
@@ -41,6 +43,7 @@ func ValueToString(val cty.Value) *string {
 	if !val.IsKnown() || val.IsNull() || val.Type() != cty.String {
 		return nil
 	}
+	val, _ = val.Unmark()
 
 	str := val.AsString()
 	return &str
@@ -91,3 +94,98 @@ func ValueToInterface(val cty.Value) (interface{}, []error) {
 
 	return nil, []error{fmt.Errorf("Unhandled value type: %s", val.Type().GoString())}
 }
+
+// UnknownPaths returns the paths to all unknown values inside the given value.
+// Paths consist of string keys and integer indices.  Elements of sets cannot
+// be addressed, so if a set contains an unknown value the path to the set
+// itself is returned.
+func UnknownPaths(val cty.Value) [][]interface{} {
+	paths := [][]interface{}{}
+	val, _ = val.UnmarkDeep()
+	unknownPaths(val, []interface{}{}, &paths)
+	return paths
+}
+
+func unknownPaths(val cty.Value, path []interface{}, paths *[][]interface{}) {
+	if !val.IsKnown() {
+		unknown := make([]interface{}, len(path))
+		copy(unknown, path)
+		*paths = append(*paths, unknown)
+		return
+	}
+	if val.IsNull() {
+		return
+	}
+
+	ty := val.Type()
+	if ty.IsSetType() {
+		if !val.IsWhollyKnown() {
+			unknownPaths(cty.DynamicVal, path, paths)
+		}
+	} else if ty.IsListType() || ty.IsTupleType() {
+		for i, elem := range val.AsValueSlice() {
+			unknownPaths(elem, append(path, int64(i)), paths)
+		}
+	} else if ty.IsMapType() || ty.IsObjectType() {
+		valueMap := val.AsValueMap()
+		keys := make([]string, 0, len(valueMap))
+		for key := range valueMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			unknownPaths(valueMap[key], append(path, key), paths)
+		}
+	}
+}
+
+// SensitivePaths returns the paths to all values inside the given value that
+// are marked as sensitive, either because they were derived from a sensitive
+// variable or by the `sensitive()` function.  Like in UnknownPaths, sensitive
+// elements of sets are reported as the path to the set.
+func SensitivePaths(val cty.Value) [][]interface{} {
+	paths := [][]interface{}{}
+	sensitivePaths(val, []interface{}{}, &paths)
+	return paths
+}
+
+func sensitivePaths(val cty.Value, path []interface{}, paths *[][]interface{}) {
+	if val.HasMark(sensitiveMark) {
+		sensitive := make([]interface{}, len(path))
+		copy(sensitive, path)
+		*paths = append(*paths, sensitive)
+		return
+	}
+	val, _ = val.Unmark()
+	if !val.IsKnown() || val.IsNull() {
+		return
+	}
+
+	ty := val.Type()
+	if ty.IsSetType() {
+		_, pvms := val.UnmarkDeepWithPaths()
+		for _, pvm := range pvms {
+			if _, ok := pvm.Marks[sensitiveMark]; ok {
+				sensitivePaths(val.Mark(sensitiveMark), path, paths)
+				return
+			}
+		}
+	} else if ty.IsListType() || ty.IsTupleType() {
+		for i, elem := range val.AsValueSlice() {
+			sensitivePaths(elem, append(path, int64(i)), paths)
+		}
+	} else if ty.IsMapType() || ty.IsObjectType() {
+		valueMap := val.AsValueMap()
+		keys := make([]string, 0, len(valueMap))
+		for key := range valueMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sensitivePaths(valueMap[key], append(path, key), paths)
+		}
+	}
+}
+
+// sensitiveMark is the mark Terraform uses for sensitive values.
+const sensitiveMark = "sensitive"
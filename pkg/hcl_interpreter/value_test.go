@@ -0,0 +1,76 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUnknownPaths(t *testing.T) {
+	val := cty.ObjectVal(map[string]cty.Value{
+		"acl":    cty.NullVal(cty.String),
+		"bucket": cty.UnknownVal(cty.String),
+		"tags": cty.MapVal(map[string]cty.Value{
+			"Name":  cty.StringVal("bucket"),
+			"Owner": cty.UnknownVal(cty.String).Mark("sensitive"),
+		}),
+		"rules": cty.TupleVal([]cty.Value{
+			cty.StringVal("a"),
+			cty.DynamicVal,
+		}),
+		"ids": cty.SetVal([]cty.Value{
+			cty.StringVal("a"),
+			cty.UnknownVal(cty.String),
+		}),
+	})
+	assert.Equal(t, [][]interface{}{
+		{"bucket"},
+		{"ids"},
+		{"rules", int64(1)},
+		{"tags", "Owner"},
+	}, UnknownPaths(val))
+	assert.Equal(t, [][]interface{}{{}}, UnknownPaths(cty.DynamicVal))
+	assert.Equal(t, [][]interface{}{}, UnknownPaths(cty.StringVal("known")))
+}
+
+func TestSensitivePaths(t *testing.T) {
+	val := cty.ObjectVal(map[string]cty.Value{
+		"acl":      cty.StringVal("private"),
+		"password": cty.StringVal("hunter2").Mark("sensitive"),
+		"tags": cty.MapVal(map[string]cty.Value{
+			"Name":  cty.StringVal("bucket"),
+			"Owner": cty.UnknownVal(cty.String).Mark("sensitive"),
+		}),
+		"rules": cty.TupleVal([]cty.Value{
+			cty.StringVal("a"),
+			cty.StringVal("b").Mark("sensitive"),
+		}),
+		"ids": cty.SetVal([]cty.Value{
+			cty.StringVal("a"),
+			cty.StringVal("b").Mark("sensitive"),
+		}),
+	})
+	assert.Equal(t, [][]interface{}{
+		{"ids"},
+		{"password"},
+		{"rules", int64(1)},
+		{"tags", "Owner"},
+	}, SensitivePaths(val))
+	assert.Equal(t, [][]interface{}{{}}, SensitivePaths(cty.StringVal("secret").Mark("sensitive")))
+	assert.Equal(t, [][]interface{}{}, SensitivePaths(cty.StringVal("public")))
+}
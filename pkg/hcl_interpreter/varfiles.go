@@ -15,12 +15,142 @@
 package hcl_interpreter
 
 import (
+	"fmt"
 	"path/filepath"
 	"sort"
+	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/spf13/afero"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+
+	"github.com/snyk/policy-engine/pkg/internal/terraform/configs"
 )
 
+// VariableInputs holds the values for root module variables that are set from
+// outside the configuration.
+type VariableInputs struct {
+	// VarFiles contains paths to variable files, like the `-var-file` option.
+	// These are applied after any automatically discovered var files.
+	VarFiles []string
+	// Vars contains "name=value" assignments, like the `-var` option.  These
+	// take precedence over var files.
+	Vars []string
+	// Env contains environment variables in "key=value" form, as returned by
+	// os.Environ.  Only variables using the TF_VAR_ prefix are used.
+	Env []string
+	// Values contains values that were already evaluated, such as the inputs
+	// of a Terragrunt configuration.  Terragrunt passes these to Terraform as
+	// environment variables, so they have the same, lowest precedence.
+	Values map[string]cty.Value
+}
+
+const tfVarEnvPrefix = "TF_VAR_"
+
+// values computes the variable values for a module.  The precedence follows
+// Terraform's: environment variables are overridden by var files, which are
+// in turn overridden by `-var` assignments.
+func (inputs VariableInputs) values(
+	parser *configs.Parser,
+	module *configs.Module,
+) (map[string]cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	values := map[string]cty.Value{}
+
+	for name, val := range inputs.Values {
+		if _, declared := module.Variables[name]; declared {
+			values[name] = val
+		}
+	}
+
+	for _, env := range inputs.Env {
+		if !strings.HasPrefix(env, tfVarEnvPrefix) {
+			continue
+		}
+		name, raw, ok := splitVarAssignment(strings.TrimPrefix(env, tfVarEnvPrefix))
+		if !ok {
+			continue
+		}
+		// Like Terraform, we silently ignore environment variables that
+		// do not correspond to a declared variable.
+		variable, declared := module.Variables[name]
+		if !declared {
+			continue
+		}
+		val, vDiags := variable.ParsingMode.Parse(name, raw)
+		diags = append(diags, vDiags...)
+		values[name] = val
+	}
+
+	for _, varFile := range inputs.VarFiles {
+		fileValues, fDiags := parser.LoadValuesFile(varFile)
+		diags = append(diags, fDiags...)
+		for k, v := range fileValues {
+			values[k] = v
+		}
+	}
+
+	for _, assignment := range inputs.Vars {
+		name, raw, ok := splitVarAssignment(assignment)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid variable assignment",
+				Detail: fmt.Sprintf(
+					"The assignment %q must be a variable name and value separated by an equals sign.",
+					assignment,
+				),
+			})
+			continue
+		}
+		variable, declared := module.Variables[name]
+		if !declared {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Value for undeclared variable",
+				Detail:   fmt.Sprintf("A variable named %q was assigned, but it is not declared.", name),
+			})
+			continue
+		}
+		val, vDiags := variable.ParsingMode.Parse(name, raw)
+		diags = append(diags, vDiags...)
+		values[name] = val
+	}
+
+	for name, val := range values {
+		values[name] = applyVariableType(module.Variables[name], val)
+	}
+
+	return values, diags
+}
+
+// applyVariableType converts a value given for a variable with optional object
+// attributes to the type constraint, and fills in the defaults for those
+// attributes, like Terraform does.  Other values are returned unchanged, since
+// we are lenient about types elsewhere.
+func applyVariableType(variable *configs.Variable, val cty.Value) cty.Value {
+	if variable == nil || variable.ConstraintType == cty.NilType {
+		return val
+	}
+	if variable.TypeDefaults == nil && variable.ConstraintType.Equals(variable.Type) {
+		return val
+	}
+	converted, err := convert.Convert(val, variable.ConstraintType)
+	if err != nil {
+		return val
+	}
+	return variable.TypeDefaults.Apply(converted)
+}
+
+func splitVarAssignment(assignment string) (string, string, bool) {
+	idx := strings.Index(assignment, "=")
+	if idx <= 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(assignment[:idx]), assignment[idx+1:], true
+}
+
 func findVarFiles(fs afero.Fs, dir string) ([]string, error) {
 	// We want to sort files by basename.  The spec is:
 	//
@@ -36,8 +166,6 @@ func findVarFiles(fs afero.Fs, dir string) ([]string, error) {
 	globs := []string{
 		filepath.Join(dir, "terraform.tfvars"),
 		filepath.Join(dir, "terraform.tfvars.json"),
-		filepath.Join(dir, "*.auto.tfvars"),
-		filepath.Join(dir, "*.auto.tfvars.json"),
 	}
 	matches := []string{}
 	for _, glob := range globs {
@@ -45,7 +173,23 @@ func findVarFiles(fs afero.Fs, dir string) ([]string, error) {
 		if err != nil {
 			return matches, err
 		}
-		matches = append(sort.StringSlice(matches), m...)
+		matches = append(matches, m...)
+	}
+
+	// HCL and JSON auto var files are processed together.
+	auto := []string{}
+	for _, glob := range []string{
+		filepath.Join(dir, "*.auto.tfvars"),
+		filepath.Join(dir, "*.auto.tfvars.json"),
+	} {
+		m, err := afero.Glob(fs, glob)
+		if err != nil {
+			return matches, err
+		}
+		auto = append(auto, m...)
 	}
-	return matches, nil
+	sort.Slice(auto, func(i, j int) bool {
+		return filepath.Base(auto[i]) < filepath.Base(auto[j])
+	})
+	return append(matches, auto...), nil
 }
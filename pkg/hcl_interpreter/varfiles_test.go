@@ -0,0 +1,124 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcl_interpreter
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindVarFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, path := range []string{
+		"src/b.auto.tfvars",
+		"src/a.auto.tfvars.json",
+		"src/terraform.tfvars.json",
+		"src/terraform.tfvars",
+		"src/other.tfvars",
+	} {
+		afero.WriteFile(fs, path, []byte{}, 0644)
+	}
+	varFiles, err := findVarFiles(fs, "src")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"src/terraform.tfvars",
+		"src/terraform.tfvars.json",
+		"src/a.auto.tfvars.json",
+		"src/b.auto.tfvars",
+	}, varFiles)
+}
+
+func TestVariableInputs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "src/main.tf", []byte(`
+variable "from_env" {}
+variable "from_json" {}
+variable "from_var_file" {}
+variable "from_var" {
+  type = list(string)
+}
+variable "unset" {}
+variable "with_default" {
+  default = "default"
+}
+
+resource "aws_s3_bucket" "bucket" {
+  tags = {
+    from_env      = var.from_env
+    from_json     = var.from_json
+    from_var_file = var.from_var_file
+    from_var      = join(",", var.from_var)
+    unset         = var.unset
+    with_default  = var.with_default
+  }
+}
+`), 0644)
+	afero.WriteFile(fs, "src/terraform.tfvars.json", []byte(`{
+  "from_json": "json",
+  "from_var_file": "json"
+}`), 0644)
+	afero.WriteFile(fs, "vars.tfvars", []byte(`
+from_var_file = "var_file"
+from_var      = ["var_file"]
+`), 0644)
+
+	mtree, err := ParseDirectory(nil, fs, "src", VariableInputs{
+		VarFiles: []string{"vars.tfvars"},
+		Vars:     []string{`from_var=["a", "b"]`},
+		Env: []string{
+			"TF_VAR_from_env=env",
+			"TF_VAR_from_json=env",
+			"TF_VAR_undeclared=env",
+			"PATH=/usr/bin",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, mtree.Errors())
+	assert.Equal(t, []string{"unset"}, mtree.UnsetVariables())
+
+	evaluation, err := EvaluateAnalysis(AnalyzeModuleTree(mtree), EvaluationOptions{})
+	assert.Nil(t, err)
+	resources := evaluation.Resources()
+	if !assert.Len(t, resources, 1) {
+		return
+	}
+	assert.Equal(t, map[string]interface{}{
+		"from_env":      "env",
+		"from_json":     "json",
+		"from_var_file": "var_file",
+		"from_var":      "a,b",
+		"unset":         nil,
+		"with_default":  "default",
+	}, resources[0].Attributes["tags"])
+}
+
+func TestVariableInputsErrors(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "src/main.tf", []byte(`variable "foo" {}`), 0644)
+	mtree, err := ParseDirectory(nil, fs, "src", VariableInputs{
+		Vars: []string{"foo", "bar=baz"},
+	})
+	assert.Nil(t, err)
+	errs := mtree.Errors()
+	assert.Len(t, errs, 2)
+	for _, err := range errs {
+		diag, ok := err.(*Diagnostic)
+		assert.True(t, ok)
+		assert.Equal(t, DiagnosticError, diag.Severity)
+	}
+	assert.Equal(t, []string{"foo"}, mtree.UnsetVariables())
+}
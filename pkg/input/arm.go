@@ -18,7 +18,7 @@ package input
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/snyk/policy-engine/pkg/interfacetricks"
@@ -52,11 +52,22 @@ func (c *ArmDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration,
 	// Don't consider source code locations essential.
 	source, _ := LoadSourceInfoNode(contents)
 
+	parameters, errors := template.parameterValues(i.Fs, i.Path, opts)
+	evaluator := newArmEvaluator(template, parameters, opts.ArmContext)
+
 	// Create a map of resource ID to discovered resources.  This is necessary
 	// for source code locations.
+	resources := template.discover(evaluator)
 	discovered := map[string]arm_DiscoverResource{}
-	for _, d := range template.discover() {
+	for _, d := range resources {
 		discovered[d.name.String()] = d
+		evaluator.resources[d.name.String()] = struct{}{}
+	}
+
+	// Evaluate the properties up front, so problems with the copy loops in
+	// them are reported as errors before the state is produced.
+	for _, d := range resources {
+		d.evaluator.evaluate(d.resource.Properties)
 	}
 
 	path := i.Path
@@ -65,6 +76,8 @@ func (c *ArmDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration,
 		template:   template,
 		discovered: discovered,
 		source:     source,
+		evaluator:  evaluator,
+		errors:     errors,
 	}, nil
 }
 
@@ -77,6 +90,8 @@ type armConfiguration struct {
 	template   *arm_Template
 	discovered map[string]arm_DiscoverResource
 	source     *SourceInfoNode
+	evaluator  *armEvaluator
+	errors     []error
 }
 
 func (l *armConfiguration) ToState() models.State {
@@ -85,28 +100,86 @@ func (l *armConfiguration) ToState() models.State {
 	for id := range l.discovered {
 		resourceSet[id] = struct{}{}
 	}
-	refResolver := arm_ReferenceResolver{
-		resources: resourceSet,
+	// Resources can also be referred to by their name in dependsOn.
+	byName := map[string][]string{}
+	for id, d := range l.discovered {
+		if len(d.name.names) > 0 {
+			name := d.name.names[len(d.name.names)-1]
+			byName[name] = append(byName[name], id)
+		}
 	}
 
 	// Process resources
 	resources := []models.ResourceState{}
+	relations := []relation{}
 	for _, d := range l.discovered {
-		resource := d.process(&refResolver)
+		resource := d.process()
 		resource.Namespace = l.path
 		resources = append(resources, resource)
+		relations = append(relations, armRelations(resource, resourceSet, byName)...)
+	}
+
+	grouped := groupResourcesByType(resources)
+	meta := map[string]interface{}{
+		"filepath": l.path,
+	}
+	if edges := relationsMeta(grouped, relations); len(edges) > 0 {
+		meta["relations"] = edges
+	}
+	if parameters := l.evaluator.parametersMeta(); len(parameters) > 0 {
+		meta["arm"] = map[string]interface{}{
+			"parameters": parameters,
+		}
 	}
 
 	return models.State{
+		Format:              stateFormat,
+		FormatVersion:       stateFormatVersion,
 		InputType:           Arm.Name,
 		EnvironmentProvider: "iac",
-		Meta: map[string]interface{}{
-			"filepath": l.path,
-		},
-		Resources: groupResourcesByType(resources),
+		Meta:                meta,
+		Resources:           grouped,
 	}
 }
 
+// Finds references to other resources in the attributes of a processed
+// resource.  These are values that arm_ReferenceResolver replaced with a
+// resource ID, and entries in dependsOn, which may also use plain names.
+func armRelations(
+	resource models.ResourceState,
+	resourceSet map[string]struct{},
+	byName map[string][]string,
+) []relation {
+	relations := []relation{}
+	var walk func(path []interface{}, value interface{})
+	walk = func(path []interface{}, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			targets := []string{}
+			if _, ok := resourceSet[v]; ok {
+				targets = append(targets, v)
+			} else if len(path) == 2 && path[0] == "dependsOn" && len(byName[v]) == 1 {
+				targets = append(targets, byName[v][0])
+			}
+			for _, target := range targets {
+				attribute := make([]interface{}, len(path))
+				copy(attribute, path)
+				relations = append(relations, relation{resource.Id, target, attribute})
+			}
+		case []interface{}:
+			for i, elem := range v {
+				walk(append(path, i), elem)
+			}
+		case map[string]interface{}:
+			for k, elem := range v {
+				walk(append(path, k), elem)
+			}
+		}
+	}
+	walk([]interface{}{}, resource.Attributes)
+	return relations
+}
+
 func (l *armConfiguration) Location(path []interface{}) (LocationStack, error) {
 	// Format is {resourceNamespace, resourceType, resourceId, attributePath...}
 	if l.source == nil || len(path) < 3 {
@@ -144,7 +217,8 @@ func (l *armConfiguration) LoadedFiles() []string {
 }
 
 func (l *armConfiguration) Errors() []error {
-	return []error{}
+	errors := append([]error{}, l.errors...)
+	return append(errors, l.evaluator.errors.errors...)
 }
 
 func (l *armConfiguration) Type() *Type {
@@ -152,17 +226,21 @@ func (l *armConfiguration) Type() *Type {
 }
 
 type arm_Template struct {
-	Schema         string         `json:"$schema"`
-	ContentVersion string         `json:"contentVersion"`
-	Resources      []arm_Resource `json:"resources"`
+	Schema         string                  `json:"$schema"`
+	ContentVersion string                  `json:"contentVersion"`
+	Parameters     map[string]armParameter `json:"parameters"`
+	Variables      map[string]interface{}  `json:"variables"`
+	Resources      []arm_Resource          `json:"resources"`
 }
 
 type arm_Resource struct {
 	Type       string                 `json:"type"`
 	Name       string                 `json:"name"`
 	Properties map[string]interface{} `json:"properties"`
-	Tags       map[string]string      `json:"tags"`
+	Tags       interface{}            `json:"tags"`
 	Resources  []arm_Resource         `json:"resources"`
+	Copy       interface{}            `json:"copy"`
+	Condition  interface{}            `json:"condition"`
 	// OtherAttributes is a container for all other attributes that we're not
 	// capturing above.
 	OtherAttributes map[string]interface{} `json:"-"`
@@ -192,6 +270,8 @@ func (r *arm_Resource) UnmarshalJSON(bs []byte) error {
 	delete(resource.OtherAttributes, "properties")
 	delete(resource.OtherAttributes, "tags")
 	delete(resource.OtherAttributes, "resources")
+	delete(resource.OtherAttributes, "copy")
+	delete(resource.OtherAttributes, "condition")
 
 	// point r to our parsed resource
 	*r = arm_Resource(resource)
@@ -200,33 +280,88 @@ func (r *arm_Resource) UnmarshalJSON(bs []byte) error {
 }
 
 // A resource together with its JSON path and name metadata.  This allows us to
-// iterate them and obtain a flat list before we actually process them.
+// iterate them and obtain a flat list before we actually process them.  Copy
+// loops produce several resources with the same path, each with their own
+// evaluator.
 type arm_DiscoverResource struct {
-	name     arm_Name
-	path     []interface{}
-	resource arm_Resource
+	name      arm_Name
+	path      []interface{}
+	resource  arm_Resource
+	evaluator *armEvaluator
+	meta      map[string]interface{}
 }
 
-func (t arm_Template) discover() []arm_DiscoverResource {
+func (t arm_Template) discover(evaluator *armEvaluator) []arm_DiscoverResource {
 	discovered := []arm_DiscoverResource{}
-	var visit func([]interface{}, *arm_Name, arm_Resource)
+	var visit func([]interface{}, *arm_Name, arm_Resource, *armEvaluator)
+	var visitInstance func([]interface{}, *arm_Name, arm_Resource, *armEvaluator, map[string]interface{})
 	visit = func(
 		path []interface{},
 		parentName *arm_Name,
 		resource arm_Resource,
+		evaluator *armEvaluator,
 	) {
+		// Expand copy loops.  Resources with an unknown count are kept once.
+		if loop, ok := armResourceCopy(resource.Copy); ok {
+			n, known := evaluator.copyCount(loop)
+			if !known {
+				visitInstance(path, parentName, resource, evaluator, map[string]interface{}{
+					"copy": map[string]interface{}{"name": loop.name},
+				})
+				return
+			}
+			for i := 0; i < n; i++ {
+				visitInstance(path, parentName, resource, evaluator.withCopy(loop.name, i, true), map[string]interface{}{
+					"copy": map[string]interface{}{"name": loop.name, "index": i},
+				})
+			}
+			return
+		}
+		visitInstance(path, parentName, resource, evaluator, map[string]interface{}{})
+	}
+	visitInstance = func(
+		path []interface{},
+		parentName *arm_Name,
+		resource arm_Resource,
+		evaluator *armEvaluator,
+		meta map[string]interface{},
+	) {
+		// Resources whose condition is false are omitted, together with their
+		// children.  Unknown conditions are recorded as null.
+		if resource.Condition != nil {
+			meta["condition"] = resource.Condition
+			meta["condition_value"] = nil
+			r := evaluator.evaluate(resource.Condition)
+			if b, ok := r.value.(bool); r.known && ok {
+				if !b {
+					return
+				}
+				meta["condition_value"] = b
+			}
+		}
+
+		// Names are often expressions.  Unknown names are kept as they are.
+		resourceName := resource.Name
+		if r := evaluator.evaluateString(resource.Name); r.known {
+			if str, ok := r.value.(string); ok {
+				resourceName = str
+			}
+		}
+
 		// Extend or construct name.
-		name := parseArmName(resource.Type, resource.Name)
+		name := parseArmName(resource.Type, resourceName)
 		if parentName != nil {
 			// We are nested under some parent.
-			name = parentName.Child(resource.Type, resource.Name)
+			name = parentName.Child(resource.Type, resourceName)
 		}
 
 		// Add discovered resource.
 		discovered = append(discovered, arm_DiscoverResource{
-			name:     name,
-			path:     path,
-			resource: resource,
+			name:      name,
+			path:      path,
+			resource:  resource,
+			evaluator: evaluator,
+			meta:      meta,
 		})
 
 		// Recurse on children.
@@ -235,37 +370,47 @@ func (t arm_Template) discover() []arm_DiscoverResource {
 			copy(childPath, path)
 			childPath = append(childPath, "resources")
 			childPath = append(childPath, i)
-			visit(childPath, &name, child)
+			visit(childPath, &name, child, evaluator)
 		}
 	}
 
 	for i, top := range t.Resources {
-		visit([]interface{}{"resources", i}, nil, top)
+		visit([]interface{}{"resources", i}, nil, top, evaluator)
 	}
 	return discovered
 }
 
-func (d arm_DiscoverResource) process(
-	refResolver *arm_ReferenceResolver,
-) models.ResourceState {
+func (d arm_DiscoverResource) process() models.ResourceState {
 	r := d.resource
+	refResolver := &arm_ReferenceResolver{evaluator: d.evaluator}
 
 	attributes := map[string]interface{}{}
 	for k, attr := range r.OtherAttributes {
 		updated := interfacetricks.TopDownWalk(refResolver, interfacetricks.Copy(attr))
 		attributes[k] = updated
 	}
-	properties := map[string]interface{}{}
-	for k, attr := range r.Properties {
-		updated := interfacetricks.TopDownWalk(refResolver, interfacetricks.Copy(attr))
-		properties[k] = updated
-	}
-	attributes["properties"] = properties
+	// The properties are walked as a whole, since they may hold copy loops
+	// themselves.
+	attributes["properties"] = interfacetricks.TopDownWalk(
+		refResolver,
+		interfacetricks.Copy(r.Properties),
+	)
 	meta := map[string]interface{}{}
+	sensitive := []interface{}{}
+	d.evaluator.sensitiveAttributes([]interface{}{}, r.OtherAttributes, &sensitive)
+	d.evaluator.sensitiveAttributes([]interface{}{"properties"}, r.Properties, &sensitive)
+	if len(sensitive) > 0 {
+		meta["sensitive_attributes"] = sensitive
+	}
+	armMeta := map[string]interface{}{}
+	for k, v := range d.meta {
+		armMeta[k] = v
+	}
 	if parent := d.name.Parent(); parent != nil {
-		armMeta := map[string]interface{}{}
 		armMeta["parent_id"] = parent.String()
 		attributes["_parent_id"] = parent.String() // Backwards-compat :-(
+	}
+	if len(armMeta) > 0 {
 		meta["arm"] = armMeta
 	}
 
@@ -276,13 +421,74 @@ func (d arm_DiscoverResource) process(
 		Meta:         meta,
 	}
 
-	if len(r.Tags) > 0 {
-		state.Tags = r.Tags
+	if tags := d.evaluator.tags(r.Tags); len(tags) > 0 {
+		state.Tags = tags
 	}
 
 	return state
 }
 
+// sensitiveAttributes adds the paths of the attributes whose values are
+// derived from secure parameters.
+func (e *armEvaluator) sensitiveAttributes(
+	path []interface{},
+	value interface{},
+	sensitive *[]interface{},
+) {
+	switch v := value.(type) {
+	case string:
+		if e.evaluateString(v).sensitive {
+			attribute := make([]interface{}, len(path))
+			copy(attribute, path)
+			*sensitive = append(*sensitive, attribute)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			e.sensitiveAttributes(append(path, i), elem, sensitive)
+		}
+	case map[string]interface{}:
+		loops, copies := armCopyLoops(v)
+		keys := []string{}
+		for k := range v {
+			if k != "copy" || !copies {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			e.sensitiveAttributes(append(path, k), v[k], sensitive)
+		}
+		for _, loop := range loops {
+			n, _ := e.copyCount(loop)
+			for i := 0; i < n; i++ {
+				e.withCopy(loop.name, i, false).sensitiveAttributes(
+					append(path, loop.name, i), loop.input, sensitive)
+			}
+		}
+	}
+}
+
+// tags evaluates the tags of a resource, which may be given as an object or
+// as an expression for one.  Tags with unknown values are left out, and so
+// are tags derived from secure parameters, since tags are not redacted.
+func (e *armEvaluator) tags(value interface{}) map[string]string {
+	tags := map[string]string{}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		if r := e.evaluate(value); r.known && !r.sensitive {
+			obj, _ = r.value.(map[string]interface{})
+		}
+	}
+	for k, v := range obj {
+		if r := e.evaluate(v); r.known && !r.sensitive {
+			if str, ok := armString(r.value); ok {
+				tags[k] = str
+			}
+		}
+	}
+	return tags
+}
+
 // Microsoft.Network/virtualNetworks/VNet1/subnets/Subnet1 is represented by:
 //
 // - service: Microsoft.Network
@@ -357,42 +563,45 @@ func (child arm_Name) Parent() *arm_Name {
 	return &parent
 }
 
-// TopDownInterfaceWalker implementation to find and replace resource references
-// for ARM.
+// TopDownInterfaceWalker implementation to evaluate template expressions for
+// ARM.  Expressions whose values are unknown are replaced by the IDs of the
+// resources they reference, if any, and are kept as they are otherwise.
 type arm_ReferenceResolver struct {
-	// Set of present resources.
-	resources map[string]struct{}
+	evaluator *armEvaluator
 }
 
 func (*arm_ReferenceResolver) WalkArray(arr []interface{}) (interface{}, bool) {
 	return arr, true
 }
 
-func (*arm_ReferenceResolver) WalkObject(obj map[string]interface{}) (interface{}, bool) {
+func (resolver *arm_ReferenceResolver) WalkObject(obj map[string]interface{}) (interface{}, bool) {
+	if loops, ok := armCopyLoops(obj); ok {
+		return resolver.walkCopy(obj, loops), false
+	}
 	return obj, true
 }
 
 func (resolver *arm_ReferenceResolver) WalkString(s string) (interface{}, bool) {
-	if strings.HasPrefix(s, "[") {
-		re := regexp.MustCompile(`[\[\]()',[:space:]]+`)
-		rawTokens := re.Split(s, -1)
-		tokens := []string{}
-		for _, t := range rawTokens {
-			if t != "" {
-				tokens = append(tokens, t)
-			}
-		}
+	result := resolver.evaluator.evaluateString(s)
+	if result.known {
+		return result.value, false
+	}
 
-		if len(tokens) >= 3 && tokens[0] == "resourceId" {
-			typeStr := tokens[1]
-			nameStr := strings.Join(tokens[2:], "/")
-			ref := parseArmName(typeStr, nameStr).String()
-			if _, ok := resolver.resources[ref]; ok {
-				return ref, false
-			}
+	// For consistency with CloudFormation, return a single reference if
+	// possible, an array otherwise.
+	refs := []interface{}{}
+	seen := map[string]struct{}{}
+	for _, ref := range result.refs {
+		if _, ok := seen[ref]; !ok {
+			seen[ref] = struct{}{}
+			refs = append(refs, ref)
 		}
 	}
-
+	if len(refs) == 1 {
+		return refs[0], false
+	} else if len(refs) > 1 {
+		return refs, false
+	}
 	return s, false
 }
 
@@ -0,0 +1,185 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"fmt"
+
+	"github.com/snyk/policy-engine/pkg/interfacetricks"
+)
+
+// Copy loops create several instances of a resource, or the elements of an
+// array in properties and variables:
+//
+//     "copy": {"name": "storageLoop", "count": 3}
+//     "copy": [{"name": "dataDisks", "count": 2, "input": {"lun": "[copyIndex('dataDisks')]"}}]
+//
+// Within a loop, copyIndex() returns the current iteration.
+
+// armMaxCopyCount is the maximum number of iterations Azure allows in a copy
+// loop.
+const armMaxCopyCount = 800
+
+type armCopyLoop struct {
+	name  string
+	count interface{}
+	input interface{}
+}
+
+// armResourceCopy parses the copy property of a resource.
+func armResourceCopy(value interface{}) (armCopyLoop, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return armCopyLoop{}, false
+	}
+	name, _ := obj["name"].(string)
+	count, ok := obj["count"]
+	return armCopyLoop{name: name, count: count}, ok
+}
+
+// armCopyLoops parses the copy property of an object in properties or
+// variables.  It returns false if the object has no such property.
+func armCopyLoops(obj map[string]interface{}) ([]armCopyLoop, bool) {
+	arr, ok := obj["copy"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	loops := []armCopyLoop{}
+	for _, elem := range arr {
+		loop, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok1 := loop["name"].(string)
+		count, ok2 := loop["count"]
+		input, ok3 := loop["input"]
+		if !ok1 || !ok2 || !ok3 {
+			return nil, false
+		}
+		loops = append(loops, armCopyLoop{name: name, count: count, input: input})
+	}
+	return loops, true
+}
+
+// copyCount evaluates the number of iterations of a loop.  It returns false
+// if the count is unknown, or records an error and returns false if the count
+// is out of range, in which case the loop is left unexpanded.
+func (e *armEvaluator) copyCount(loop armCopyLoop) (int, bool) {
+	r := e.evaluate(loop.count)
+	n, ok := armInt(r.value)
+	if !r.known || !ok {
+		return 0, false
+	}
+	if n < 0 || n > armMaxCopyCount {
+		e.errors.add(fmt.Errorf(
+			"%w: copy loop %s has a count of %d, which is not between 0 and %d",
+			InvalidInput,
+			loop.name,
+			n,
+			armMaxCopyCount,
+		))
+		return 0, false
+	}
+	return n, true
+}
+
+// withCopy returns an evaluator for an iteration of a loop.  Resource loops
+// can also be referred to without a name.
+func (e *armEvaluator) withCopy(name string, index int, resource bool) *armEvaluator {
+	copied := *e
+	copied.copyIndexes = map[string]int{}
+	for k, v := range e.copyIndexes {
+		copied.copyIndexes[k] = v
+	}
+	copied.copyIndexes[name] = index
+	if resource {
+		copied.copyIndexes[""] = index
+	}
+	return &copied
+}
+
+// copyIndex implements copyIndex([loopName], [offset]).
+func (e *armEvaluator) copyIndex(args []interface{}) (interface{}, bool) {
+	name := ""
+	offset := 0
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			if i > 0 {
+				return nil, false
+			}
+			name = v
+		case float64:
+			n, ok := armInt(v)
+			if !ok {
+				return nil, false
+			}
+			offset = n
+		default:
+			return nil, false
+		}
+	}
+	index, ok := e.copyIndexes[name]
+	return float64(index + offset), ok
+}
+
+// evaluateCopy expands a loop in properties or variables to an array.
+func (e *armEvaluator) evaluateCopy(loop armCopyLoop) armResult {
+	n, ok := e.copyCount(loop)
+	if !ok {
+		return armUnknown()
+	}
+	arr := make([]interface{}, n)
+	results := make([]armResult, n)
+	for i := range arr {
+		results[i] = e.withCopy(loop.name, i, false).evaluate(loop.input)
+		arr[i] = results[i].value
+	}
+	return armAll(arr, results)
+}
+
+// walkCopy expands the loops in an object in the properties of a resource.
+// Loops with an unknown count are kept as they are.
+func (resolver *arm_ReferenceResolver) walkCopy(
+	obj map[string]interface{},
+	loops []armCopyLoop,
+) map[string]interface{} {
+	expanded := map[string]interface{}{}
+	for k, v := range obj {
+		if k != "copy" {
+			expanded[k] = interfacetricks.TopDownWalk(resolver, v)
+		}
+	}
+	unknown := []interface{}{}
+	for i, loop := range loops {
+		n, ok := resolver.evaluator.copyCount(loop)
+		if !ok {
+			unknown = append(unknown, obj["copy"].([]interface{})[i])
+			continue
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			iteration := &arm_ReferenceResolver{
+				evaluator: resolver.evaluator.withCopy(loop.name, i, false),
+			}
+			arr[i] = interfacetricks.TopDownWalk(iteration, interfacetricks.Copy(loop.input))
+		}
+		expanded[loop.name] = arr
+	}
+	if len(unknown) > 0 {
+		expanded["copy"] = unknown
+	}
+	return expanded
+}
@@ -0,0 +1,229 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ARM template expressions are strings enclosed in brackets, like
+// "[concat(parameters('prefix'), '-storage')]".  A string that starts with
+// "[[" is a literal string that starts with "[".
+
+// isArmExpression returns the expression in a string, if it holds one.
+func isArmExpression(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' || strings.HasPrefix(s, "[[") {
+		return "", false
+	}
+	return s[1 : len(s)-1], true
+}
+
+// armExpr is a node in the syntax tree of an ARM template expression.
+type armExpr interface{}
+
+type armLiteral struct {
+	value interface{}
+}
+
+type armCall struct {
+	name string
+	args []armExpr
+}
+
+// armProperty is a property access, like resourceGroup().location.
+type armProperty struct {
+	target armExpr
+	name   string
+}
+
+// armIndex is an index into an array or object, like variables('list')[0].
+type armIndex struct {
+	target armExpr
+	index  armExpr
+}
+
+type armToken struct {
+	kind  rune // One of the punctuation characters, 's', 'n' or 'i'.
+	text  string
+	value interface{}
+}
+
+func lexArmExpression(s string) ([]armToken, error) {
+	tokens := []armToken{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("(),.[]", c) >= 0:
+			tokens = append(tokens, armToken{kind: rune(c), text: string(c)})
+			i++
+		case c == '\'':
+			// Quotes are escaped by doubling them.
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string in expression: %s", s)
+			}
+			tokens = append(tokens, armToken{kind: 's', text: s[i : j+1], value: sb.String()})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && ((s[j] >= '0' && s[j] <= '9') || s[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number in expression: %s", s[i:j])
+			}
+			tokens = append(tokens, armToken{kind: 'n', text: s[i:j], value: n})
+			i = j
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || (s[j] >= 'a' && s[j] <= 'z') ||
+				(s[j] >= 'A' && s[j] <= 'Z') || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, armToken{kind: 'i', text: s[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q in expression: %s", c, s)
+		}
+	}
+	return tokens, nil
+}
+
+type armParser struct {
+	tokens []armToken
+	pos    int
+}
+
+// parseArmExpression parses an expression, without the enclosing brackets.
+func parseArmExpression(s string) (armExpr, error) {
+	tokens, err := lexArmExpression(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &armParser{tokens: tokens}
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s in expression: %s", p.tokens[p.pos].text, s)
+	}
+	return expr, nil
+}
+
+func (p *armParser) peek() rune {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].kind
+	}
+	return 0
+}
+
+func (p *armParser) expect(kind rune) (armToken, error) {
+	if p.pos >= len(p.tokens) {
+		return armToken{}, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	if token.kind != kind {
+		return armToken{}, fmt.Errorf("unexpected %s in expression", token.text)
+	}
+	p.pos++
+	return token, nil
+}
+
+func (p *armParser) expression() (armExpr, error) {
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case '.':
+			p.pos++
+			name, err := p.expect('i')
+			if err != nil {
+				return nil, err
+			}
+			expr = armProperty{target: expr, name: name.text}
+		case '[':
+			p.pos++
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(']'); err != nil {
+				return nil, err
+			}
+			expr = armIndex{target: expr, index: index}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *armParser) primary() (armExpr, error) {
+	switch p.peek() {
+	case 's', 'n':
+		token := p.tokens[p.pos]
+		p.pos++
+		return armLiteral{value: token.value}, nil
+	}
+
+	name, err := p.expect('i')
+	if err != nil {
+		return nil, err
+	}
+	// User-defined functions are called as namespace.function().
+	fn := name.text
+	if p.peek() == '.' && p.pos+2 < len(p.tokens) &&
+		p.tokens[p.pos+1].kind == 'i' && p.tokens[p.pos+2].kind == '(' {
+		fn = fn + "." + p.tokens[p.pos+1].text
+		p.pos += 2
+	}
+	if _, err := p.expect('('); err != nil {
+		return nil, err
+	}
+	args := []armExpr{}
+	for p.peek() != ')' {
+		if len(args) > 0 {
+			if _, err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.pos++
+	return armCall{name: fn, args: args}, nil
+}
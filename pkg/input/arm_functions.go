@@ -0,0 +1,1028 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// armResult is the result of evaluating an ARM template expression.  If the
+// value cannot be known, for example because it depends on the runtime state
+// of a resource, refs holds the IDs of the resources it depends on.  Values
+// derived from secure parameters are marked as sensitive.
+type armResult struct {
+	value     interface{}
+	known     bool
+	refs      []string
+	sensitive bool
+}
+
+// Limits imposed by Azure on the arguments of range() and padLeft().  Calls
+// that exceed them fail to deploy, so their results are left unknown rather
+// than building arbitrarily large values.
+const (
+	armMaxRangeCount = 10000
+	armMaxPadWidth   = 16
+)
+
+func armKnown(value interface{}) armResult {
+	return armResult{value: value, known: true}
+}
+
+func armUnknown(results ...armResult) armResult {
+	unknown := armResult{refs: []string{}}
+	for _, r := range results {
+		unknown.refs = append(unknown.refs, r.refs...)
+		unknown.sensitive = unknown.sensitive || r.sensitive
+	}
+	return unknown
+}
+
+// armAll returns a known value if all results are known.
+func armAll(value interface{}, results []armResult) armResult {
+	for _, r := range results {
+		if !r.known {
+			return armUnknown(results...)
+		}
+	}
+	result := armKnown(value)
+	for _, r := range results {
+		result.sensitive = result.sensitive || r.sensitive
+	}
+	return result
+}
+
+// armParameter is the declaration of a template parameter.
+type armParameter struct {
+	Type          string        `json:"type"`
+	DefaultValue  interface{}   `json:"defaultValue"`
+	AllowedValues []interface{} `json:"allowedValues"`
+}
+
+func (p armParameter) secure() bool {
+	t := strings.ToLower(p.Type)
+	return t == "securestring" || t == "secureobject"
+}
+
+// armEvaluator evaluates template expressions.  The deployment context holds
+// the values returned by functions such as resourceGroup() and
+// subscription().
+type armEvaluator struct {
+	parameters map[string]armParameter
+	values     map[string]armParameterValue
+	variables  map[string]interface{}
+	context    map[string]string
+
+	// resources is the set of resources in the template, by ID.
+	resources map[string]struct{}
+
+	// copyIndexes holds the current iteration of the copy loops that are
+	// being expanded, by loop name.  The resource loop is also stored under
+	// the empty name.
+	copyIndexes map[string]int
+
+	// Variables are evaluated once.  evaluating detects cycles.
+	cache      map[string]armResult
+	evaluating map[string]bool
+
+	// errors holds problems found while evaluating, such as copy loops with
+	// an invalid count.  It is shared by all copies of the evaluator.
+	errors *armErrors
+}
+
+// armErrors collects distinct errors, since the same expression may be
+// evaluated several times.
+type armErrors struct {
+	errors []error
+	seen   map[string]struct{}
+}
+
+func (e *armErrors) add(err error) {
+	if _, ok := e.seen[err.Error()]; ok {
+		return
+	}
+	e.seen[err.Error()] = struct{}{}
+	e.errors = append(e.errors, err)
+}
+
+func newArmEvaluator(
+	template *arm_Template,
+	values map[string]armParameterValue,
+	context map[string]string,
+) *armEvaluator {
+	return &armEvaluator{
+		parameters:  template.Parameters,
+		values:      values,
+		variables:   template.Variables,
+		context:     context,
+		resources:   map[string]struct{}{},
+		copyIndexes: map[string]int{},
+		cache:       map[string]armResult{},
+		evaluating:  map[string]bool{},
+		errors:      &armErrors{seen: map[string]struct{}{}},
+	}
+}
+
+// evaluate evaluates the expressions in a JSON value.
+func (e *armEvaluator) evaluate(value interface{}) armResult {
+	switch v := value.(type) {
+	case string:
+		return e.evaluateString(v)
+	case map[string]interface{}:
+		obj := map[string]interface{}{}
+		results := []armResult{}
+		loops, copies := armCopyLoops(v)
+		for k, elem := range v {
+			if k == "copy" && copies {
+				continue
+			}
+			r := e.evaluate(elem)
+			obj[k] = r.value
+			results = append(results, r)
+		}
+		for _, loop := range loops {
+			r := e.evaluateCopy(loop)
+			obj[loop.name] = r.value
+			results = append(results, r)
+		}
+		return armAll(obj, results)
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		results := make([]armResult, len(v))
+		for i := range v {
+			results[i] = e.evaluate(v[i])
+			arr[i] = results[i].value
+		}
+		return armAll(arr, results)
+	default:
+		return armKnown(value)
+	}
+}
+
+// evaluateString evaluates a string that may hold an expression.  Strings
+// that fail to parse are kept as they are.
+func (e *armEvaluator) evaluateString(s string) armResult {
+	if strings.HasPrefix(s, "[[") {
+		return armKnown(s[1:])
+	}
+	src, ok := isArmExpression(s)
+	if !ok {
+		return armKnown(s)
+	}
+	expr, err := parseArmExpression(src)
+	if err != nil {
+		return armKnown(s)
+	}
+	return e.evaluateExpr(expr)
+}
+
+func (e *armEvaluator) evaluateExpr(expr armExpr) armResult {
+	switch x := expr.(type) {
+	case armLiteral:
+		return armKnown(x.value)
+	case armProperty:
+		target := e.evaluateExpr(x.target)
+		if !target.known {
+			return target
+		}
+		if obj, ok := target.value.(map[string]interface{}); ok {
+			if v, ok := armLookup(obj, x.name); ok {
+				return armResult{value: v, known: true, sensitive: target.sensitive}
+			}
+		}
+		return armUnknown(target)
+	case armIndex:
+		target := e.evaluateExpr(x.target)
+		index := e.evaluateExpr(x.index)
+		if !target.known || !index.known {
+			return armUnknown(target, index)
+		}
+		switch t := target.value.(type) {
+		case []interface{}:
+			if i, ok := armInt(index.value); ok && i >= 0 && i < len(t) {
+				return armAll(t[i], []armResult{target, index})
+			}
+		case map[string]interface{}:
+			if k, ok := index.value.(string); ok {
+				if v, ok := armLookup(t, k); ok {
+					return armAll(v, []armResult{target, index})
+				}
+			}
+		}
+		return armUnknown(target, index)
+	case armCall:
+		return e.evaluateCall(x)
+	}
+	return armUnknown()
+}
+
+func (e *armEvaluator) evaluateCall(call armCall) armResult {
+	name := strings.ToLower(call.name)
+
+	// Only the chosen branch of if() is evaluated.
+	if name == "if" {
+		if len(call.args) != 3 {
+			return armUnknown()
+		}
+		cond := e.evaluateExpr(call.args[0])
+		b, ok := cond.value.(bool)
+		if !cond.known || !ok {
+			return armUnknown(cond)
+		}
+		branch := call.args[2]
+		if b {
+			branch = call.args[1]
+		}
+		result := e.evaluateExpr(branch)
+		return armAll(result.value, []armResult{cond, result})
+	}
+
+	results := make([]armResult, len(call.args))
+	args := make([]interface{}, len(call.args))
+	for i, arg := range call.args {
+		results[i] = e.evaluateExpr(arg)
+		args[i] = results[i].value
+	}
+
+	// Functions that return unknown values depending on resources.
+	if name == "reference" || strings.HasPrefix(name, "list") {
+		unknown := armUnknown(results...)
+		if len(args) > 0 {
+			if id, ok := args[0].(string); ok && results[0].known {
+				if _, ok := e.resources[id]; ok {
+					unknown.refs = append(unknown.refs, id)
+				}
+			}
+		}
+		return unknown
+	}
+
+	// Functions that accept unknown arguments, or return results of their own.
+	switch name {
+	case "parameters", "variables":
+		if len(args) != 1 || !results[0].known {
+			return armUnknown(results...)
+		}
+		n, ok := args[0].(string)
+		if !ok {
+			return armUnknown()
+		} else if name == "parameters" {
+			return e.parameter(n)
+		}
+		return e.variable(n)
+	case "and", "or":
+		return armLogical(name == "and", results)
+	case "coalesce":
+		for _, r := range results {
+			if !r.known {
+				return armUnknown(results...)
+			}
+			if r.value != nil {
+				return armAll(r.value, results)
+			}
+		}
+		return armAll(nil, results)
+	}
+
+	for _, r := range results {
+		if !r.known {
+			return armUnknown(results...)
+		}
+	}
+	value, ok := e.call(name, args)
+	if !ok {
+		return armUnknown(results...)
+	}
+	return armAll(value, results)
+}
+
+// armLogical evaluates and() and or(), which are known if any argument
+// decides the outcome.
+func armLogical(and bool, results []armResult) armResult {
+	unknown := false
+	for _, r := range results {
+		b, ok := r.value.(bool)
+		if !r.known || !ok {
+			unknown = true
+		} else if b != and {
+			return armAll(!and, []armResult{r})
+		}
+	}
+	if unknown {
+		return armUnknown(results...)
+	}
+	return armAll(and, results)
+}
+
+// call calls a function with known arguments.  It returns false if the
+// function is not supported, its value cannot be known, or the arguments are
+// not valid.
+func (e *armEvaluator) call(name string, args []interface{}) (interface{}, bool) {
+	switch name {
+	// Deployment functions.
+	case "copyindex":
+		return e.copyIndex(args)
+	case "resourcegroup":
+		return e.resourceGroup(), len(args) == 0
+	case "subscription":
+		return e.subscription(), len(args) == 0
+	case "deployment":
+		if name, ok := e.context["deploymentName"]; ok && len(args) == 0 {
+			return map[string]interface{}{"name": name}, true
+		}
+	case "resourceid":
+		return e.resourceId(args)
+	case "subscriptionresourceid":
+		if strs, ok := armStrings(args); ok {
+			i := armTypeIndex(strs)
+			if i < 0 || i > 1 {
+				return nil, false
+			}
+			sub, ok := e.context["subscriptionId"]
+			if i == 1 {
+				sub, ok = strs[0], true
+			}
+			if ok {
+				return "/subscriptions/" + sub + armProviderPath(strs[i:]), true
+			}
+		}
+	case "tenantresourceid":
+		if strs, ok := armStrings(args); ok && armTypeIndex(strs) == 0 {
+			return armProviderPath(strs), true
+		}
+
+	// Logical and comparison functions.
+	case "true":
+		return true, len(args) == 0
+	case "false":
+		return false, len(args) == 0
+	case "null":
+		return nil, len(args) == 0
+	case "not":
+		if len(args) == 1 {
+			b, ok := args[0].(bool)
+			return !b, ok
+		}
+	case "bool":
+		if len(args) == 1 {
+			switch v := args[0].(type) {
+			case bool:
+				return v, true
+			case string:
+				b, err := strconv.ParseBool(strings.ToLower(v))
+				return b, err == nil
+			case float64:
+				return v != 0, true
+			}
+		}
+	case "equals":
+		if len(args) == 2 {
+			return reflect.DeepEqual(args[0], args[1]), true
+		}
+	case "greater", "greaterorequals", "less", "lessorequals":
+		if len(args) == 2 {
+			cmp, ok := armCompare(args[0], args[1])
+			switch name {
+			case "greater":
+				return cmp > 0, ok
+			case "greaterorequals":
+				return cmp >= 0, ok
+			case "less":
+				return cmp < 0, ok
+			default:
+				return cmp <= 0, ok
+			}
+		}
+
+	// Numeric functions.
+	case "add", "sub", "mul", "div", "mod":
+		if len(args) == 2 {
+			a, ok1 := args[0].(float64)
+			b, ok2 := args[1].(float64)
+			if !ok1 || !ok2 {
+				return nil, false
+			}
+			switch name {
+			case "add":
+				return a + b, true
+			case "sub":
+				return a - b, true
+			case "mul":
+				return a * b, true
+			case "div":
+				return math.Trunc(a / b), b != 0
+			default:
+				return math.Mod(a, b), b != 0
+			}
+		}
+	case "int":
+		if len(args) == 1 {
+			switch v := args[0].(type) {
+			case float64:
+				return math.Trunc(v), true
+			case string:
+				n, err := strconv.Atoi(strings.TrimSpace(v))
+				return float64(n), err == nil
+			}
+		}
+	case "min", "max":
+		nums := args
+		if len(args) == 1 {
+			nums, _ = args[0].([]interface{})
+		}
+		if len(nums) == 0 {
+			return nil, false
+		}
+		result := 0.0
+		for i, arg := range nums {
+			n, ok := arg.(float64)
+			if !ok {
+				return nil, false
+			}
+			if i == 0 || (name == "min" && n < result) || (name == "max" && n > result) {
+				result = n
+			}
+		}
+		return result, true
+	case "range":
+		if len(args) == 2 {
+			start, ok1 := armInt(args[0])
+			count, ok2 := armInt(args[1])
+			if !ok1 || !ok2 || count < 0 || count > armMaxRangeCount {
+				return nil, false
+			}
+			arr := make([]interface{}, count)
+			for i := range arr {
+				arr[i] = float64(start + i)
+			}
+			return arr, true
+		}
+
+	// String, array and object functions.
+	case "string":
+		if len(args) == 1 {
+			return armString(args[0])
+		}
+	case "concat":
+		if len(args) > 0 {
+			if _, ok := args[0].([]interface{}); ok {
+				arr := []interface{}{}
+				for _, arg := range args {
+					elems, ok := arg.([]interface{})
+					if !ok {
+						return nil, false
+					}
+					arr = append(arr, elems...)
+				}
+				return arr, true
+			}
+		}
+		var sb strings.Builder
+		for _, arg := range args {
+			s, ok := armString(arg)
+			if !ok {
+				return nil, false
+			}
+			sb.WriteString(s)
+		}
+		return sb.String(), true
+	case "format":
+		if len(args) > 0 {
+			if f, ok := args[0].(string); ok {
+				return armFormat(f, args[1:])
+			}
+		}
+	case "tolower", "toupper", "trim", "base64", "base64tostring", "json":
+		if len(args) == 1 {
+			if s, ok := args[0].(string); ok {
+				switch name {
+				case "tolower":
+					return strings.ToLower(s), true
+				case "toupper":
+					return strings.ToUpper(s), true
+				case "trim":
+					return strings.TrimSpace(s), true
+				case "base64":
+					return base64.StdEncoding.EncodeToString([]byte(s)), true
+				case "base64tostring":
+					bs, err := base64.StdEncoding.DecodeString(s)
+					return string(bs), err == nil
+				default:
+					var v interface{}
+					err := json.Unmarshal([]byte(s), &v)
+					return v, err == nil
+				}
+			}
+		}
+	case "substring":
+		if len(args) >= 2 && len(args) <= 3 {
+			s, ok1 := args[0].(string)
+			start, ok2 := armInt(args[1])
+			length := len(s) - start
+			ok3 := true
+			if len(args) == 3 {
+				length, ok3 = armInt(args[2])
+			}
+			if ok1 && ok2 && ok3 && start >= 0 && length >= 0 && start+length <= len(s) {
+				return s[start : start+length], true
+			}
+		}
+	case "replace":
+		if strs, ok := armStrings(args); ok && len(strs) == 3 {
+			return strings.ReplaceAll(strs[0], strs[1], strs[2]), true
+		}
+	case "startswith", "endswith", "indexof", "lastindexof":
+		// These are case-insensitive.
+		if strs, ok := armStrings(args); ok && len(strs) == 2 {
+			s, sub := strings.ToLower(strs[0]), strings.ToLower(strs[1])
+			switch name {
+			case "startswith":
+				return strings.HasPrefix(s, sub), true
+			case "endswith":
+				return strings.HasSuffix(s, sub), true
+			case "indexof":
+				return float64(strings.Index(s, sub)), true
+			default:
+				return float64(strings.LastIndex(s, sub)), true
+			}
+		}
+	case "padleft":
+		if len(args) >= 2 && len(args) <= 3 {
+			s, ok1 := armString(args[0])
+			width, ok2 := armInt(args[1])
+			pad := " "
+			ok3 := true
+			if len(args) == 3 {
+				pad, ok3 = args[2].(string)
+			}
+			if ok1 && ok2 && ok3 && len(pad) == 1 && width <= armMaxPadWidth {
+				if len(s) < width {
+					s = strings.Repeat(pad, width-len(s)) + s
+				}
+				return s, true
+			}
+		}
+	case "split":
+		if len(args) == 2 {
+			s, ok := args[0].(string)
+			if !ok {
+				return nil, false
+			}
+			delims := []string{}
+			switch d := args[1].(type) {
+			case string:
+				delims = append(delims, d)
+			case []interface{}:
+				strs, ok := armStrings(d)
+				if !ok {
+					return nil, false
+				}
+				delims = strs
+			}
+			parts := []string{s}
+			for _, delim := range delims {
+				split := []string{}
+				for _, part := range parts {
+					split = append(split, strings.Split(part, delim)...)
+				}
+				parts = split
+			}
+			arr := make([]interface{}, len(parts))
+			for i := range parts {
+				arr[i] = parts[i]
+			}
+			return arr, true
+		}
+	case "join":
+		if len(args) == 2 {
+			arr, ok1 := args[0].([]interface{})
+			delim, ok2 := args[1].(string)
+			strs, ok3 := armStrings(arr)
+			if ok1 && ok2 && ok3 {
+				return strings.Join(strs, delim), true
+			}
+		}
+	case "contains":
+		if len(args) == 2 {
+			switch c := args[0].(type) {
+			case string:
+				s, ok := armString(args[1])
+				return strings.Contains(c, s), ok
+			case []interface{}:
+				for _, elem := range c {
+					if reflect.DeepEqual(elem, args[1]) {
+						return true, true
+					}
+				}
+				return false, true
+			case map[string]interface{}:
+				k, ok := args[1].(string)
+				_, found := armLookup(c, k)
+				return found, ok
+			}
+		}
+	case "length":
+		if len(args) == 1 {
+			switch v := args[0].(type) {
+			case string:
+				return float64(len(v)), true
+			case []interface{}:
+				return float64(len(v)), true
+			case map[string]interface{}:
+				return float64(len(v)), true
+			}
+		}
+	case "empty":
+		if len(args) == 1 {
+			switch v := args[0].(type) {
+			case nil:
+				return true, true
+			case string:
+				return len(v) == 0, true
+			case []interface{}:
+				return len(v) == 0, true
+			case map[string]interface{}:
+				return len(v) == 0, true
+			}
+		}
+	case "first", "last":
+		if len(args) == 1 {
+			switch v := args[0].(type) {
+			case string:
+				if len(v) == 0 {
+					return "", true
+				} else if name == "first" {
+					return v[:1], true
+				}
+				return v[len(v)-1:], true
+			case []interface{}:
+				if len(v) == 0 {
+					return nil, true
+				} else if name == "first" {
+					return v[0], true
+				}
+				return v[len(v)-1], true
+			}
+		}
+	case "take", "skip":
+		if len(args) == 2 {
+			n, ok := armInt(args[1])
+			if !ok {
+				return nil, false
+			}
+			switch v := args[0].(type) {
+			case string:
+				n = armClamp(n, len(v))
+				if name == "take" {
+					return v[:n], true
+				}
+				return v[n:], true
+			case []interface{}:
+				n = armClamp(n, len(v))
+				if name == "take" {
+					return append([]interface{}{}, v[:n]...), true
+				}
+				return append([]interface{}{}, v[n:]...), true
+			}
+		}
+	case "array":
+		if len(args) == 1 {
+			if arr, ok := args[0].([]interface{}); ok {
+				return arr, true
+			}
+			return []interface{}{args[0]}, true
+		}
+	case "createarray":
+		return append([]interface{}{}, args...), true
+	case "createobject":
+		if len(args)%2 != 0 {
+			return nil, false
+		}
+		obj := map[string]interface{}{}
+		for i := 0; i < len(args); i += 2 {
+			k, ok := args[i].(string)
+			if !ok {
+				return nil, false
+			}
+			obj[k] = args[i+1]
+		}
+		return obj, true
+	case "union":
+		if len(args) == 0 {
+			return nil, false
+		}
+		switch args[0].(type) {
+		case []interface{}:
+			arr := []interface{}{}
+			for _, arg := range args {
+				elems, ok := arg.([]interface{})
+				if !ok {
+					return nil, false
+				}
+			elems:
+				for _, elem := range elems {
+					for _, existing := range arr {
+						if reflect.DeepEqual(existing, elem) {
+							continue elems
+						}
+					}
+					arr = append(arr, elem)
+				}
+			}
+			return arr, true
+		case map[string]interface{}:
+			obj := map[string]interface{}{}
+			for _, arg := range args {
+				o, ok := arg.(map[string]interface{})
+				if !ok {
+					return nil, false
+				}
+				for k, v := range o {
+					obj[k] = v
+				}
+			}
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// parameter returns the value of a parameter, which is unknown if it has no
+// value.
+func (e *armEvaluator) parameter(name string) armResult {
+	for k := range e.parameters {
+		if strings.EqualFold(k, name) {
+			name = k
+		}
+	}
+	param := e.parameters[name]
+	value, ok := e.values[name]
+	if !ok || !value.known {
+		return armResult{refs: []string{}, sensitive: param.secure()}
+	}
+	result := armKnown(value.value)
+	if value.expression {
+		result = e.evaluate(value.value)
+	}
+	result.sensitive = result.sensitive || param.secure()
+	return result
+}
+
+func (e *armEvaluator) variable(name string) armResult {
+	if _, ok := e.variables[name]; !ok {
+		for k := range e.variables {
+			if strings.EqualFold(k, name) {
+				name = k
+			}
+		}
+	}
+	if result, ok := e.cache[name]; ok {
+		return result
+	}
+	value, ok := e.variables[name]
+	if e.evaluating[name] {
+		return armUnknown()
+	}
+	e.evaluating[name] = true
+	result := armUnknown()
+	if ok {
+		result = e.evaluate(value)
+	} else {
+		// Variables can also be defined by copy loops.
+		loops, _ := armCopyLoops(e.variables)
+		for _, loop := range loops {
+			if strings.EqualFold(loop.name, name) {
+				result = e.evaluateCopy(loop)
+			}
+		}
+	}
+	delete(e.evaluating, name)
+	e.cache[name] = result
+	return result
+}
+
+// resourceGroup returns the properties of the resource group that are known
+// from the deployment context.
+func (e *armEvaluator) resourceGroup() map[string]interface{} {
+	rg := map[string]interface{}{
+		"type": "Microsoft.Resources/resourceGroups",
+	}
+	name, ok1 := e.context["resourceGroup"]
+	sub, ok2 := e.context["subscriptionId"]
+	if ok1 {
+		rg["name"] = name
+	}
+	if ok1 && ok2 {
+		rg["id"] = "/subscriptions/" + sub + "/resourceGroups/" + name
+	}
+	if location, ok := e.context["location"]; ok {
+		rg["location"] = location
+	}
+	return rg
+}
+
+func (e *armEvaluator) subscription() map[string]interface{} {
+	sub := map[string]interface{}{}
+	if id, ok := e.context["subscriptionId"]; ok {
+		sub["id"] = "/subscriptions/" + id
+		sub["subscriptionId"] = id
+	}
+	if tenant, ok := e.context["tenantId"]; ok {
+		sub["tenantId"] = tenant
+	}
+	return sub
+}
+
+// resourceId returns the ID of a resource.  Resources in the template are
+// identified the same way as in the input, so references to them can be
+// found.  Other resources get their full Azure resource ID, if the
+// subscription and resource group are known.
+func (e *armEvaluator) resourceId(args []interface{}) (interface{}, bool) {
+	strs, ok := armStrings(args)
+	if !ok {
+		return nil, false
+	}
+	i := armTypeIndex(strs)
+	if i < 0 || i > 2 || len(strs) < i+2 {
+		return nil, false
+	}
+	id := parseArmName(strs[i], strings.Join(strs[i+1:], "/")).String()
+	if _, ok := e.resources[id]; ok {
+		return id, true
+	}
+
+	sub, ok1 := e.context["subscriptionId"]
+	rg, ok2 := e.context["resourceGroup"]
+	if i == 2 {
+		sub, ok1 = strs[0], true
+	}
+	if i >= 1 {
+		rg, ok2 = strs[i-1], true
+	}
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	return "/subscriptions/" + sub + "/resourceGroups/" + rg + armProviderPath(strs[i:]), true
+}
+
+// armTypeIndex returns the index of the resource type in the arguments of
+// resourceId() and similar functions, which may be preceded by a
+// subscription ID and resource group name.
+func armTypeIndex(args []string) int {
+	for i, arg := range args {
+		if strings.Contains(arg, "/") {
+			return i
+		}
+	}
+	return -1
+}
+
+// armProviderPath returns the provider part of a resource ID, given a
+// resource type and names.
+func armProviderPath(args []string) string {
+	name := parseArmName(args[0], strings.Join(args[1:], "/"))
+	path := "/providers/" + name.service
+	for i := 0; i < len(name.types) && i < len(name.names); i++ {
+		path = path + "/" + name.types[i] + "/" + name.names[i]
+	}
+	return path
+}
+
+// armFormat implements format(), which uses composite formatting like
+// "{0}-{1}".  Format specifiers after a colon are ignored.
+func armFormat(f string, args []interface{}) (interface{}, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(f); i++ {
+		switch {
+		case strings.HasPrefix(f[i:], "{{"):
+			sb.WriteByte('{')
+			i++
+		case strings.HasPrefix(f[i:], "}}"):
+			sb.WriteByte('}')
+			i++
+		case f[i] == '{':
+			end := strings.IndexByte(f[i:], '}')
+			if end < 0 {
+				return nil, false
+			}
+			spec := strings.SplitN(f[i+1:i+end], ":", 2)[0]
+			n, err := strconv.Atoi(strings.TrimSpace(spec))
+			if err != nil || n < 0 || n >= len(args) {
+				return nil, false
+			}
+			s, ok := armString(args[n])
+			if !ok {
+				return nil, false
+			}
+			sb.WriteString(s)
+			i += end
+		default:
+			sb.WriteByte(f[i])
+		}
+	}
+	return sb.String(), true
+}
+
+// armLookup looks up a property of an object.  Property names are
+// case-insensitive.
+func armLookup(obj map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := obj[name]; ok {
+		return v, true
+	}
+	keys := []string{}
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.EqualFold(k, name) {
+			return obj[k], true
+		}
+	}
+	return nil, false
+}
+
+func armCompare(a interface{}, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			if x < y {
+				return -1, true
+			} else if x > y {
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
+
+func armString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		if v {
+			return "True", true
+		}
+		return "False", true
+	case nil:
+		return "", true
+	default:
+		bs, err := json.Marshal(v)
+		return string(bs), err == nil
+	}
+}
+
+func armStrings(args []interface{}) ([]string, bool) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, false
+		}
+		strs[i] = s
+	}
+	return strs, true
+}
+
+func armInt(value interface{}) (int, bool) {
+	// Larger numbers can't be represented exactly, and may overflow an int.
+	if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) <= 1<<53 {
+		return int(f), true
+	}
+	return 0, false
+}
+
+func armClamp(n int, max int) int {
+	if n < 0 {
+		return 0
+	} else if n > max {
+		return max
+	}
+	return n
+}
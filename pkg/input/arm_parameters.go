@@ -0,0 +1,171 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// armSecureValue replaces the values of secure parameters in the state meta.
+const armSecureValue = "****"
+
+// armParameterValue is the value of a template parameter, together with its
+// source: "default", "allowed_values" or the path of a parameter file.
+// Default values may hold expressions, values from parameter files don't.
+// Values that reference a Key Vault secret are unknown.
+type armParameterValue struct {
+	value      interface{}
+	source     string
+	expression bool
+	known      bool
+}
+
+// armParameterFileSuffix is the naming convention for parameter files:
+// azuredeploy.json is deployed with azuredeploy.parameters.json.
+const armParameterFileSuffix = ".parameters.json"
+
+// armParameterFiles returns the parameter files that apply to a template:
+// the file named after it, if it exists, followed by the files given in the
+// options, which take precedence.
+func armParameterFiles(fs afero.Fs, templatePath string, opts DetectOptions) []string {
+	files := []string{}
+	if fs != nil && !strings.HasSuffix(templatePath, armParameterFileSuffix) {
+		path := strings.TrimSuffix(templatePath, filepath.Ext(templatePath)) + armParameterFileSuffix
+		if exists, err := afero.Exists(fs, path); err == nil && exists {
+			files = append(files, path)
+		}
+	}
+	for _, path := range templateParameterFiles(templatePath, opts.ArmParameterFiles) {
+		if len(files) == 0 || filepath.Clean(path) != filepath.Clean(files[0]) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+type armParameterFile struct {
+	Schema     string                            `json:"$schema"`
+	Parameters map[string]map[string]interface{} `json:"parameters"`
+}
+
+// loadArmParameterFile reads the parameter values in a parameter file.
+// Key Vault references are returned as unknown values.
+func loadArmParameterFile(fs afero.Fs, path string) (map[string]armParameterValue, error) {
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", UnableToReadFile, err)
+	}
+	file := armParameterFile{}
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", FailedToParseInput, path, err)
+	}
+	if file.Parameters == nil {
+		return nil, fmt.Errorf("%w: %s: missing parameters", FailedToParseInput, path)
+	}
+
+	values := map[string]armParameterValue{}
+	for k, param := range file.Parameters {
+		if value, ok := param["value"]; ok {
+			values[k] = armParameterValue{value: value, source: path, known: true}
+		} else if _, ok := param["reference"]; ok {
+			values[k] = armParameterValue{source: path}
+		}
+	}
+	return values, nil
+}
+
+// parameterValues returns the values of the template parameters, taken from
+// the parameter files that apply to the template or from the template itself.
+// Errors reading parameter files are not fatal.
+func (t *arm_Template) parameterValues(
+	fs afero.Fs,
+	templatePath string,
+	opts DetectOptions,
+) (map[string]armParameterValue, []error) {
+	values := map[string]armParameterValue{}
+	for k, param := range t.Parameters {
+		if param.DefaultValue != nil {
+			values[k] = armParameterValue{
+				value:      param.DefaultValue,
+				source:     "default",
+				expression: true,
+				known:      true,
+			}
+		} else if len(param.AllowedValues) > 0 {
+			values[k] = armParameterValue{
+				value:  param.AllowedValues[0],
+				source: "allowed_values",
+				known:  true,
+			}
+		}
+	}
+
+	errors := []error{}
+	for _, path := range armParameterFiles(fs, templatePath, opts) {
+		overrides, err := loadArmParameterFile(fs, path)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		for k, value := range overrides {
+			// Parameters that the template doesn't declare are ignored, so
+			// that a file can be shared between templates.
+			if name, ok := t.parameterName(k); ok {
+				values[name] = value
+			}
+		}
+	}
+	return values, errors
+}
+
+// parameterName returns the declared name of a parameter.  Parameter names
+// are case-insensitive.
+func (t *arm_Template) parameterName(name string) (string, bool) {
+	if _, ok := t.Parameters[name]; ok {
+		return name, true
+	}
+	for k := range t.Parameters {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// parametersMeta describes the parameter values in the state meta.  Values of
+// secure parameters are masked.
+func (e *armEvaluator) parametersMeta() map[string]interface{} {
+	meta := map[string]interface{}{}
+	for k, v := range e.values {
+		var value interface{}
+		if e.parameters[k].secure() {
+			value = armSecureValue
+		} else if r := e.parameter(k); r.known {
+			value = r.value
+		} else if v.known {
+			value = v.value
+		}
+		meta[k] = map[string]interface{}{
+			"value":  value,
+			"source": v.source,
+		}
+	}
+	return meta
+}
@@ -0,0 +1,298 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input_test
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/snyk/policy-engine/pkg/input"
+)
+
+func TestArmDetectorContext(t *testing.T) {
+	detector := &input.ArmDetector{}
+	f := makeMockFile("template.json", []byte(`{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "contentVersion": "1.0.0.0",
+  "resources": [
+    {
+      "type": "Microsoft.Web/sites",
+      "name": "[concat('site-', deployment().name)]",
+      "location": "[resourceGroup().location]",
+      "properties": {
+        "serverFarmId": "[resourceId('Microsoft.Web/serverfarms', 'shared')]",
+        "otherFarmId": "[resourceId('other-rg', 'Microsoft.Web/serverfarms', 'shared')]",
+        "subscription": "[subscription().subscriptionId]",
+        "tenant": "[subscription().tenantId]",
+        "message": "[format('It''s {0} in {1}', 'sunny', resourceGroup().name)]"
+      }
+    }
+  ]
+}`))
+	arm, err := detector.DetectFile(f, input.DetectOptions{
+		ArmContext: map[string]string{
+			"subscriptionId": "00000000-0000-0000-0000-000000000000",
+			"tenantId":       "11111111-1111-1111-1111-111111111111",
+			"resourceGroup":  "rg",
+			"location":       "westeurope",
+			"deploymentName": "main",
+		},
+	})
+	require.NoError(t, err)
+
+	site, ok := arm.ToState().Resources["Microsoft.Web/sites"]["Microsoft.Web/sites/site-main"]
+	require.True(t, ok)
+	assert.Equal(t, "westeurope", site.Attributes["location"])
+	assert.Equal(t, map[string]interface{}{
+		"serverFarmId": "/subscriptions/00000000-0000-0000-0000-000000000000" +
+			"/resourceGroups/rg/providers/Microsoft.Web/serverfarms/shared",
+		"otherFarmId": "/subscriptions/00000000-0000-0000-0000-000000000000" +
+			"/resourceGroups/other-rg/providers/Microsoft.Web/serverfarms/shared",
+		"subscription": "00000000-0000-0000-0000-000000000000",
+		"tenant":       "11111111-1111-1111-1111-111111111111",
+		"message":      "It's sunny in rg",
+	}, site.Attributes["properties"])
+}
+
+func TestArmDetectorFunctionLimits(t *testing.T) {
+	detector := &input.ArmDetector{}
+	f := makeMockFile("template.json", []byte(`{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "contentVersion": "1.0.0.0",
+  "resources": [
+    {
+      "type": "Microsoft.Storage/storageAccounts",
+      "name": "storage",
+      "properties": {
+        "range": "[range(1, 3)]",
+        "largeRange": "[range(0, 10001)]",
+        "hugeRange": "[range(0, 1000000000000000000000)]",
+        "negativeRange": "[range(0, -1)]",
+        "padded": "[padLeft('7', 3, '0')]",
+        "widePadded": "[padLeft('7', 100000000, '0')]"
+      }
+    }
+  ]
+}`))
+	arm, err := detector.DetectFile(f, input.DetectOptions{})
+	require.NoError(t, err)
+
+	storage := arm.ToState().Resources["Microsoft.Storage/storageAccounts"]["Microsoft.Storage/storageAccounts/storage"]
+	assert.Equal(t, map[string]interface{}{
+		"range":         []interface{}{1.0, 2.0, 3.0},
+		"largeRange":    "[range(0, 10001)]",
+		"hugeRange":     "[range(0, 1000000000000000000000)]",
+		"negativeRange": "[range(0, -1)]",
+		"padded":        "007",
+		"widePadded":    "[padLeft('7', 100000000, '0')]",
+	}, storage.Attributes["properties"])
+}
+
+func TestArmDetectorSecureTags(t *testing.T) {
+	detector := &input.ArmDetector{}
+	f := makeMockFile("template.json", []byte(`{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "contentVersion": "1.0.0.0",
+  "parameters": {
+    "secret": {"type": "securestring", "defaultValue": "hunter2"},
+    "secretTags": {"type": "secureObject", "defaultValue": {"token": "hunter2"}},
+    "env": {"type": "string", "defaultValue": "dev"}
+  },
+  "resources": [
+    {
+      "type": "Microsoft.Storage/storageAccounts",
+      "name": "storage",
+      "tags": {
+        "token": "[parameters('secret')]",
+        "connection": "[concat('user:', parameters('secret'))]",
+        "env": "[parameters('env')]"
+      },
+      "properties": {
+        "token": "[parameters('secret')]"
+      }
+    },
+    {
+      "type": "Microsoft.Network/virtualNetworks",
+      "name": "vnet",
+      "tags": "[parameters('secretTags')]"
+    }
+  ]
+}`))
+	arm, err := detector.DetectFile(f, input.DetectOptions{})
+	require.NoError(t, err)
+
+	state := arm.ToState()
+	storage := state.Resources["Microsoft.Storage/storageAccounts"]["Microsoft.Storage/storageAccounts/storage"]
+	assert.Equal(t, map[string]string{"env": "dev"}, storage.Tags)
+	assert.Equal(t, []interface{}{
+		[]interface{}{"properties", "token"},
+	}, storage.Meta["sensitive_attributes"])
+	vnet := state.Resources["Microsoft.Network/virtualNetworks"]["Microsoft.Network/virtualNetworks/vnet"]
+	assert.Empty(t, vnet.Tags)
+}
+
+func TestArmDetectorCopyLimits(t *testing.T) {
+	detector := &input.ArmDetector{}
+	f := makeMockFile("template.json", []byte(`{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "contentVersion": "1.0.0.0",
+  "resources": [
+    {
+      "type": "Microsoft.Storage/storageAccounts",
+      "name": "[concat('storage', copyIndex())]",
+      "copy": {"name": "storageLoop", "count": 801}
+    },
+    {
+      "type": "Microsoft.Network/virtualNetworks",
+      "name": "[concat('vnet', copyIndex())]",
+      "copy": {"name": "vnetLoop", "count": -1}
+    },
+    {
+      "type": "Microsoft.Compute/virtualMachines",
+      "name": "vm",
+      "properties": {
+        "storageProfile": {
+          "copy": [
+            {"name": "dataDisks", "count": 1000000000, "input": {"lun": "[copyIndex('dataDisks')]"}},
+            {"name": "osDisks", "count": 2, "input": "[copyIndex('osDisks')]"}
+          ]
+        }
+      }
+    }
+  ]
+}`))
+	arm, err := detector.DetectFile(f, input.DetectOptions{})
+	require.NoError(t, err)
+	assert.Len(t, arm.Errors(), 3)
+	for _, err := range arm.Errors() {
+		assert.ErrorIs(t, err, input.InvalidInput)
+	}
+
+	// Loops with an invalid count are left unexpanded.
+	state := arm.ToState()
+	assert.Len(t, state.Resources["Microsoft.Storage/storageAccounts"], 1)
+	assert.Len(t, state.Resources["Microsoft.Network/virtualNetworks"], 1)
+	vm := state.Resources["Microsoft.Compute/virtualMachines"]["Microsoft.Compute/virtualMachines/vm"]
+	assert.Equal(t, map[string]interface{}{
+		"storageProfile": map[string]interface{}{
+			"copy": []interface{}{
+				map[string]interface{}{
+					"name":  "dataDisks",
+					"count": 1000000000.0,
+					"input": map[string]interface{}{"lun": "[copyIndex('dataDisks')]"},
+				},
+			},
+			"osDisks": []interface{}{0.0, 1.0},
+		},
+	}, vm.Attributes["properties"])
+	assert.Len(t, arm.Errors(), 3)
+}
+
+func TestArmDetectorParameterFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "azuredeploy.json", []byte(`{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+  "contentVersion": "1.0.0.0",
+  "parameters": {
+    "sku": {"type": "string", "defaultValue": "Standard_LRS"},
+    "httpsOnly": {"type": "bool", "defaultValue": false},
+    "tier": {"type": "string", "defaultValue": "Hot"},
+    "password": {"type": "securestring"}
+  },
+  "resources": [
+    {
+      "type": "Microsoft.Storage/storageAccounts",
+      "name": "storage",
+      "sku": {"name": "[parameters('sku')]"},
+      "properties": {
+        "supportsHttpsTrafficOnly": "[parameters('httpsOnly')]",
+        "accessTier": "[parameters('tier')]",
+        "password": "[parameters('password')]"
+      }
+    }
+  ]
+}`), 0644)
+	afero.WriteFile(fs, "azuredeploy.parameters.json", []byte(`{
+  "$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentParameters.json#",
+  "contentVersion": "1.0.0.0",
+  "parameters": {
+    "sku": {"value": "Standard_GRS"},
+    "httpsOnly": {"value": false},
+    "password": {
+      "reference": {
+        "keyVault": {"id": "/subscriptions/0/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"},
+        "secretName": "password"
+      }
+    }
+  }
+}`), 0644)
+	afero.WriteFile(fs, "prod.parameters.json", []byte(`{
+  "parameters": {
+    "httpsOnly": {"value": true},
+    "undeclared": {"value": 1}
+  }
+}`), 0644)
+	afero.WriteFile(fs, "other.parameters.json", []byte(`{
+  "parameters": {
+    "tier": {"value": "Cool"}
+  }
+}`), 0644)
+
+	detector := &input.ArmDetector{}
+	arm, err := detector.DetectFile(&input.File{Path: "azuredeploy.json", Fs: fs}, input.DetectOptions{
+		ArmParameterFiles: []string{
+			"prod.parameters.json",
+			"other.json=other.parameters.json",
+			"missing.parameters.json",
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, arm.Errors(), 1)
+
+	state := arm.ToState()
+	storage := state.Resources["Microsoft.Storage/storageAccounts"]["Microsoft.Storage/storageAccounts/storage"]
+	assert.Equal(t, map[string]interface{}{"name": "Standard_GRS"}, storage.Attributes["sku"])
+	assert.Equal(t, map[string]interface{}{
+		"supportsHttpsTrafficOnly": true,
+		"accessTier":               "Hot",
+		"password":                 "[parameters('password')]",
+	}, storage.Attributes["properties"])
+	assert.Equal(t, []interface{}{
+		[]interface{}{"properties", "password"},
+	}, storage.Meta["sensitive_attributes"])
+	assert.Equal(t, map[string]interface{}{
+		"parameters": map[string]interface{}{
+			"sku": map[string]interface{}{
+				"value":  "Standard_GRS",
+				"source": "azuredeploy.parameters.json",
+			},
+			"httpsOnly": map[string]interface{}{
+				"value":  true,
+				"source": "prod.parameters.json",
+			},
+			"tier": map[string]interface{}{
+				"value":  "Hot",
+				"source": "default",
+			},
+			"password": map[string]interface{}{
+				"value":  "****",
+				"source": "azuredeploy.parameters.json",
+			},
+		},
+	}, state.Meta["arm"])
+}
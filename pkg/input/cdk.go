@@ -0,0 +1,352 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/snyk/policy-engine/pkg/models"
+)
+
+const cdkManifestFilename = "manifest.json"
+
+// CdkDetector loads AWS CDK cloud assemblies, the cdk.out directories that
+// `cdk synth` produces.  Every stack template in the assembly is loaded like a
+// regular CloudFormation template, but resources are identified by their
+// construct path rather than their generated logical ID, and their source
+// locations include the construct's entry in the assembly manifest.
+type CdkDetector struct{}
+
+func (c *CdkDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration, error) {
+	if filepath.Base(i.Path) != cdkManifestFilename {
+		return nil, fmt.Errorf("%w: %v", UnrecognizedFileExtension, i.Ext())
+	}
+	return c.detect(i.Fs, filepath.Dir(i.Path), opts)
+}
+
+func (c *CdkDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConfiguration, error) {
+	path := filepath.Join(i.Path, cdkManifestFilename)
+	if exists, err := afero.Exists(i.Fs, path); err != nil || !exists {
+		return nil, nil
+	}
+	return c.detect(i.Fs, i.Path, opts)
+}
+
+func (c *CdkDetector) detect(fs afero.Fs, dir string, opts DetectOptions) (IACConfiguration, error) {
+	configuration := &cdkConfiguration{
+		path:    dir,
+		errors:  []error{},
+		visited: map[string]struct{}{},
+	}
+	// The stacks in an assembly import each other's exports.
+	opts.cfnExports = newCfnExportsCache()
+	ok, err := configuration.loadAssembly(fs, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Other manifest.json files are not cloud assemblies.
+	if !ok || len(configuration.stacks) == 0 {
+		return nil, nil
+	}
+	return configuration, nil
+}
+
+type cdkManifest struct {
+	Version   string                 `json:"version"`
+	Artifacts map[string]cdkArtifact `json:"artifacts"`
+}
+
+type cdkArtifact struct {
+	Type        string                `json:"type"`
+	Environment string                `json:"environment"`
+	DisplayName string                `json:"displayName"`
+	Properties  cdkArtifactProperties `json:"properties"`
+}
+
+type cdkArtifactProperties struct {
+	// Set for stacks.
+	TemplateFile string                 `json:"templateFile"`
+	Parameters   map[string]interface{} `json:"parameters"`
+
+	// Set for nested assemblies, such as CDK stages.
+	DirectoryName string `json:"directoryName"`
+}
+
+type cdkStack struct {
+	artifactId    string
+	artifact      cdkArtifact
+	manifestPath  string
+	manifest      *SourceInfoNode
+	configuration *cfnConfiguration
+}
+
+type cdkConfiguration struct {
+	path      string
+	manifests []string
+	stacks    []cdkStack
+
+	// visited holds the cleaned paths of the manifests that were loaded, so
+	// that assemblies that refer to themselves are loaded once.
+	visited map[string]struct{}
+	errors  []error
+}
+
+// loadAssembly loads the stacks in the assembly in the given directory, and
+// in any nested assemblies.  It returns false if the directory does not hold
+// a cloud assembly.
+func (l *cdkConfiguration) loadAssembly(fs afero.Fs, dir string, opts DetectOptions) (bool, error) {
+	manifestPath := filepath.Clean(filepath.Join(dir, cdkManifestFilename))
+	if _, ok := l.visited[manifestPath]; ok {
+		return true, nil
+	}
+	l.visited[manifestPath] = struct{}{}
+	contents, err := afero.ReadFile(fs, manifestPath)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", UnableToReadFile, err)
+	}
+	manifest := cdkManifest{}
+	if err := json.Unmarshal(contents, &manifest); err != nil || manifest.Version == "" || manifest.Artifacts == nil {
+		return false, nil
+	}
+	l.manifests = append(l.manifests, manifestPath)
+
+	// Don't consider source code locations essential.
+	source, _ := LoadSourceInfoNode(contents)
+
+	ids := []string{}
+	for id := range manifest.Artifacts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		artifact := manifest.Artifacts[id]
+		switch artifact.Type {
+		case "aws:cloudformation:stack":
+			stack, err := loadCdkStack(fs, dir, id, artifact, opts)
+			if err != nil {
+				l.errors = append(l.errors, fmt.Errorf("%w (stack %s)", err, id))
+				continue
+			}
+			stack.manifestPath = manifestPath
+			stack.manifest = source
+			l.stacks = append(l.stacks, stack)
+		case "cdk:cloud-assembly":
+			if artifact.Properties.DirectoryName == "" {
+				l.errors = append(l.errors, fmt.Errorf(
+					"%w: nested assembly %s has no directoryName",
+					InvalidInput,
+					id,
+				))
+				continue
+			}
+			nested := filepath.Join(dir, artifact.Properties.DirectoryName)
+			if _, err := l.loadAssembly(fs, nested, opts); err != nil {
+				l.errors = append(l.errors, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+func loadCdkStack(
+	fs afero.Fs,
+	dir string,
+	artifactId string,
+	artifact cdkArtifact,
+	opts DetectOptions,
+) (cdkStack, error) {
+	path := filepath.Join(dir, artifact.Properties.TemplateFile)
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return cdkStack{}, fmt.Errorf("%w: %v", UnableToReadFile, err)
+	}
+
+	// The account and region of the stack, if they are known when the app is
+	// synthesized.  Pseudo parameters set in the options take precedence.
+	pseudoParameters := map[string]string{}
+	if env := strings.TrimPrefix(artifact.Environment, "aws://"); env != artifact.Environment {
+		parts := strings.SplitN(env, "/", 2)
+		if len(parts) == 2 {
+			if parts[0] != "unknown-account" {
+				pseudoParameters["AWS::AccountId"] = parts[0]
+			}
+			if parts[1] != "unknown-region" {
+				pseudoParameters["AWS::Region"] = parts[1]
+			}
+		}
+	}
+	for k, v := range opts.CfnPseudoParameters {
+		pseudoParameters[k] = v
+	}
+	opts.CfnPseudoParameters = pseudoParameters
+
+	// The CDK uses exports for references between stacks.
+	opts.CfnCrossStack = true
+
+	parameters := map[string]cfnParameterValue{}
+	for k, v := range artifact.Properties.Parameters {
+		parameters[k] = cfnParameterValue{v, cdkManifestFilename}
+	}
+
+	configuration, err := loadCfnConfiguration(fs, path, contents, opts, &cfnStackContext{
+		parameters: parameters,
+		cdkPaths:   true,
+	})
+	if err != nil {
+		return cdkStack{}, err
+	}
+	return cdkStack{
+		artifactId:    artifactId,
+		artifact:      artifact,
+		configuration: configuration,
+	}, nil
+}
+
+// cdkPath returns the construct path of a resource, as recorded in its
+// metadata by the CDK.
+func cdkPath(resource cfnResource) (string, bool) {
+	metadata, ok := resource.Metadata.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	path, ok := metadata["aws:cdk:path"].(string)
+	return path, ok && path != ""
+}
+
+// cdkConstructId converts the construct path of a resource to an ID for the
+// resource.  The stack name is left out, as well as the "Resource" construct
+// that L2 constructs use for their underlying CloudFormation resource:
+// "MyStack/Bucket/Resource" becomes "Bucket".
+func cdkConstructId(resource cfnResource) (string, bool) {
+	path, ok := cdkPath(resource)
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(path, "/")[1:]
+	if len(parts) > 1 && parts[len(parts)-1] == "Resource" {
+		parts = parts[:len(parts)-1]
+	}
+	id := strings.Join(parts, "/")
+	return id, id != ""
+}
+
+// cdkResourceMeta returns the CDK metadata of a resource: its construct path
+// and the path of its asset, if any.
+func cdkResourceMeta(resource cfnResource) map[string]interface{} {
+	meta := map[string]interface{}{}
+	if path, ok := cdkPath(resource); ok {
+		meta["path"] = path
+	}
+	if metadata, ok := resource.Metadata.(map[string]interface{}); ok {
+		if asset, ok := metadata["aws:asset:path"]; ok {
+			meta["asset_path"] = asset
+		}
+	}
+	return meta
+}
+
+func (l *cdkConfiguration) ToState() models.State {
+	return l.ToStates()[0]
+}
+
+func (l *cdkConfiguration) ToStates() []models.State {
+	states := []models.State{}
+	for _, stack := range l.stacks {
+		state := stack.configuration.ToState()
+		cdk := map[string]interface{}{
+			"manifest": stack.manifestPath,
+			"stack":    stack.artifactId,
+		}
+		if stack.artifact.DisplayName != "" {
+			cdk["display_name"] = stack.artifact.DisplayName
+		}
+		if stack.artifact.Environment != "" {
+			cdk["environment"] = stack.artifact.Environment
+		}
+		state.Meta["cdk"] = cdk
+		states = append(states, state)
+	}
+	return states
+}
+
+func (l *cdkConfiguration) Location(path []interface{}) (LocationStack, error) {
+	// Format is {resourceNamespace, resourceType, resourceId, attributePath...}
+	// The namespace is the path of the stack template.
+	if len(path) < 3 {
+		return nil, nil
+	}
+	namespace, ok1 := path[0].(string)
+	resourceId, ok2 := path[2].(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf(
+			"%w: Expected string resource namespace and ID in path: %v",
+			UnableToResolveLocation,
+			path,
+		)
+	}
+
+	for _, stack := range l.stacks {
+		if stack.configuration.path != namespace {
+			continue
+		}
+		locs, err := stack.configuration.Location(path)
+
+		// Add the construct's entry in the manifest.
+		if resource, ok := stack.configuration.lookup(resourceId); ok && stack.manifest != nil {
+			if constructPath, ok := cdkPath(resource); ok {
+				node, err := stack.manifest.GetPath([]interface{}{
+					"artifacts", stack.artifactId, "metadata", "/" + constructPath,
+				})
+				if err == nil {
+					line, column := node.Location()
+					locs = append(locs, Location{Path: stack.manifestPath, Line: line, Col: column})
+				}
+			}
+		}
+		return locs, err
+	}
+
+	return nil, fmt.Errorf(
+		"%w: Unable to find stack with template: %s",
+		UnableToResolveLocation,
+		namespace,
+	)
+}
+
+func (l *cdkConfiguration) LoadedFiles() []string {
+	files := append([]string{}, l.manifests...)
+	for _, stack := range l.stacks {
+		files = append(files, stack.configuration.LoadedFiles()...)
+	}
+	return files
+}
+
+func (l *cdkConfiguration) Errors() []error {
+	errors := append([]error{}, l.errors...)
+	for _, stack := range l.stacks {
+		errors = append(errors, stack.configuration.Errors()...)
+	}
+	return errors
+}
+
+func (l *cdkConfiguration) Type() *Type {
+	return Cdk
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/snyk/policy-engine/pkg/input"
+)
+
+func TestCdkDetectorNestedAssemblyCycles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cdk.out/manifest.json", []byte(`{
+  "version": "21.0.0",
+  "artifacts": {
+    "Self": {
+      "type": "cdk:cloud-assembly",
+      "properties": {"directoryName": "."}
+    },
+    "Empty": {
+      "type": "cdk:cloud-assembly",
+      "properties": {}
+    },
+    "AppStack": {
+      "type": "aws:cloudformation:stack",
+      "environment": "aws://unknown-account/unknown-region",
+      "properties": {"templateFile": "AppStack.template.json"}
+    }
+  }
+}`), 0644)
+	afero.WriteFile(fs, "cdk.out/AppStack.template.json", []byte(`{
+  "Resources": {
+    "Bucket": {"Type": "AWS::S3::Bucket"}
+  }
+}`), 0644)
+
+	detector := &input.CdkDetector{}
+	cdk, err := detector.DetectDirectory(&input.Directory{Path: "cdk.out", Fs: fs}, input.DetectOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, cdk)
+
+	assert.Equal(t, []string{"cdk.out/manifest.json", "cdk.out/AppStack.template.json"}, cdk.LoadedFiles())
+	require.Len(t, cdk.Errors(), 1)
+	assert.True(t, errors.Is(cdk.Errors()[0], input.InvalidInput))
+	assert.Len(t, cdk.ToState().Resources["AWS::S3::Bucket"], 1)
+}
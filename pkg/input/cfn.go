@@ -18,11 +18,13 @@ package input
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/snyk/policy-engine/pkg/cfn/schemas"
 	"github.com/snyk/policy-engine/pkg/interfacetricks"
 	"github.com/snyk/policy-engine/pkg/models"
+	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
 
@@ -32,7 +34,9 @@ var validCfnExts map[string]bool = map[string]bool{
 	".json": true,
 }
 
-type CfnDetector struct{}
+type CfnDetector struct {
+	exports *cfnExportsCache
+}
 
 func (c *CfnDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration, error) {
 	if !opts.IgnoreExt && !validCfnExts[i.Ext()] {
@@ -42,7 +46,24 @@ func (c *CfnDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration,
 	if err != nil {
 		return nil, err
 	}
+	if opts.CfnCrossStack {
+		if c.exports == nil {
+			c.exports = newCfnExportsCache()
+		}
+		opts.cfnExports = c.exports
+	}
+	return loadCfnConfiguration(i.Fs, i.Path, contents, opts, nil)
+}
 
+// loadCfnConfiguration loads a template and its nested stacks.  context is nil
+// for templates that are loaded on their own.
+func loadCfnConfiguration(
+	fs afero.Fs,
+	path string,
+	contents []byte,
+	opts DetectOptions,
+	context *cfnStackContext,
+) (*cfnConfiguration, error) {
 	template := &cfnTemplate{}
 	if err := yaml.Unmarshal(contents, &template); err != nil || template == nil {
 		return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
@@ -52,17 +73,33 @@ func (c *CfnDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration,
 		return nil, fmt.Errorf("%w", InvalidInput)
 	}
 
-	path := i.Path
 	source, err := LoadSourceInfoNode(contents)
 	if err != nil {
 		source = nil // Don't consider source code locations essential.
 	}
 
+	if template.hasSamTransform() {
+		template.expandSam()
+	}
+
+	parameters, errors := template.parameterValues(fs, path, opts, context.parameterOverrides())
+	resolver := template.resolver(opts, parameters, context)
+	if opts.CfnCrossStack {
+		resolver.imports = cfnExports(fs, path, opts, context)
+	}
+	conditions := newCfnConditions(resolver, template.Conditions)
+	children, childErrors := template.nestedStacks(fs, path, opts, resolver, conditions, context)
 	return &cfnConfiguration{
-		path:      path,
-		template:  *template,
-		source:    source,
-		resources: template.resources(),
+		path:       path,
+		template:   *template,
+		source:     source,
+		ids:        resolver.ids,
+		resources:  template.resources(resolver, conditions),
+		relations:  template.relations(resolver.ids, conditions),
+		children:   children,
+		conditions: conditions.meta(),
+		parameters: template.parametersMeta(parameters),
+		errors:     append(errors, childErrors...),
 	}, nil
 }
 
@@ -73,17 +110,56 @@ func (c *CfnDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConf
 type cfnTemplate struct {
 	AWSTemplateFormatVersion interface{}             `yaml:"AWSTemplateFormatVersion"`
 	Parameters               map[string]cfnParameter `yaml:"Parameters"`
+	Mappings                 map[string]cfnMap       `yaml:"Mappings"`
+	Conditions               map[string]cfnValue     `yaml:"Conditions"`
+	Transform                interface{}             `yaml:"Transform"`
+	Globals                  map[string]cfnMap       `yaml:"Globals"`
 	Resources                map[string]cfnResource  `yaml:"Resources"`
+	Outputs                  map[string]cfnMap       `yaml:"Outputs"`
 }
 
 type cfnParameter struct {
+	Type          string        `yaml:"Type"`
 	Default       interface{}   `yaml:"Default"`
 	AllowedValues []interface{} `yaml:"AllowedValues"`
+	NoEcho        interface{}   `yaml:"NoEcho"`
+}
+
+// noEcho checks if the parameter value should be masked.  CloudFormation
+// accepts both booleans and strings here.
+func (param *cfnParameter) noEcho() bool {
+	switch v := param.NoEcho.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// value converts a parameter value to a list for list parameters, which are
+// given as comma-separated strings.
+func (param *cfnParameter) value(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok || !(param.Type == "CommaDelimitedList" || strings.HasPrefix(param.Type, "List<")) {
+		return value
+	}
+	list := []interface{}{}
+	for _, item := range strings.Split(str, ",") {
+		list = append(list, strings.TrimSpace(item))
+	}
+	return list
 }
 
 type cfnResource struct {
-	Type       string `yaml:"Type"`
-	Properties cfnMap `yaml:"Properties"`
+	Type       string      `yaml:"Type"`
+	Condition  string      `yaml:"Condition"`
+	Properties cfnMap      `yaml:"Properties"`
+	DependsOn  interface{} `yaml:"DependsOn"`
+	Metadata   interface{} `yaml:"Metadata"`
+
+	// Set for resources generated from SAM resources.
+	sam *cfnSamOrigin
 }
 
 // This is a type that has a custom UnmarshalYAML that we use to do some
@@ -101,59 +177,241 @@ func (t *cfnMap) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
-func (tmpl *cfnTemplate) resources() map[string]models.ResourceState {
-	parameters := map[string]interface{}{}
-	for k, param := range tmpl.Parameters {
-		if param.Default != nil {
-			parameters[k] = param.Default
-		} else if len(param.AllowedValues) > 0 {
-			parameters[k] = param.AllowedValues[0]
-		}
+// Like cfnMap, but for values that need not be maps, such as conditions.
+type cfnValue struct {
+	Contents interface{}
+}
+
+func (t *cfnValue) UnmarshalYAML(node *yaml.Node) error {
+	contents, err := decodeNode(node)
+	if err != nil {
+		return err
 	}
+	t.Contents = contents
+	return nil
+}
 
-	resolver := cfnReferenceResolver{
+func (tmpl *cfnTemplate) resolver(
+	opts DetectOptions,
+	values map[string]cfnParameterValue,
+	context *cfnStackContext,
+) *cfnReferenceResolver {
+	parameters := cfnPseudoParameterDefaults(opts.CfnPseudoParameters["AWS::Region"])
+	for k, v := range opts.CfnPseudoParameters {
+		parameters[k] = v
+	}
+	for k, v := range values {
+		parameters[k] = v.value
+	}
+	return &cfnReferenceResolver{
 		parameters: parameters,
+		mappings:   tmpl.Mappings,
+		ids:        tmpl.resourceIds(context),
 	}
+}
 
+// included checks if a resource is created.  Resources with an unknown
+// condition are included.
+func (tmpl *cfnTemplate) included(resource cfnResource, conditions *cfnConditions) bool {
+	if resource.Condition == "" {
+		return true
+	}
+	value, known := conditions.evaluate(resource.Condition)
+	return value || !known
+}
+
+func (tmpl *cfnTemplate) resources(
+	resolver *cfnReferenceResolver,
+	conditions *cfnConditions,
+) map[string]models.ResourceState {
 	resources := map[string]models.ResourceState{}
-	for resourceId, resource := range tmpl.Resources {
+	for logicalId, resource := range tmpl.Resources {
+		if !tmpl.included(resource, conditions) {
+			continue
+		}
+		resourceId := resolver.ids[logicalId]
+
 		schema := schemas.GetSchema(resource.Type)
-		properties := schemas.CoerceObject(resource.Properties.Contents, schema)
-		for k, prop := range properties {
-			properties[k] = interfacetricks.TopDownWalk(&resolver, prop)
+		contents := conditions.resolveProperties(resource.Properties.Contents)
+		coerced := schemas.CoerceObject(contents, schema)
+		properties := map[string]interface{}{}
+		for k, prop := range coerced {
+			properties[k] = interfacetricks.TopDownWalk(resolver, interfacetricks.Copy(prop))
 		}
 
-		resources[resourceId] = models.ResourceState{
+		meta := map[string]interface{}{}
+		if sensitive := tmpl.sensitiveAttributes(contents); len(sensitive) > 0 {
+			meta["sensitive_attributes"] = sensitive
+		}
+		cfn := map[string]interface{}{}
+		if resource.Condition != "" {
+			cfn["condition"] = resource.Condition
+			cfn["condition_value"] = nil
+			if value, known := conditions.evaluate(resource.Condition); known {
+				cfn["condition_value"] = value
+			}
+		}
+		if resource.sam != nil {
+			cfn["sam"] = map[string]interface{}{
+				"logical_id":    resource.sam.logicalId,
+				"resource_type": resource.sam.resourceType,
+			}
+		}
+		if resourceId != logicalId {
+			cfn["logical_id"] = logicalId
+		}
+		if imports := resolver.importsMeta(contents); len(imports) > 0 {
+			cfn["imports"] = imports
+		}
+		if len(cfn) > 0 {
+			meta["cfn"] = cfn
+		}
+		if cdk := cdkResourceMeta(resource); len(cdk) > 0 {
+			meta["cdk"] = cdk
+		}
+
+		state := models.ResourceState{
 			Id:           resourceId,
 			ResourceType: resource.Type,
 			Attributes:   properties,
-			Meta:         map[string]interface{}{},
+			Meta:         meta,
+		}
+		if tags := cfnTags(tmpl, resolver, resource.Type, schema, coerced); len(tags) > 0 {
+			state.Tags = tags
 		}
+		resources[resourceId] = state
 	}
 	return resources
 }
 
+// Finds the paths of properties that use the value of a NoEcho parameter.
+func (tmpl *cfnTemplate) sensitiveAttributes(properties map[string]interface{}) []interface{} {
+	resolver := cfnReferenceResolver{}
+	sensitive := []interface{}{}
+	seen := map[string]struct{}{}
+	visit := func(path []interface{}, logicalId string) {
+		param, ok := tmpl.Parameters[logicalId]
+		if !ok || !param.noEcho() {
+			return
+		}
+		key := fmt.Sprint(path)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			attribute := make([]interface{}, len(path))
+			copy(attribute, path)
+			sensitive = append(sensitive, attribute)
+		}
+	}
+	keys := []string{}
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		resolver.findReferences([]interface{}{k}, properties[k], visit)
+	}
+	return sensitive
+}
+
+// Checks if a value uses the value of a NoEcho parameter.
+func (tmpl *cfnTemplate) usesNoEcho(value interface{}) bool {
+	resolver := cfnReferenceResolver{}
+	found := false
+	resolver.findReferences(nil, value, func(_ []interface{}, logicalId string) {
+		if param, ok := tmpl.Parameters[logicalId]; ok && param.noEcho() {
+			found = true
+		}
+	})
+	return found
+}
+
+// Finds references between resources in the template: Ref and Fn::GetAtt
+// intrinsics, variables in Fn::Sub templates, and DependsOn.  Only the
+// chosen branches of Fn::If calls are considered.  ids maps logical IDs to
+// the IDs of the resources in the state.
+func (tmpl *cfnTemplate) relations(ids map[string]string, conditions *cfnConditions) []relation {
+	resolver := cfnReferenceResolver{}
+	relations := []relation{}
+	for resourceId, resource := range tmpl.Resources {
+		if !tmpl.included(resource, conditions) {
+			continue
+		}
+		visit := func(path []interface{}, logicalId string) {
+			if _, ok := tmpl.Resources[logicalId]; ok {
+				attribute := make([]interface{}, len(path))
+				copy(attribute, path)
+				relations = append(relations, relation{ids[resourceId], ids[logicalId], attribute})
+			}
+		}
+		for k, prop := range conditions.resolveProperties(resource.Properties.Contents) {
+			resolver.findReferences([]interface{}{k}, prop, visit)
+		}
+
+		switch dependsOn := resource.DependsOn.(type) {
+		case string:
+			visit([]interface{}{"DependsOn"}, dependsOn)
+		case []interface{}:
+			for _, dependency := range dependsOn {
+				if str, ok := dependency.(string); ok {
+					visit([]interface{}{"DependsOn"}, str)
+				}
+			}
+		}
+	}
+	return relations
+}
+
 type cfnConfiguration struct {
 	path      string
 	template  cfnTemplate
 	source    *SourceInfoNode
 	resources map[string]models.ResourceState
+	relations []relation
+
+	// IDs of the resources in the state, by logical ID.
+	ids map[string]string
+
+	// Nested stacks with local templates, by logical ID.
+	children map[string]*cfnConfiguration
+
+	// conditions holds the values of the template conditions, and
+	// parameters the values of the parameters and their sources.
+	conditions map[string]interface{}
+	parameters map[string]interface{}
+	errors     []error
 }
 
 func (l *cfnConfiguration) ToState() models.State {
-	resources := []models.ResourceState{}
-	for _, resource := range l.resources {
-		resource.Namespace = l.path
-		resources = append(resources, resource)
+	resources, relations := l.nestedResources()
+	for i := range resources {
+		resources[i].Namespace = l.path
+	}
+
+	grouped := groupResourcesByType(resources)
+	meta := map[string]interface{}{
+		"filepath": l.path,
+	}
+	if edges := relationsMeta(grouped, relations); len(edges) > 0 {
+		meta["relations"] = edges
+	}
+	cfn := map[string]interface{}{}
+	if len(l.conditions) > 0 {
+		cfn["conditions"] = l.conditions
+	}
+	if len(l.parameters) > 0 {
+		cfn["parameters"] = l.parameters
+	}
+	if len(cfn) > 0 {
+		meta["cfn"] = cfn
 	}
 
 	return models.State{
+		Format:              stateFormat,
+		FormatVersion:       stateFormatVersion,
 		InputType:           CloudFormation.Name,
 		EnvironmentProvider: "iac",
-		Meta: map[string]interface{}{
-			"filepath": l.path,
-		},
-		Resources: groupResourcesByType(resources),
+		Meta:                meta,
+		Resources:           grouped,
 		Scope: map[string]interface{}{
 			"filepath": l.path,
 		},
@@ -162,7 +420,7 @@ func (l *cfnConfiguration) ToState() models.State {
 
 func (l *cfnConfiguration) Location(path []interface{}) (LocationStack, error) {
 	// Format is {resourceNamespace, resourceType, resourceId, attributePath...}
-	if l.source == nil || len(path) < 3 {
+	if len(path) < 3 {
 		return nil, nil
 	}
 
@@ -174,11 +432,40 @@ func (l *cfnConfiguration) Location(path []interface{}) (LocationStack, error) {
 			path,
 		)
 	}
+	return l.location(resourceId, path[3:])
+}
+
+func (l *cfnConfiguration) location(id string, attributePath []interface{}) (LocationStack, error) {
+	resourceId, ok := l.logicalId(id)
+	if !ok {
+		for _, stack := range sortedCfnStacks(l.children) {
+			if _, ok := l.children[stack].lookup(id); ok {
+				return l.nestedLocation(stack, id, attributePath)
+			}
+		}
+		resourceId = id
+	}
+	if l.source == nil {
+		return nil, nil
+	}
+
+	// Resources generated from SAM resources point to the SAM resource.  Their
+	// attributes often don't correspond to a property of the SAM resource, so
+	// we fall back to the location of the SAM resource itself.
+	if resource, ok := l.template.Resources[resourceId]; ok && resource.sam != nil {
+		samPath := []interface{}{"Resources", resource.sam.logicalId}
+		node, err := l.source.GetPath(append(samPath, append([]interface{}{"Properties"}, attributePath...)...))
+		if err != nil || len(attributePath) == 0 {
+			node, err = l.source.GetPath(samPath)
+		}
+		line, column := node.Location()
+		return []Location{{Path: l.path, Line: line, Col: column}}, err
+	}
 
 	fullPath := []interface{}{"Resources", resourceId}
-	if len(path) > 3 {
+	if len(attributePath) > 0 {
 		fullPath = append(fullPath, "Properties")
-		fullPath = append(fullPath, path[3:]...)
+		fullPath = append(fullPath, attributePath...)
 	}
 	node, err := l.source.GetPath(fullPath)
 	line, column := node.Location()
@@ -186,11 +473,29 @@ func (l *cfnConfiguration) Location(path []interface{}) (LocationStack, error) {
 }
 
 func (l *cfnConfiguration) LoadedFiles() []string {
-	return []string{l.path}
+	files := []string{l.path}
+	for _, id := range sortedCfnStacks(l.children) {
+		files = append(files, l.children[id].LoadedFiles()...)
+	}
+	return files
+}
+
+// nestedFiles returns the templates of nested stacks, so the Loader doesn't
+// load them on their own.
+func (l *cfnConfiguration) nestedFiles() []string {
+	files := []string{}
+	for _, id := range sortedCfnStacks(l.children) {
+		files = append(files, l.children[id].LoadedFiles()...)
+	}
+	return files
 }
 
 func (l *cfnConfiguration) Errors() []error {
-	return []error{}
+	errors := l.errors
+	for _, id := range sortedCfnStacks(l.children) {
+		errors = append(errors, l.children[id].Errors()...)
+	}
+	return errors
 }
 
 func (l *cfnConfiguration) Type() *Type {
@@ -247,6 +552,7 @@ var intrinsicFns map[string]string = map[string]string{
 	"!And":         "Fn::And",
 	"!Base64":      "Fn::Base64",
 	"!Cidr":        "Fn::Cidr",
+	"!Condition":   "Condition",
 	"!Equals":      "Fn::Equals",
 	"!FindInMap":   "Fn::FindInMap",
 	"!GetAtt":      "Fn::GetAtt",
@@ -255,6 +561,7 @@ var intrinsicFns map[string]string = map[string]string{
 	"!ImportValue": "Fn::ImportValue",
 	"!Join":        "Fn::Join",
 	"!Not":         "Fn::Not",
+	"!Select":      "Fn::Select",
 	"!Or":          "Fn::Or",
 	"!Ref":         "Ref",
 	"!Split":       "Fn::Split",
@@ -336,11 +643,20 @@ func decodeNode(node *yaml.Node) (interface{}, error) {
 	}
 }
 
-// An interfacetricks.TopDownInterfaceWalker implementation that resolves
-// references.  This is ported from Regula but can probably be improved now that
-// we are doing things in Go.
+// An interfacetricks.TopDownInterfaceWalker implementation that evaluates
+// intrinsic functions.  Values that cannot be known are replaced by the
+// resources and parameters they reference.
 type cfnReferenceResolver struct {
 	parameters map[string]interface{}
+	mappings   map[string]cfnMap
+
+	// References to resources are replaced by the IDs of the resources in
+	// the state, which differ from their logical IDs in nested stacks and
+	// CDK apps.
+	ids map[string]string
+
+	// Exports of other templates, by name, for Fn::ImportValue.
+	imports map[string]cfnExport
 }
 
 func (*cfnReferenceResolver) WalkArray(arr []interface{}) (interface{}, bool) {
@@ -348,10 +664,27 @@ func (*cfnReferenceResolver) WalkArray(arr []interface{}) (interface{}, bool) {
 }
 
 func (resolver *cfnReferenceResolver) WalkObject(obj map[string]interface{}) (interface{}, bool) {
+	fn, args, ok := isCfnIntrinsic(obj)
+	if !ok {
+		return obj, true
+	}
+	result := resolver.evaluateIntrinsic(fn, args)
+	if result.known {
+		return result.value, false
+	}
+
 	// For consistency with the original Rego code, return a single reference
 	// if possible, an array otherwise.  This is something that we'll likely
 	// want to revisit.
-	refs := resolver.resolveObject(obj)
+	refs := make([]interface{}, len(result.refs))
+	for i, ref := range result.refs {
+		refs[i] = ref
+		if logicalId, ok := ref.(string); ok {
+			if id, ok := resolver.ids[logicalId]; ok {
+				refs[i] = id
+			}
+		}
+	}
 	if len(refs) == 1 {
 		return refs[0], false
 	} else if len(refs) > 1 {
@@ -369,82 +702,94 @@ func (*cfnReferenceResolver) WalkBool(b bool) (interface{}, bool) {
 	return b, false
 }
 
-// Resolves references to other resources from the given value.  Returns nil
-// if not applicable.
-func (resolver *cfnReferenceResolver) resolveObject(obj map[string]interface{}) []interface{} {
-	if len(obj) == 1 {
-		// Replace references by the ID they reference, or a parameter value.
-		if ref, ok := obj["Ref"]; ok {
-			if str, ok := ref.(string); ok {
-				if paramValue, ok := resolver.parameters[str]; ok {
-					return []interface{}{paramValue}
-				} else {
-					return []interface{}{str}
-				}
-			}
+// Calls visit with the logical IDs of all resources that may be referenced in
+// the given value, together with the path of the attribute that contains the
+// reference.  Arguments to intrinsic functions do not extend the path.
+func (resolver *cfnReferenceResolver) findReferences(
+	path []interface{},
+	value interface{},
+	visit func([]interface{}, string),
+) {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, elem := range v {
+			resolver.findReferences(append(path, i), elem, visit)
 		}
-
-		// Replace {"Fn::GetAtt": [x, "Arn"]} calls by the ID of the resource
-		// they reference.
-		if argv, ok := obj["Fn::GetAtt"]; ok {
-			if args, ok := argv.([]interface{}); ok {
-				if len(args) == 2 && args[1] == "Arn" {
-					return []interface{}{args[0]}
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for fn, args := range v {
+				if fn == "Ref" || strings.HasPrefix(fn, "Fn::") {
+					resolver.findIntrinsicReferences(path, fn, args, visit)
+					return
 				}
 			}
 		}
+		for k, elem := range v {
+			resolver.findReferences(append(path, k), elem, visit)
+		}
+	}
+}
 
-		// Find references in template strings, like:
-		// * "...${LoggingBucket}..."
-		// * "...${LoggingBucket.Arn}..."
-		// * "...${AWS::Region}..."
-		if argv, ok := obj["Fn::Sub"]; ok {
-			if tmpl, ok := argv.(string); ok {
-				vars := resolver.resolveTemplateString(tmpl)
-				refs := make([]interface{}, len(vars))
-				for i := range vars {
-					refs[i] = vars[i]
-				}
-				return refs
+func (resolver *cfnReferenceResolver) findIntrinsicReferences(
+	path []interface{},
+	fn string,
+	args interface{},
+	visit func([]interface{}, string),
+) {
+	switch fn {
+	case "Ref":
+		if str, ok := args.(string); ok {
+			visit(path, str)
+			return
+		}
+	case "Fn::GetAtt":
+		if str, ok := args.(string); ok {
+			visit(path, strings.SplitN(str, ".", 2)[0])
+			return
+		} else if arr, ok := args.([]interface{}); ok && len(arr) > 0 {
+			if str, ok := arr[0].(string); ok {
+				visit(path, str)
 			}
+			return
 		}
-
-		// Find references in template strings where a variable map is
-		// provided by the user.
-		if argv, ok := obj["Fn::Sub"]; ok {
-			if args, ok := argv.([]interface{}); ok && len(args) == 2 {
-				if tmpl, ok := args[0].(string); ok {
-					if mapping, ok := args[1].(map[string]interface{}); ok {
-						vars := resolver.resolveTemplateString(tmpl)
-						refs := []interface{}{}
-						for _, k := range vars {
-							if val, ok := mapping[k]; ok {
-								refs = append(refs, val)
-							}
-						}
-						return refs
+	case "Fn::Sub":
+		if str, ok := args.(string); ok {
+			for _, v := range resolver.resolveTemplateString(str) {
+				visit(path, v)
+			}
+			return
+		} else if arr, ok := args.([]interface{}); ok && len(arr) == 2 {
+			mapping, _ := arr[1].(map[string]interface{})
+			if str, ok := arr[0].(string); ok {
+				for _, v := range resolver.resolveTemplateString(str) {
+					if _, ok := mapping[v]; !ok {
+						visit(path, v)
 					}
 				}
 			}
+			for _, val := range mapping {
+				resolver.findReferences(path, val, visit)
+			}
+			return
 		}
+	}
 
-		// Recursively collect references for joins as they are often nested.
-		if argv, ok := obj["Fn::Join"]; ok {
-			if args, ok := argv.([]interface{}); ok && len(args) == 2 {
-				if parts, ok := args[1].([]interface{}); ok {
-					refs := []interface{}{}
-					for _, arg := range parts {
-						if argObj, ok := arg.(map[string]interface{}); ok {
-							refs = append(refs, resolver.resolveObject(argObj)...)
-						}
-					}
-					return refs
-				}
+	// Other intrinsic functions may contain references in their arguments.
+	switch a := args.(type) {
+	case []interface{}:
+		for _, arg := range a {
+			resolver.findReferences(path, arg, visit)
+		}
+	case map[string]interface{}:
+		if len(a) == 1 {
+			// Nested intrinsic function.
+			resolver.findReferences(path, a, visit)
+		} else {
+			for _, arg := range a {
+				resolver.findReferences(path, arg, visit)
 			}
 		}
 	}
-
-	return nil
 }
 
 func (resolver *cfnReferenceResolver) resolveTemplateString(tmpl string) []string {
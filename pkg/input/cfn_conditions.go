@@ -0,0 +1,208 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+// cfnConditions evaluates the conditions in the Conditions section of a
+// template.  A condition is unknown if it depends on a value we don't know,
+// such as a parameter without a default or an unset pseudo parameter.  Resources and
+// Fn::If branches that depend on unknown conditions are kept as they are.
+type cfnConditions struct {
+	resolver   *cfnReferenceResolver
+	conditions map[string]cfnValue
+
+	// Evaluated conditions, nil if unknown.
+	values     map[string]*bool
+	evaluating map[string]bool
+}
+
+func newCfnConditions(
+	resolver *cfnReferenceResolver,
+	conditions map[string]cfnValue,
+) *cfnConditions {
+	return &cfnConditions{
+		resolver:   resolver,
+		conditions: conditions,
+		values:     map[string]*bool{},
+		evaluating: map[string]bool{},
+	}
+}
+
+// evaluate returns the value of the named condition, and whether or not it is
+// known.
+func (c *cfnConditions) evaluate(name string) (bool, bool) {
+	if value, ok := c.values[name]; ok {
+		if value == nil {
+			return false, false
+		}
+		return *value, true
+	}
+
+	condition, ok := c.conditions[name]
+	if !ok || c.evaluating[name] {
+		// Missing or cyclic conditions are invalid templates.
+		return false, false
+	}
+	c.evaluating[name] = true
+	value, known := c.evaluateExpr(condition.Contents)
+	delete(c.evaluating, name)
+
+	if known {
+		c.values[name] = &value
+	} else {
+		c.values[name] = nil
+	}
+	return value, known
+}
+
+// meta returns the values of all conditions, using nil for unknown ones.
+func (c *cfnConditions) meta() map[string]interface{} {
+	meta := map[string]interface{}{}
+	for name := range c.conditions {
+		if value, known := c.evaluate(name); known {
+			meta[name] = value
+		} else {
+			meta[name] = nil
+		}
+	}
+	return meta
+}
+
+func (c *cfnConditions) evaluateExpr(expr interface{}) (bool, bool) {
+	obj, ok := expr.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		if b, ok := expr.(bool); ok {
+			return b, true
+		}
+		return false, false
+	}
+
+	for fn, argv := range obj {
+		switch fn {
+		case "Condition":
+			if name, ok := argv.(string); ok {
+				return c.evaluate(name)
+			}
+		case "Fn::Equals":
+			args, ok := argv.([]interface{})
+			if !ok || len(args) != 2 {
+				return false, false
+			}
+			left, ok1 := c.scalar(args[0])
+			right, ok2 := c.scalar(args[1])
+			if !ok1 || !ok2 {
+				return false, false
+			}
+			return left == right, true
+		case "Fn::And":
+			args, _ := argv.([]interface{})
+			known := true
+			for _, arg := range args {
+				value, ok := c.evaluateExpr(arg)
+				if ok && !value {
+					return false, true
+				}
+				known = known && ok
+			}
+			return true, known
+		case "Fn::Or":
+			args, _ := argv.([]interface{})
+			known := true
+			for _, arg := range args {
+				value, ok := c.evaluateExpr(arg)
+				if ok && value {
+					return true, true
+				}
+				known = known && ok
+			}
+			return false, known
+		case "Fn::Not":
+			args, ok := argv.([]interface{})
+			if !ok || len(args) != 1 {
+				return false, false
+			}
+			value, known := c.evaluateExpr(args[0])
+			return !value, known
+		}
+	}
+	return false, false
+}
+
+// scalar returns the string representation of a scalar, evaluating intrinsic
+// functions such as Ref.  Fn::Equals compares these.
+func (c *cfnConditions) scalar(value interface{}) (string, bool) {
+	result := c.resolver.evaluate(value)
+	if !result.known {
+		return "", false
+	}
+	return cfnString(result.value)
+}
+
+// cfnNoValue takes the place of {"Ref": "AWS::NoValue"} in resolved values,
+// until it is removed from the containing object or array.
+type cfnNoValue struct{}
+
+// resolve returns a copy of the value where Fn::If calls with a known
+// condition are replaced by the chosen branch, and references to AWS::NoValue
+// are removed.  If the value itself is AWS::NoValue, cfnNoValue is returned.
+func (c *cfnConditions) resolve(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 1 {
+			if v["Ref"] == "AWS::NoValue" {
+				return cfnNoValue{}
+			}
+			if args, ok := v["Fn::If"].([]interface{}); ok && len(args) == 3 {
+				if name, ok := args[0].(string); ok {
+					if value, known := c.evaluate(name); known {
+						if value {
+							return c.resolve(args[1])
+						} else {
+							return c.resolve(args[2])
+						}
+					}
+				}
+				return v
+			}
+		}
+		resolved := map[string]interface{}{}
+		for k, child := range v {
+			r := c.resolve(child)
+			if _, ok := r.(cfnNoValue); !ok {
+				resolved[k] = r
+			}
+		}
+		return resolved
+	case []interface{}:
+		resolved := []interface{}{}
+		for _, child := range v {
+			r := c.resolve(child)
+			if _, ok := r.(cfnNoValue); !ok {
+				resolved = append(resolved, r)
+			}
+		}
+		return resolved
+	default:
+		return value
+	}
+}
+
+// resolveProperties resolves the properties of a resource.
+func (c *cfnConditions) resolveProperties(properties map[string]interface{}) map[string]interface{} {
+	if properties == nil {
+		return nil
+	}
+	resolved, _ := c.resolve(properties).(map[string]interface{})
+	return resolved
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// cfnExport is a value exported by another template in the same directory,
+// through Outputs.<name>.Export.Name.  If the value is not known, result holds
+// the IDs of the resources it refers to, as used in the state of the
+// exporting template.
+type cfnExport struct {
+	template string
+	output   string
+	result   cfnResult
+}
+
+// cfnExports collects the exports of the other templates in the directory of
+// the given template.
+func cfnExports(
+	fs afero.Fs,
+	path string,
+	opts DetectOptions,
+	context *cfnStackContext,
+) map[string]cfnExport {
+	exports := map[string]cfnExport{}
+	if fs == nil {
+		return exports
+	}
+	byTemplate := opts.cfnExports.directory(fs, filepath.Dir(path), opts, context)
+	templates := []string{}
+	for template := range byTemplate {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	for _, template := range templates {
+		if template == filepath.Clean(path) {
+			continue
+		}
+		for name, export := range byTemplate[template] {
+			exports[name] = export
+		}
+	}
+	return exports
+}
+
+// cfnExportsCache holds the exports of the templates in a directory, so they
+// are evaluated once rather than for every template that imports them.
+type cfnExportsCache struct {
+	directories map[cfnExportsKey]map[string]map[string]cfnExport
+}
+
+// cfnExportsKey identifies a directory, and the options that affect the
+// values of its exports.
+type cfnExportsKey struct {
+	fs               afero.Fs
+	dir              string
+	pseudoParameters string
+	cdkPaths         bool
+}
+
+func newCfnExportsCache() *cfnExportsCache {
+	return &cfnExportsCache{
+		directories: map[cfnExportsKey]map[string]map[string]cfnExport{},
+	}
+}
+
+// directory returns the exports of the templates in a directory, by template
+// path.  A nil cache, or a filesystem that can't be used as a key, evaluates
+// them every time.
+func (c *cfnExportsCache) directory(
+	fs afero.Fs,
+	dir string,
+	opts DetectOptions,
+	context *cfnStackContext,
+) map[string]map[string]cfnExport {
+	if c == nil || !reflect.TypeOf(fs).Comparable() {
+		return loadCfnExports(fs, dir, opts, context)
+	}
+	pseudoParameters := []string{}
+	for k, v := range opts.CfnPseudoParameters {
+		pseudoParameters = append(pseudoParameters, k+"="+v)
+	}
+	sort.Strings(pseudoParameters)
+	key := cfnExportsKey{
+		fs:               fs,
+		dir:              filepath.Clean(dir),
+		pseudoParameters: strings.Join(pseudoParameters, "\n"),
+		cdkPaths:         context != nil && context.cdkPaths,
+	}
+	if exports, ok := c.directories[key]; ok {
+		return exports
+	}
+	exports := loadCfnExports(fs, dir, opts, context)
+	c.directories[key] = exports
+	return exports
+}
+
+// loadCfnExports evaluates the exports of the templates in a directory.
+// Templates that fail to parse are ignored, since the directory may contain
+// other files.
+func loadCfnExports(
+	fs afero.Fs,
+	dir string,
+	opts DetectOptions,
+	context *cfnStackContext,
+) map[string]map[string]cfnExport {
+	byTemplate := map[string]map[string]cfnExport{}
+	entries, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return byTemplate
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !validCfnExts[filepath.Ext(path)] {
+			continue
+		}
+		contents, err := afero.ReadFile(fs, path)
+		if err != nil {
+			continue
+		}
+		template := &cfnTemplate{}
+		if err := yaml.Unmarshal(contents, &template); err != nil || template == nil || len(template.Outputs) == 0 {
+			continue
+		}
+		byTemplate[path] = template.exports(fs, path, opts, context)
+	}
+	return byTemplate
+}
+
+// exports evaluates the exports of a template.  Export names commonly include
+// the stack name, so AWS::StackName defaults to the name of the template
+// file, without its extension.
+func (tmpl *cfnTemplate) exports(
+	fs afero.Fs,
+	path string,
+	opts DetectOptions,
+	context *cfnStackContext,
+) map[string]cfnExport {
+	if tmpl.hasSamTransform() {
+		tmpl.expandSam()
+	}
+	pseudoParameters := map[string]string{
+		"AWS::StackName": strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+	for k, v := range opts.CfnPseudoParameters {
+		pseudoParameters[k] = v
+	}
+	opts.CfnPseudoParameters = pseudoParameters
+	if context != nil {
+		context = &cfnStackContext{cdkPaths: context.cdkPaths}
+	}
+
+	parameters, _ := tmpl.parameterValues(fs, path, opts, nil)
+	resolver := tmpl.resolver(opts, parameters, context)
+	exports := map[string]cfnExport{}
+	for output, contents := range tmpl.Outputs {
+		export, _ := contents.Contents["Export"].(map[string]interface{})
+		name := resolver.evaluate(export["Name"])
+		str, ok := name.value.(string)
+		if !name.known || !ok {
+			continue
+		}
+
+		result := resolver.evaluate(contents.Contents["Value"])
+		if !result.known {
+			// Only keep references to resources.
+			refs := []interface{}{}
+			for _, ref := range result.refs {
+				if logicalId, ok := ref.(string); ok {
+					if id, ok := resolver.ids[logicalId]; ok {
+						refs = append(refs, id)
+					}
+				}
+			}
+			result = cfnResult{refs: refs}
+		}
+		exports[str] = cfnExport{
+			template: path,
+			output:   output,
+			result:   result,
+		}
+	}
+	return exports
+}
+
+// importsMeta describes the values in the properties of a resource that are
+// imported from other templates.
+func (resolver *cfnReferenceResolver) importsMeta(properties map[string]interface{}) []interface{} {
+	imports := []interface{}{}
+	var visit func(path []interface{}, value interface{})
+	visit = func(path []interface{}, value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for i, elem := range v {
+				visit(append(path, int64(i)), elem)
+			}
+		case map[string]interface{}:
+			if args, ok := v["Fn::ImportValue"]; ok && len(v) == 1 {
+				name := resolver.evaluate(args)
+				str, _ := name.value.(string)
+				if export, ok := resolver.imports[str]; ok && name.known {
+					attribute := make([]interface{}, len(path))
+					copy(attribute, path)
+					meta := map[string]interface{}{
+						"attribute": attribute,
+						"export":    str,
+						"template":  export.template,
+						"output":    export.output,
+					}
+					if len(export.result.refs) > 0 {
+						meta["resources"] = export.result.refs
+					}
+					imports = append(imports, meta)
+				}
+				return
+			}
+			keys := []string{}
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				visit(append(path, k), v[k])
+			}
+		}
+	}
+	visit([]interface{}{}, properties)
+	return imports
+}
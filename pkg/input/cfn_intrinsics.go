@@ -0,0 +1,390 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+)
+
+// cfnResult is the result of evaluating a value that may contain intrinsic
+// functions.  If the value cannot be known, for example because it depends on
+// the ARN of a resource, refs holds the resources and parameters that it
+// depends on.
+type cfnResult struct {
+	value interface{}
+	known bool
+	refs  []interface{}
+}
+
+func cfnKnown(value interface{}) cfnResult {
+	return cfnResult{value: value, known: true}
+}
+
+func cfnUnknown(results ...cfnResult) cfnResult {
+	refs := []interface{}{}
+	for _, r := range results {
+		refs = append(refs, r.refs...)
+	}
+	return cfnResult{refs: refs}
+}
+
+// cfnPseudoParameterDefaults returns values for the pseudo parameters that
+// don't need to be configured, because we can derive them from the region or
+// assume the most common value.
+func cfnPseudoParameterDefaults(region string) map[string]interface{} {
+	partition, suffix := "aws", "amazonaws.com"
+	if strings.HasPrefix(region, "cn-") {
+		partition, suffix = "aws-cn", "amazonaws.com.cn"
+	} else if strings.HasPrefix(region, "us-gov-") {
+		partition = "aws-us-gov"
+	}
+	return map[string]interface{}{
+		"AWS::Partition": partition,
+		"AWS::URLSuffix": suffix,
+	}
+}
+
+func isCfnIntrinsic(obj map[string]interface{}) (string, interface{}, bool) {
+	if len(obj) == 1 {
+		for fn, args := range obj {
+			if fn == "Ref" || strings.HasPrefix(fn, "Fn::") {
+				return fn, args, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// evaluate evaluates the intrinsic functions in a value.
+func (resolver *cfnReferenceResolver) evaluate(value interface{}) cfnResult {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if fn, args, ok := isCfnIntrinsic(v); ok {
+			return resolver.evaluateIntrinsic(fn, args)
+		}
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		obj := map[string]interface{}{}
+		results := []cfnResult{}
+		for _, k := range keys {
+			r := resolver.evaluate(v[k])
+			obj[k] = r.value
+			results = append(results, r)
+		}
+		return cfnAll(obj, results)
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		results := make([]cfnResult, len(v))
+		for i := range v {
+			results[i] = resolver.evaluate(v[i])
+			arr[i] = results[i].value
+		}
+		return cfnAll(arr, results)
+	default:
+		return cfnKnown(value)
+	}
+}
+
+// cfnAll returns a known value if all results are known.
+func cfnAll(value interface{}, results []cfnResult) cfnResult {
+	for _, r := range results {
+		if !r.known {
+			return cfnUnknown(results...)
+		}
+	}
+	return cfnKnown(value)
+}
+
+func (resolver *cfnReferenceResolver) evaluateIntrinsic(fn string, argv interface{}) cfnResult {
+	args, _ := argv.([]interface{})
+	switch fn {
+	case "Ref":
+		if name, ok := argv.(string); ok {
+			if value, ok := resolver.parameters[name]; ok {
+				return cfnKnown(value)
+			}
+			return cfnResult{refs: []interface{}{name}}
+		}
+	case "Fn::GetAtt":
+		// The attributes of resources are not known.
+		if str, ok := argv.(string); ok {
+			return cfnResult{refs: []interface{}{strings.SplitN(str, ".", 2)[0]}}
+		} else if len(args) > 0 {
+			if name, ok := args[0].(string); ok {
+				return cfnResult{refs: []interface{}{name}}
+			}
+		}
+	case "Fn::Join":
+		if len(args) == 2 {
+			delimiter := resolver.evaluate(args[0])
+			list := resolver.evaluate(args[1])
+			if !delimiter.known || !list.known {
+				return cfnUnknown(delimiter, list)
+			}
+			d, ok1 := delimiter.value.(string)
+			parts, ok2 := cfnStrings(list.value)
+			if ok1 && ok2 {
+				return cfnKnown(strings.Join(parts, d))
+			}
+		}
+	case "Fn::Sub":
+		return resolver.evaluateSub(argv)
+	case "Fn::Select":
+		if len(args) == 2 {
+			index := resolver.evaluate(args[0])
+			if !index.known {
+				return cfnUnknown(index)
+			}
+			i, ok := cfnInt(index.value)
+			if !ok {
+				break
+			}
+			// Select from literal lists without evaluating other elements.
+			if literal, ok := args[1].([]interface{}); ok {
+				if i >= 0 && i < len(literal) {
+					return resolver.evaluate(literal[i])
+				}
+				break
+			}
+			list := resolver.evaluate(args[1])
+			if !list.known {
+				return cfnUnknown(list)
+			}
+			if arr, ok := list.value.([]interface{}); ok && i >= 0 && i < len(arr) {
+				return cfnKnown(arr[i])
+			}
+		}
+	case "Fn::Split":
+		if len(args) == 2 {
+			delimiter := resolver.evaluate(args[0])
+			source := resolver.evaluate(args[1])
+			if !delimiter.known || !source.known {
+				return cfnUnknown(delimiter, source)
+			}
+			d, ok1 := delimiter.value.(string)
+			s, ok2 := source.value.(string)
+			if ok1 && ok2 {
+				parts := strings.Split(s, d)
+				arr := make([]interface{}, len(parts))
+				for i := range parts {
+					arr[i] = parts[i]
+				}
+				return cfnKnown(arr)
+			}
+		}
+	case "Fn::FindInMap":
+		if len(args) == 3 {
+			keys := make([]string, 3)
+			for i := range args {
+				r := resolver.evaluate(args[i])
+				if !r.known {
+					return cfnUnknown(r)
+				}
+				str, ok := cfnString(r.value)
+				if !ok {
+					return cfnUnknown()
+				}
+				keys[i] = str
+			}
+			if mapping, ok := resolver.mappings[keys[0]]; ok {
+				if top, ok := mapping.Contents[keys[1]].(map[string]interface{}); ok {
+					if value, ok := top[keys[2]]; ok {
+						return resolver.evaluate(value)
+					}
+				}
+			}
+		}
+	case "Fn::Base64":
+		r := resolver.evaluate(argv)
+		if !r.known {
+			return cfnUnknown(r)
+		}
+		if str, ok := r.value.(string); ok {
+			return cfnKnown(base64.StdEncoding.EncodeToString([]byte(str)))
+		}
+	case "Fn::GetAZs":
+		// We don't know which availability zones exist, so we assume the
+		// first three.
+		r := resolver.evaluate(argv)
+		if !r.known {
+			break
+		}
+		region, _ := r.value.(string)
+		if region == "" {
+			region, _ = resolver.parameters["AWS::Region"].(string)
+		}
+		if region != "" {
+			return cfnKnown([]interface{}{region + "a", region + "b", region + "c"})
+		}
+	case "Fn::ImportValue":
+		name := resolver.evaluate(argv)
+		if str, ok := name.value.(string); ok && name.known {
+			if export, ok := resolver.imports[str]; ok {
+				return export.result
+			}
+		}
+	case "Fn::Cidr":
+		if len(args) == 3 {
+			r := resolver.evaluate(argv)
+			if !r.known {
+				return cfnUnknown(r)
+			}
+			if subnets, ok := cfnCidr(r.value.([]interface{})); ok {
+				return cfnKnown(subnets)
+			}
+		}
+	}
+
+	// Other functions, such as Fn::If with an unknown condition or imports
+	// that are not found, and invalid calls.
+	return cfnUnknown()
+}
+
+var cfnSubVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// evaluateSub substitutes variables in Fn::Sub templates, like:
+// * "...${LoggingBucket}..."
+// * "...${LoggingBucket.Arn}..."
+// * "...${AWS::Region}..."
+// * "...${!Literal}..."
+func (resolver *cfnReferenceResolver) evaluateSub(argv interface{}) cfnResult {
+	tmpl, ok := argv.(string)
+	variables := map[string]cfnResult{}
+	if args, isArr := argv.([]interface{}); isArr && len(args) == 2 {
+		tmpl, ok = args[0].(string)
+		if mapping, isMap := args[1].(map[string]interface{}); isMap {
+			for k, v := range mapping {
+				variables[k] = resolver.evaluate(v)
+			}
+		}
+	}
+	if !ok {
+		return cfnUnknown()
+	}
+
+	results := []cfnResult{}
+	substituted := cfnSubVariable.ReplaceAllStringFunc(tmpl, func(match string) string {
+		name := match[2 : len(match)-1]
+		if strings.HasPrefix(name, "!") {
+			return "${" + name[1:] + "}"
+		}
+		r, ok := variables[name]
+		if !ok {
+			if strings.Contains(name, ".") {
+				r = resolver.evaluateIntrinsic("Fn::GetAtt", name)
+			} else {
+				r = resolver.evaluateIntrinsic("Ref", name)
+			}
+		}
+		results = append(results, r)
+		if str, ok := cfnString(r.value); ok && r.known {
+			return str
+		}
+		return match
+	})
+
+	for _, r := range results {
+		if !r.known {
+			return cfnUnknown(results...)
+		}
+		if _, ok := cfnString(r.value); !ok {
+			return cfnUnknown()
+		}
+	}
+	return cfnKnown(substituted)
+}
+
+// cfnString converts a scalar to a string, the way CloudFormation does when
+// it joins values.
+func cfnString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool, int, float64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+func cfnStrings(value interface{}) ([]string, bool) {
+	arr, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(arr))
+	for i := range arr {
+		if strs[i], ok = cfnString(arr[i]); !ok {
+			return nil, false
+		}
+	}
+	return strs, true
+}
+
+func cfnInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	case string:
+		i, err := strconv.Atoi(v)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// cfnCidr computes the subnets for Fn::Cidr, given the address block, the
+// number of subnets and the number of host bits per subnet.
+func cfnCidr(args []interface{}) ([]interface{}, bool) {
+	block, ok := args[0].(string)
+	if !ok {
+		return nil, false
+	}
+	count, ok1 := cfnInt(args[1])
+	hostBits, ok2 := cfnInt(args[2])
+	// CloudFormation allows between 1 and 256 CIDR blocks.
+	if !ok1 || !ok2 || count < 1 || count > 256 {
+		return nil, false
+	}
+	_, network, err := net.ParseCIDR(block)
+	if err != nil {
+		return nil, false
+	}
+	prefix, bits := network.Mask.Size()
+	newBits := bits - hostBits - prefix
+	if newBits < 0 {
+		return nil, false
+	}
+	subnets := []interface{}{}
+	for i := 0; i < count; i++ {
+		subnet, err := cidr.Subnet(network, newBits, i)
+		if err != nil {
+			return nil, false
+		}
+		subnets = append(subnets, subnet.String())
+	}
+	return subnets, true
+}
@@ -0,0 +1,271 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/snyk/policy-engine/pkg/models"
+)
+
+// Nested stacks whose TemplateURL is a local path, as left by
+// `aws cloudformation package` before uploading or in CDK assemblies, are
+// loaded together with the parent template.  Their resources are added to
+// the parent state with the logical ID of the stack as a prefix, like
+// "Network.Vpc", similar to the way Terraform modules are handled.
+
+// cfnNestedStackSource is the source recorded for parameters that are passed
+// in by a parent stack.
+const cfnNestedStackSource = "parent_stack"
+
+// cfnStackContext describes how a template is loaded if it is not loaded on
+// its own, as a nested stack or as part of a CDK cloud assembly.
+type cfnStackContext struct {
+	// prefix is added to the IDs of resources, e.g. "Network.".
+	prefix     string
+	parameters map[string]cfnParameterValue
+
+	// templates holds the paths of the parent templates, to detect cycles.
+	templates []string
+
+	// cdkPaths uses the construct paths of resources as their IDs.
+	cdkPaths bool
+}
+
+func (context *cfnStackContext) parameterOverrides() map[string]cfnParameterValue {
+	if context == nil {
+		return nil
+	}
+	return context.parameters
+}
+
+// resourceIds returns the IDs of the resources in the state, by logical ID.
+func (tmpl *cfnTemplate) resourceIds(context *cfnStackContext) map[string]string {
+	ids := map[string]string{}
+	if context == nil {
+		for logicalId := range tmpl.Resources {
+			ids[logicalId] = logicalId
+		}
+		return ids
+	}
+
+	logicalIds := []string{}
+	for logicalId := range tmpl.Resources {
+		logicalIds = append(logicalIds, logicalId)
+	}
+	sort.Strings(logicalIds)
+	used := map[string]struct{}{}
+	for _, logicalId := range logicalIds {
+		id := logicalId
+		if context.cdkPaths {
+			if constructId, ok := cdkConstructId(tmpl.Resources[logicalId]); ok {
+				if _, taken := used[constructId]; !taken {
+					id = constructId
+				}
+			}
+		}
+		used[id] = struct{}{}
+		ids[logicalId] = context.prefix + id
+	}
+	return ids
+}
+
+// nestedStacks loads the nested stacks that have a local template.  Stacks
+// with a remote or unknown TemplateURL are left as they are.
+func (tmpl *cfnTemplate) nestedStacks(
+	fs afero.Fs,
+	path string,
+	opts DetectOptions,
+	resolver *cfnReferenceResolver,
+	conditions *cfnConditions,
+	context *cfnStackContext,
+) (map[string]*cfnConfiguration, []error) {
+	children := map[string]*cfnConfiguration{}
+	errors := []error{}
+	if fs == nil {
+		return children, errors
+	}
+
+	ids := []string{}
+	for id, resource := range tmpl.Resources {
+		if resource.Type == "AWS::CloudFormation::Stack" && tmpl.included(resource, conditions) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	templates := []string{filepath.Clean(path)}
+	cdkPaths := false
+	if context != nil {
+		templates = append(append([]string{}, context.templates...), templates...)
+		cdkPaths = context.cdkPaths
+	}
+	for _, id := range ids {
+		properties := conditions.resolveProperties(tmpl.Resources[id].Properties.Contents)
+		url := resolver.evaluate(properties["TemplateURL"])
+		templateURL, ok := url.value.(string)
+		if !url.known || !ok || !isLocalTemplateURL(templateURL) {
+			continue
+		}
+		childPath := templateURL
+		if !filepath.IsAbs(childPath) {
+			childPath = filepath.Join(filepath.Dir(path), childPath)
+		}
+		childPath = filepath.Clean(childPath)
+		for _, template := range templates {
+			if template == childPath {
+				errors = append(errors, fmt.Errorf(
+					"%w: nested stack %s includes %s recursively",
+					InvalidInput,
+					id,
+					childPath,
+				))
+				childPath = ""
+				break
+			}
+		}
+		if childPath == "" {
+			continue
+		}
+
+		contents, err := afero.ReadFile(fs, childPath)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%w: nested stack %s: %v", UnableToReadFile, id, err))
+			continue
+		}
+
+		// Parameters with unknown values fall back to their defaults in the
+		// nested template.
+		overrides := map[string]cfnParameterValue{}
+		parameters, _ := properties["Parameters"].(map[string]interface{})
+		for k, v := range parameters {
+			if r := resolver.evaluate(v); r.known {
+				overrides[k] = cfnParameterValue{r.value, cfnNestedStackSource}
+			}
+		}
+
+		child, err := loadCfnConfiguration(fs, childPath, contents, opts, &cfnStackContext{
+			prefix:     resolver.ids[id] + ".",
+			parameters: overrides,
+			templates:  templates,
+			cdkPaths:   cdkPaths,
+		})
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%w (nested stack %s)", err, id))
+			continue
+		}
+		children[id] = child
+	}
+	return children, errors
+}
+
+func isLocalTemplateURL(url string) bool {
+	return url != "" && !strings.Contains(url, "://")
+}
+
+func sortedCfnStacks(children map[string]*cfnConfiguration) []string {
+	ids := []string{}
+	for id := range children {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// nestedResources returns the resources and relations of the template and its
+// nested stacks.  Resources in nested stacks record the stack in their meta.
+func (l *cfnConfiguration) nestedResources() ([]models.ResourceState, []relation) {
+	resources := []models.ResourceState{}
+	for _, resource := range l.resources {
+		resources = append(resources, resource)
+	}
+	relations := append([]relation{}, l.relations...)
+
+	for _, id := range sortedCfnStacks(l.children) {
+		child := l.children[id]
+		stack := map[string]interface{}{
+			"id":       l.ids[id],
+			"template": child.path,
+		}
+		childResources, childRelations := child.nestedResources()
+		for _, resource := range childResources {
+			meta := map[string]interface{}{}
+			for k, v := range resource.Meta {
+				meta[k] = v
+			}
+			cfn := map[string]interface{}{}
+			if existing, ok := meta["cfn"].(map[string]interface{}); ok {
+				for k, v := range existing {
+					cfn[k] = v
+				}
+			}
+			// Only the innermost stack is recorded.
+			if _, ok := cfn["stack"]; !ok {
+				cfn["stack"] = stack
+			}
+			meta["cfn"] = cfn
+			resource.Meta = meta
+			resources = append(resources, resource)
+		}
+		relations = append(relations, childRelations...)
+	}
+	return resources, relations
+}
+
+// logicalId returns the logical ID of a resource in this template, given its
+// ID in the state.
+func (l *cfnConfiguration) logicalId(id string) (string, bool) {
+	for logicalId, resourceId := range l.ids {
+		if resourceId == id {
+			return logicalId, true
+		}
+	}
+	return "", false
+}
+
+// lookup finds a resource in the template or its nested stacks, given its ID
+// in the state.
+func (l *cfnConfiguration) lookup(id string) (cfnResource, bool) {
+	if logicalId, ok := l.logicalId(id); ok {
+		return l.template.Resources[logicalId], true
+	}
+	for _, stack := range sortedCfnStacks(l.children) {
+		if resource, ok := l.children[stack].lookup(id); ok {
+			return resource, true
+		}
+	}
+	return cfnResource{}, false
+}
+
+// nestedLocation returns the location of a resource in a nested stack,
+// followed by the location of the stack resource in each parent template.
+func (l *cfnConfiguration) nestedLocation(
+	stack string,
+	id string,
+	attributePath []interface{},
+) (LocationStack, error) {
+	locs, err := l.children[stack].location(id, attributePath)
+	if l.source != nil {
+		node, _ := l.source.GetPath([]interface{}{"Resources", stack})
+		line, column := node.Location()
+		locs = append(locs, Location{Path: l.path, Line: line, Col: column})
+	}
+	return locs, err
+}
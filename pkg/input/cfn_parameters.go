@@ -0,0 +1,155 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// cfnNoEchoValue replaces the values of NoEcho parameters in the state meta,
+// like the CloudFormation console does.
+const cfnNoEchoValue = "****"
+
+// cfnParameterValue is the value of a template parameter, together with its
+// source: "default", "allowed_values" or the path of a parameter file.
+type cfnParameterValue struct {
+	value  interface{}
+	source string
+}
+
+// templateParameterFiles returns the parameter files from DetectOptions that
+// apply to the given template.  Entries are either a path, which applies to
+// all templates, or template=path.  This is shared by CloudFormation and ARM.
+func templateParameterFiles(templatePath string, files []string) []string {
+	applicable := []string{}
+	for _, entry := range files {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 1 {
+			applicable = append(applicable, entry)
+		} else if filepath.Clean(parts[0]) == filepath.Clean(templatePath) {
+			applicable = append(applicable, parts[1])
+		}
+	}
+	return applicable
+}
+
+// loadCfnParameterFile reads parameter values from a file in one of these
+// formats:
+//
+//     [{"ParameterKey": "Env", "ParameterValue": "prod"}]  // AWS CLI
+//     {"Parameters": {"Env": "prod"}}                     // CodePipeline
+//     {"Env": "prod"}
+func loadCfnParameterFile(fs afero.Fs, path string) (map[string]interface{}, error) {
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", UnableToReadFile, err)
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(contents, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", FailedToParseInput, path, err)
+	}
+
+	values := map[string]interface{}{}
+	switch d := doc.(type) {
+	case []interface{}:
+		for _, item := range d {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: expected parameter objects", FailedToParseInput, path)
+			}
+			key, ok := obj["ParameterKey"].(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: missing ParameterKey", FailedToParseInput, path)
+			}
+			// Entries with UsePreviousValue have no value.
+			if value, ok := obj["ParameterValue"]; ok {
+				values[key] = value
+			}
+		}
+	case map[string]interface{}:
+		if parameters, ok := d["Parameters"].(map[string]interface{}); ok {
+			d = parameters
+		}
+		for key, value := range d {
+			values[key] = value
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s: unrecognized parameter file", FailedToParseInput, path)
+	}
+	return values, nil
+}
+
+// parameterValues returns the values of the template parameters, taken from
+// the parameter files that apply to the template or from the template
+// itself.  Values passed in by a parent stack take precedence.  Errors reading
+// parameter files are not fatal.
+func (tmpl *cfnTemplate) parameterValues(
+	fs afero.Fs,
+	templatePath string,
+	opts DetectOptions,
+	overrides map[string]cfnParameterValue,
+) (map[string]cfnParameterValue, []error) {
+	values := map[string]cfnParameterValue{}
+	for k, param := range tmpl.Parameters {
+		if param.Default != nil {
+			values[k] = cfnParameterValue{param.value(param.Default), "default"}
+		} else if len(param.AllowedValues) > 0 {
+			values[k] = cfnParameterValue{param.value(param.AllowedValues[0]), "allowed_values"}
+		}
+	}
+
+	errors := []error{}
+	for _, path := range templateParameterFiles(templatePath, opts.CfnParameterFiles) {
+		overrides, err := loadCfnParameterFile(fs, path)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		for k, value := range overrides {
+			// Parameters that the template doesn't declare are ignored, so
+			// that a file can be shared between templates.
+			if param, ok := tmpl.Parameters[k]; ok {
+				values[k] = cfnParameterValue{param.value(value), path}
+			}
+		}
+	}
+	for k, v := range overrides {
+		if param, ok := tmpl.Parameters[k]; ok {
+			values[k] = cfnParameterValue{param.value(v.value), v.source}
+		}
+	}
+	return values, errors
+}
+
+// parametersMeta describes the parameter values in the state meta.
+func (tmpl *cfnTemplate) parametersMeta(values map[string]cfnParameterValue) map[string]interface{} {
+	meta := map[string]interface{}{}
+	for k, v := range values {
+		value := v.value
+		if param := tmpl.Parameters[k]; param.noEcho() {
+			value = cfnNoEchoValue
+		}
+		meta[k] = map[string]interface{}{
+			"value":  value,
+			"source": v.source,
+		}
+	}
+	return meta
+}
@@ -0,0 +1,804 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This file expands AWS SAM resources into the CloudFormation resources that
+// the transform generates, so that rules for these resources apply to SAM
+// templates.  We follow the logical IDs that SAM uses where possible, but
+// leave out the hashes that SAM appends to the IDs of some resources.
+
+const samTransform = "AWS::Serverless-2016-10-31"
+
+// cfnSamOrigin records the SAM resource that a resource was generated from.
+type cfnSamOrigin struct {
+	logicalId    string
+	resourceType string
+}
+
+// hasSamTransform checks if the template uses the SAM transform.  The
+// Transform section can be a single transform or a list of them.
+func (tmpl *cfnTemplate) hasSamTransform() bool {
+	switch t := tmpl.Transform.(type) {
+	case string:
+		return t == samTransform
+	case []interface{}:
+		for _, elem := range t {
+			if elem == samTransform {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type samExpander struct {
+	tmpl      *cfnTemplate
+	resources map[string]cfnResource
+
+	// Paths added to APIs by function events, by API logical ID.
+	apiPaths     map[string]map[string]interface{}
+	httpApiPaths map[string]map[string]interface{}
+}
+
+// expandSam replaces the SAM resources in the template by the resources they
+// expand to.
+func (tmpl *cfnTemplate) expandSam() {
+	expander := samExpander{
+		tmpl:         tmpl,
+		resources:    map[string]cfnResource{},
+		apiPaths:     map[string]map[string]interface{}{},
+		httpApiPaths: map[string]map[string]interface{}{},
+	}
+
+	ids := []string{}
+	for id, resource := range tmpl.Resources {
+		if strings.HasPrefix(resource.Type, "AWS::Serverless::") {
+			ids = append(ids, id)
+		} else {
+			expander.resources[id] = resource
+		}
+	}
+	sort.Strings(ids)
+
+	// Functions go first, since their events add paths to APIs.
+	for _, id := range ids {
+		if tmpl.Resources[id].Type == "AWS::Serverless::Function" {
+			expander.function(id, tmpl.Resources[id])
+		}
+	}
+	for _, id := range ids {
+		resource := tmpl.Resources[id]
+		switch resource.Type {
+		case "AWS::Serverless::Api":
+			expander.api(id, resource)
+		case "AWS::Serverless::HttpApi":
+			expander.httpApi(id, resource)
+		case "AWS::Serverless::SimpleTable":
+			expander.simpleTable(id, resource)
+		case "AWS::Serverless::LayerVersion":
+			expander.layerVersion(id, resource)
+		case "AWS::Serverless::StateMachine":
+			expander.stateMachine(id, resource)
+		case "AWS::Serverless::Application":
+			expander.application(id, resource)
+		case "AWS::Serverless::Function":
+		default:
+			// Keep resources we don't know how to expand.
+			expander.resources[id] = resource
+		}
+	}
+
+	// Implicit APIs for function events without an API.
+	if _, ok := expander.apiPaths["ServerlessRestApi"]; ok {
+		if _, exists := expander.resources["ServerlessRestApi"]; !exists {
+			expander.api("ServerlessRestApi", cfnResource{
+				Type:       "AWS::Serverless::Api",
+				Properties: cfnMap{map[string]interface{}{"StageName": "Prod"}},
+				sam:        &cfnSamOrigin{"ServerlessRestApi", "AWS::Serverless::Api"},
+			})
+		}
+	}
+	if _, ok := expander.httpApiPaths["ServerlessHttpApi"]; ok {
+		if _, exists := expander.resources["ServerlessHttpApi"]; !exists {
+			expander.httpApi("ServerlessHttpApi", cfnResource{
+				Type: "AWS::Serverless::HttpApi",
+				sam:  &cfnSamOrigin{"ServerlessHttpApi", "AWS::Serverless::HttpApi"},
+			})
+		}
+	}
+
+	tmpl.Resources = expander.resources
+}
+
+// properties returns the properties of a SAM resource, merged with the
+// Globals section.  Maps are merged, lists are appended and other values in
+// the resource take precedence.
+func (e *samExpander) properties(resource cfnResource, globals string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	if global, ok := e.tmpl.Globals[globals]; ok {
+		for k, v := range global.Contents {
+			properties[k] = v
+		}
+	}
+	for k, v := range resource.Properties.Contents {
+		properties[k] = samMergeGlobal(properties[k], v)
+	}
+	return properties
+}
+
+func samMergeGlobal(global interface{}, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		g, ok := global.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		if _, _, intrinsic := isCfnIntrinsic(v); intrinsic {
+			return v
+		}
+		merged := map[string]interface{}{}
+		for k, child := range g {
+			merged[k] = child
+		}
+		for k, child := range v {
+			merged[k] = samMergeGlobal(merged[k], child)
+		}
+		return merged
+	case []interface{}:
+		if g, ok := global.([]interface{}); ok {
+			merged := append([]interface{}{}, g...)
+			return append(merged, v...)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// add adds a generated resource.  It inherits the condition and dependencies
+// of the SAM resource.
+func (e *samExpander) add(
+	id string,
+	resourceType string,
+	properties map[string]interface{},
+	origin string,
+	resource cfnResource,
+) {
+	sam := resource.sam
+	if sam == nil {
+		sam = &cfnSamOrigin{origin, resource.Type}
+	}
+	e.resources[id] = cfnResource{
+		Type:       resourceType,
+		Condition:  resource.Condition,
+		DependsOn:  resource.DependsOn,
+		Properties: cfnMap{properties},
+		sam:        sam,
+	}
+}
+
+func (e *samExpander) function(id string, resource cfnResource) {
+	props := e.properties(resource, "Function")
+	function := map[string]interface{}{}
+	samCopy(function, props,
+		"Architectures", "CodeSigningConfigArn", "Description", "Environment",
+		"EphemeralStorage", "FileSystemConfigs", "FunctionName", "Handler",
+		"ImageConfig", "KmsKeyArn", "Layers", "MemorySize", "PackageType",
+		"ReservedConcurrentExecutions", "Runtime", "Timeout", "VpcConfig",
+	)
+
+	if code := samCode(props["CodeUri"], "S3"); code != nil {
+		function["Code"] = code
+	} else if inline, ok := props["InlineCode"]; ok {
+		function["Code"] = map[string]interface{}{"ZipFile": inline}
+	} else if image, ok := props["ImageUri"]; ok {
+		function["Code"] = map[string]interface{}{"ImageUri": image}
+		function["PackageType"] = "Image"
+	}
+	if dlq, ok := props["DeadLetterQueue"].(map[string]interface{}); ok {
+		function["DeadLetterConfig"] = map[string]interface{}{"TargetArn": dlq["TargetArn"]}
+	}
+	if tracing, ok := props["Tracing"]; ok {
+		function["TracingConfig"] = map[string]interface{}{"Mode": tracing}
+	}
+	function["Tags"] = samTags(props["Tags"], true)
+
+	if role, ok := props["Role"]; ok {
+		function["Role"] = role
+	} else {
+		managed := []interface{}{
+			"arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole",
+		}
+		if _, ok := props["VpcConfig"]; ok {
+			managed = append(managed, "arn:aws:iam::aws:policy/service-role/AWSLambdaVPCAccessExecutionRole")
+		}
+		if props["Tracing"] == "Active" {
+			managed = append(managed, "arn:aws:iam::aws:policy/AWSXrayWriteOnlyAccess")
+		}
+		e.role(id, resource, "lambda.amazonaws.com", managed, props)
+		function["Role"] = samGetAtt(id+"Role", "Arn")
+	}
+	e.add(id, "AWS::Lambda::Function", function, id, resource)
+
+	if alias, ok := props["AutoPublishAlias"]; ok {
+		e.add(id+"Version", "AWS::Lambda::Version", map[string]interface{}{
+			"FunctionName": samRef(id),
+		}, id, resource)
+		aliasName, _ := alias.(string)
+		e.add(id+"Alias"+aliasName, "AWS::Lambda::Alias", map[string]interface{}{
+			"Name":            alias,
+			"FunctionName":    samRef(id),
+			"FunctionVersion": samGetAtt(id+"Version", "Version"),
+		}, id, resource)
+	}
+
+	events, _ := props["Events"].(map[string]interface{})
+	names := []string{}
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		event, _ := events[name].(map[string]interface{})
+		eventType, _ := event["Type"].(string)
+		eventProps, _ := event["Properties"].(map[string]interface{})
+		if eventProps == nil {
+			eventProps = map[string]interface{}{}
+		}
+		e.functionEvent(id, resource, name, eventType, eventProps)
+	}
+}
+
+// role generates the execution role for a function or state machine.
+func (e *samExpander) role(
+	id string,
+	resource cfnResource,
+	service string,
+	managed []interface{},
+	props map[string]interface{},
+) {
+	inline := []interface{}{}
+	policies := props["Policies"]
+	if _, ok := policies.([]interface{}); !ok && policies != nil {
+		policies = []interface{}{policies}
+	}
+	policyList, _ := policies.([]interface{})
+	for i, policy := range policyList {
+		switch p := policy.(type) {
+		case string:
+			// Names of AWS managed policies or ARNs.
+			if strings.HasPrefix(p, "arn:") {
+				managed = append(managed, p)
+			} else {
+				managed = append(managed, "arn:aws:iam::aws:policy/"+p)
+			}
+		case map[string]interface{}:
+			if _, ok := p["Statement"]; ok {
+				inline = append(inline, map[string]interface{}{
+					"PolicyName":     id + "RolePolicy" + strconv.Itoa(i),
+					"PolicyDocument": p,
+				})
+			} else if _, _, intrinsic := isCfnIntrinsic(p); intrinsic {
+				managed = append(managed, p)
+			}
+			// SAM policy templates, such as S3ReadPolicy, are not
+			// expanded.
+		}
+	}
+
+	role := map[string]interface{}{
+		"AssumeRolePolicyDocument": map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []interface{}{
+				map[string]interface{}{
+					"Effect":    "Allow",
+					"Principal": map[string]interface{}{"Service": []interface{}{service}},
+					"Action":    []interface{}{"sts:AssumeRole"},
+				},
+			},
+		},
+		"ManagedPolicyArns": managed,
+		"Tags":              samTags(props["Tags"], true),
+	}
+	if len(inline) > 0 {
+		role["Policies"] = inline
+	}
+	if boundary, ok := props["PermissionsBoundary"]; ok {
+		role["PermissionsBoundary"] = boundary
+	}
+	if path, ok := props["RolePath"]; ok {
+		role["Path"] = path
+	}
+	e.add(id+"Role", "AWS::IAM::Role", role, id, resource)
+}
+
+func (e *samExpander) permission(
+	id string,
+	resource cfnResource,
+	permissionId string,
+	principal string,
+	sourceArn interface{},
+) {
+	permission := map[string]interface{}{
+		"Action":       "lambda:InvokeFunction",
+		"FunctionName": samRef(id),
+		"Principal":    principal,
+	}
+	if sourceArn != nil {
+		permission["SourceArn"] = sourceArn
+	}
+	e.add(permissionId, "AWS::Lambda::Permission", permission, id, resource)
+}
+
+func (e *samExpander) functionEvent(
+	id string,
+	resource cfnResource,
+	name string,
+	eventType string,
+	props map[string]interface{},
+) {
+	eventId := id + name
+	switch eventType {
+	case "S3":
+		e.permission(id, resource, eventId+"Permission", "s3.amazonaws.com", nil)
+		// SAM adds the notification to the bucket.
+		if bucketId, ok := samRefId(props["Bucket"]); ok {
+			if bucket, ok := e.resources[bucketId]; ok && bucket.Type == "AWS::S3::Bucket" {
+				samAddS3Notification(&bucket, id, props)
+				e.resources[bucketId] = bucket
+			}
+		}
+	case "SQS", "Kinesis", "DynamoDB", "MSK", "MQ", "DocumentDB":
+		mapping := map[string]interface{}{
+			"FunctionName": samRef(id),
+		}
+		for k, v := range props {
+			switch k {
+			case "Queue", "Stream", "Broker", "Cluster":
+				mapping["EventSourceArn"] = v
+			default:
+				mapping[k] = v
+			}
+		}
+		e.add(eventId, "AWS::Lambda::EventSourceMapping", mapping, id, resource)
+	case "SNS":
+		subscription := map[string]interface{}{
+			"Endpoint": samGetAtt(id, "Arn"),
+			"Protocol": "lambda",
+			"TopicArn": props["Topic"],
+		}
+		samCopy(subscription, props, "FilterPolicy", "Region")
+		e.add(eventId, "AWS::SNS::Subscription", subscription, id, resource)
+		e.permission(id, resource, eventId+"Permission", "sns.amazonaws.com", props["Topic"])
+	case "Schedule", "CloudWatchEvent", "EventBridgeRule":
+		target := map[string]interface{}{
+			"Arn": samGetAtt(id, "Arn"),
+			"Id":  eventId + "LambdaTarget",
+		}
+		samCopy(target, props, "Input", "InputPath")
+		rule := map[string]interface{}{
+			"Targets": []interface{}{target},
+		}
+		samCopy(rule, props, "Description", "EventBusName", "Name", "State")
+		if schedule, ok := props["Schedule"]; ok {
+			rule["ScheduleExpression"] = schedule
+		}
+		if pattern, ok := props["Pattern"]; ok {
+			rule["EventPattern"] = pattern
+		}
+		if enabled, ok := props["Enabled"].(bool); ok && !enabled {
+			rule["State"] = "DISABLED"
+		}
+		e.add(eventId, "AWS::Events::Rule", rule, id, resource)
+		e.permission(id, resource, eventId+"Permission", "events.amazonaws.com", samGetAtt(eventId, "Arn"))
+	case "Api":
+		apiId := "ServerlessRestApi"
+		if ref, ok := samRefId(props["RestApiId"]); ok {
+			apiId = ref
+		}
+		path, _ := props["Path"].(string)
+		method, _ := props["Method"].(string)
+		samAddPath(e.apiPaths, apiId, path, method, map[string]interface{}{
+			"type":       "aws_proxy",
+			"httpMethod": "POST",
+			"uri": map[string]interface{}{
+				"Fn::Sub": "arn:${AWS::Partition}:apigateway:${AWS::Region}:lambda:path/2015-03-31/functions/${" + id + ".Arn}/invocations",
+			},
+		})
+		e.permission(id, resource, eventId+"Permission", "apigateway.amazonaws.com", samExecuteApiArn(apiId, method, path))
+	case "HttpApi":
+		apiId := "ServerlessHttpApi"
+		if ref, ok := samRefId(props["ApiId"]); ok {
+			apiId = ref
+		}
+		path, _ := props["Path"].(string)
+		method, _ := props["Method"].(string)
+		if path == "" {
+			path, method = "$default", "any"
+		}
+		samAddPath(e.httpApiPaths, apiId, path, method, map[string]interface{}{
+			"type":                 "aws_proxy",
+			"httpMethod":           "POST",
+			"payloadFormatVersion": "2.0",
+			"uri":                  samGetAtt(id, "Arn"),
+		})
+		e.permission(id, resource, eventId+"Permission", "apigateway.amazonaws.com", samExecuteApiArn(apiId, method, path))
+	}
+}
+
+func (e *samExpander) api(id string, resource cfnResource) {
+	props := e.properties(resource, "Api")
+	api := map[string]interface{}{}
+	samCopy(api, props,
+		"ApiKeySourceType", "BinaryMediaTypes", "Description",
+		"DisableExecuteApiEndpoint", "MinimumCompressionSize", "Mode", "Name",
+	)
+	if body, ok := props["DefinitionBody"]; ok {
+		api["Body"] = body
+	} else if location := samCode(props["DefinitionUri"], ""); location != nil {
+		api["BodyS3Location"] = location
+	} else {
+		api["Body"] = map[string]interface{}{
+			"swagger": "2.0",
+			"info": map[string]interface{}{
+				"version": "1.0",
+				"title":   samRef("AWS::StackName"),
+			},
+			"paths": samPaths(e.apiPaths[id]),
+		}
+	}
+	switch endpoint := props["EndpointConfiguration"].(type) {
+	case string:
+		api["EndpointConfiguration"] = map[string]interface{}{"Types": []interface{}{endpoint}}
+	case map[string]interface{}:
+		config := map[string]interface{}{}
+		if t, ok := endpoint["Type"]; ok {
+			config["Types"] = []interface{}{t}
+		}
+		if ids, ok := endpoint["VPCEndpointIds"]; ok {
+			config["VpcEndpointIds"] = ids
+		}
+		api["EndpointConfiguration"] = config
+	}
+	e.add(id, "AWS::ApiGateway::RestApi", api, id, resource)
+
+	e.add(id+"Deployment", "AWS::ApiGateway::Deployment", map[string]interface{}{
+		"RestApiId":   samRef(id),
+		"Description": "RestApi deployment id",
+		"StageName":   "Stage",
+	}, id, resource)
+
+	stageName, _ := props["StageName"].(string)
+	stage := map[string]interface{}{
+		"RestApiId":    samRef(id),
+		"DeploymentId": samRef(id + "Deployment"),
+		"StageName":    props["StageName"],
+	}
+	samCopy(stage, props,
+		"AccessLogSetting", "CacheClusterEnabled", "CacheClusterSize",
+		"CanarySetting", "MethodSettings", "TracingEnabled", "Variables",
+	)
+	if tags := samTags(props["Tags"], false); len(tags) > 0 {
+		stage["Tags"] = tags
+	}
+	e.add(id+stageName+"Stage", "AWS::ApiGateway::Stage", stage, id, resource)
+}
+
+func (e *samExpander) httpApi(id string, resource cfnResource) {
+	props := e.properties(resource, "HttpApi")
+	api := map[string]interface{}{}
+	samCopy(api, props, "Description", "DisableExecuteApiEndpoint", "FailOnWarnings", "Name")
+	if body, ok := props["DefinitionBody"]; ok {
+		api["Body"] = body
+	} else if location := samCode(props["DefinitionUri"], ""); location != nil {
+		api["BodyS3Location"] = location
+	} else {
+		api["Body"] = map[string]interface{}{
+			"openapi": "3.0.1",
+			"info": map[string]interface{}{
+				"version": "1.0",
+				"title":   samRef("AWS::StackName"),
+			},
+			"paths": samPaths(e.httpApiPaths[id]),
+		}
+	}
+	if cors, ok := props["CorsConfiguration"].(map[string]interface{}); ok {
+		api["CorsConfiguration"] = cors
+	}
+	tags, _ := props["Tags"].(map[string]interface{})
+	api["Tags"] = samTagMap(tags)
+	e.add(id, "AWS::ApiGatewayV2::Api", api, id, resource)
+
+	stageName, _ := props["StageName"].(string)
+	stageId := id + "ApiGatewayDefaultStage"
+	if stageName == "" {
+		stageName = "$default"
+	} else {
+		stageId = id + stageName + "Stage"
+	}
+	stage := map[string]interface{}{
+		"ApiId":      samRef(id),
+		"StageName":  stageName,
+		"AutoDeploy": true,
+	}
+	samCopy(stage, props, "AccessLogSettings", "DefaultRouteSettings", "RouteSettings", "StageVariables")
+	e.add(stageId, "AWS::ApiGatewayV2::Stage", stage, id, resource)
+}
+
+func (e *samExpander) simpleTable(id string, resource cfnResource) {
+	props := e.properties(resource, "SimpleTable")
+	name, attributeType := "id", "S"
+	if key, ok := props["PrimaryKey"].(map[string]interface{}); ok {
+		if n, ok := key["Name"].(string); ok {
+			name = n
+		}
+		switch key["Type"] {
+		case "Number":
+			attributeType = "N"
+		case "Binary":
+			attributeType = "B"
+		}
+	}
+	table := map[string]interface{}{
+		"KeySchema": []interface{}{
+			map[string]interface{}{"AttributeName": name, "KeyType": "HASH"},
+		},
+		"AttributeDefinitions": []interface{}{
+			map[string]interface{}{"AttributeName": name, "AttributeType": attributeType},
+		},
+	}
+	samCopy(table, props, "SSESpecification", "TableName")
+	if throughput, ok := props["ProvisionedThroughput"]; ok {
+		table["ProvisionedThroughput"] = throughput
+	} else {
+		table["BillingMode"] = "PAY_PER_REQUEST"
+	}
+	if tags := samTags(props["Tags"], false); len(tags) > 0 {
+		table["Tags"] = tags
+	}
+	e.add(id, "AWS::DynamoDB::Table", table, id, resource)
+}
+
+func (e *samExpander) layerVersion(id string, resource cfnResource) {
+	props := resource.Properties.Contents
+	layer := map[string]interface{}{}
+	samCopy(layer, props, "CompatibleArchitectures", "CompatibleRuntimes", "Description", "LayerName", "LicenseInfo")
+	if content := samCode(props["ContentUri"], "S3"); content != nil {
+		layer["Content"] = content
+	}
+	e.add(id, "AWS::Lambda::LayerVersion", layer, id, resource)
+}
+
+func (e *samExpander) stateMachine(id string, resource cfnResource) {
+	props := resource.Properties.Contents
+	machine := map[string]interface{}{}
+	samCopy(machine, props, "Definition", "DefinitionSubstitutions", "Name")
+	if name, ok := props["Name"]; ok {
+		delete(machine, "Name")
+		machine["StateMachineName"] = name
+	}
+	if location := samCode(props["DefinitionUri"], ""); location != nil {
+		machine["DefinitionS3Location"] = location
+	}
+	if logging, ok := props["Logging"]; ok {
+		machine["LoggingConfiguration"] = logging
+	}
+	if tracing, ok := props["Tracing"]; ok {
+		machine["TracingConfiguration"] = tracing
+	}
+	if t, ok := props["Type"]; ok {
+		machine["StateMachineType"] = t
+	}
+	if tags := samTags(props["Tags"], true); len(tags) > 0 {
+		machine["Tags"] = tags
+	}
+	if role, ok := props["Role"]; ok {
+		machine["RoleArn"] = role
+	} else {
+		e.role(id, resource, "states.amazonaws.com", []interface{}{}, props)
+		machine["RoleArn"] = samGetAtt(id+"Role", "Arn")
+	}
+	e.add(id, "AWS::StepFunctions::StateMachine", machine, id, resource)
+}
+
+func (e *samExpander) application(id string, resource cfnResource) {
+	props := resource.Properties.Contents
+	stack := map[string]interface{}{}
+	samCopy(stack, props, "NotificationARNs", "Parameters", "TimeoutInMinutes")
+	switch location := props["Location"].(type) {
+	case string:
+		stack["TemplateURL"] = location
+	case map[string]interface{}:
+		// Applications from the Serverless Application Repository.
+		stack["TemplateURL"] = location["ApplicationId"]
+	}
+	if tags := samTags(props["Tags"], false); len(tags) > 0 {
+		stack["Tags"] = tags
+	}
+	e.add(id, "AWS::CloudFormation::Stack", stack, id, resource)
+}
+
+func samCopy(dst map[string]interface{}, src map[string]interface{}, keys ...string) {
+	for _, k := range keys {
+		if v, ok := src[k]; ok {
+			dst[k] = v
+		}
+	}
+}
+
+func samRef(id string) map[string]interface{} {
+	return map[string]interface{}{"Ref": id}
+}
+
+func samGetAtt(id string, attribute string) map[string]interface{} {
+	return map[string]interface{}{"Fn::GetAtt": []interface{}{id, attribute}}
+}
+
+func samRefId(value interface{}) (string, bool) {
+	if obj, ok := value.(map[string]interface{}); ok && len(obj) == 1 {
+		id, ok := obj["Ref"].(string)
+		return id, ok
+	}
+	return "", false
+}
+
+// samCode converts a SAM code location, which is an S3 URI or an object with
+// Bucket, Key and Version, to the format used by CloudFormation.  Local paths
+// are left out, since they are uploaded when the template is packaged.
+func samCode(uri interface{}, prefix string) map[string]interface{} {
+	switch u := uri.(type) {
+	case string:
+		if !strings.HasPrefix(u, "s3://") {
+			return nil
+		}
+		parts := strings.SplitN(strings.TrimPrefix(u, "s3://"), "/", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		return map[string]interface{}{
+			prefix + "Bucket": parts[0],
+			prefix + "Key":    parts[1],
+		}
+	case map[string]interface{}:
+		code := map[string]interface{}{}
+		for _, k := range []string{"Bucket", "Key", "Version"} {
+			if v, ok := u[k]; ok {
+				if k == "Version" && prefix == "S3" {
+					code["S3ObjectVersion"] = v
+				} else {
+					code[prefix+k] = v
+				}
+			}
+		}
+		return code
+	}
+	return nil
+}
+
+// samTags converts a SAM tag map to a list of tags.  SAM adds a tag to the
+// functions and roles it creates.
+func samTags(tags interface{}, createdBy bool) []interface{} {
+	tagMap, _ := tags.(map[string]interface{})
+	list := []interface{}{}
+	if createdBy {
+		list = append(list, map[string]interface{}{"Key": "lambda:createdBy", "Value": "SAM"})
+	}
+	keys := []string{}
+	for k := range tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		list = append(list, map[string]interface{}{"Key": k, "Value": tagMap[k]})
+	}
+	return list
+}
+
+func samTagMap(tags map[string]interface{}) map[string]interface{} {
+	tagMap := map[string]interface{}{"httpapi:createdBy": "SAM"}
+	for k, v := range tags {
+		tagMap[k] = v
+	}
+	return tagMap
+}
+
+func samAddPath(
+	apis map[string]map[string]interface{},
+	apiId string,
+	path string,
+	method string,
+	integration map[string]interface{},
+) {
+	paths, ok := apis[apiId]
+	if !ok {
+		paths = map[string]interface{}{}
+		apis[apiId] = paths
+	}
+	methods, ok := paths[path].(map[string]interface{})
+	if !ok {
+		methods = map[string]interface{}{}
+		paths[path] = methods
+	}
+	method = strings.ToLower(method)
+	if method == "any" {
+		method = "x-amazon-apigateway-any-method"
+	}
+	methods[method] = map[string]interface{}{
+		"x-amazon-apigateway-integration": integration,
+		"responses":                       map[string]interface{}{},
+	}
+}
+
+func samPaths(paths map[string]interface{}) map[string]interface{} {
+	if paths == nil {
+		return map[string]interface{}{}
+	}
+	return paths
+}
+
+func samExecuteApiArn(apiId string, method string, path string) map[string]interface{} {
+	method = strings.ToUpper(method)
+	if method == "ANY" {
+		method = "*"
+	}
+	if path == "$default" {
+		path = "*"
+	}
+	return map[string]interface{}{
+		"Fn::Sub": []interface{}{
+			"arn:${AWS::Partition}:execute-api:${AWS::Region}:${AWS::AccountId}:${__ApiId__}/*/" + method + path,
+			map[string]interface{}{"__ApiId__": samRef(apiId)},
+		},
+	}
+}
+
+// samAddS3Notification adds the notification configuration that SAM adds to
+// buckets for S3 events.
+func samAddS3Notification(bucket *cfnResource, functionId string, props map[string]interface{}) {
+	properties := map[string]interface{}{}
+	for k, v := range bucket.Properties.Contents {
+		properties[k] = v
+	}
+	notification, _ := properties["NotificationConfiguration"].(map[string]interface{})
+	copied := map[string]interface{}{}
+	for k, v := range notification {
+		copied[k] = v
+	}
+	configurations, _ := copied["LambdaConfigurations"].([]interface{})
+
+	events := props["Events"]
+	if _, ok := events.([]interface{}); !ok {
+		events = []interface{}{events}
+	}
+	for _, event := range events.([]interface{}) {
+		configuration := map[string]interface{}{
+			"Event":    event,
+			"Function": samGetAtt(functionId, "Arn"),
+		}
+		if filter, ok := props["Filter"]; ok {
+			configuration["Filter"] = filter
+		}
+		configurations = append(append([]interface{}{}, configurations...), configuration)
+	}
+	copied["LambdaConfigurations"] = configurations
+	properties["NotificationConfiguration"] = copied
+	bucket.Properties = cfnMap{properties}
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/snyk/policy-engine/pkg/cfn/schemas"
+)
+
+// cfnTagProperties returns the properties that hold the tags of a resource
+// type, according to its schema.  Most resource types use Tags, but some use
+// the name of the resource type, like FileSystemTags for AWS::EFS::FileSystem.
+// Resources without a schema, such as custom resources, are assumed to use
+// Tags.
+func cfnTagProperties(resourceType string, schema *schemas.Schema) []string {
+	if schema == nil {
+		return []string{"Tags"}
+	}
+	parts := strings.Split(resourceType, "::")
+	candidates := []string{"Tags", parts[len(parts)-1] + "Tags"}
+	properties := []string{}
+	for _, name := range candidates {
+		if _, ok := schema.Properties[name]; ok {
+			properties = append(properties, name)
+		}
+	}
+	return properties
+}
+
+// cfnTags normalizes the tags of a resource to a map.  Tags are given as a
+// list of {Key, Value} objects or as a map, depending on the resource type.
+// The tags in TagSpecifications are included as well, including those in the
+// LaunchTemplateData of launch templates, but the resource's own tags take
+// precedence.  The properties are those from the template, before intrinsic
+// functions are resolved, so that tags whose key or value does not evaluate
+// to a known string, such as references to resources, can be left out.  Tags
+// whose key or value uses a NoEcho parameter are left out as well, since
+// tags are not redacted.
+func cfnTags(
+	tmpl *cfnTemplate,
+	resolver *cfnReferenceResolver,
+	resourceType string,
+	schema *schemas.Schema,
+	properties map[string]interface{},
+) map[string]string {
+	tags := map[string]string{}
+
+	// Nested specifications come first, so the resource's own specifications
+	// take precedence.
+	specifications := []interface{}{}
+	if schema != nil {
+		names := []string{}
+		for k, prop := range schema.Properties {
+			if prop != nil && prop.Type == schemas.Object && prop.Properties["TagSpecifications"] != nil {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			if obj, ok := resolver.evaluateObject(properties[k]); ok {
+				specifications = append(specifications, obj["TagSpecifications"])
+			}
+		}
+	}
+	specifications = append(specifications, properties["TagSpecifications"])
+	for _, specs := range specifications {
+		arr, _ := resolver.evaluateArray(specs)
+		for _, spec := range arr {
+			if obj, ok := resolver.evaluateObject(spec); ok {
+				resolver.addTags(tmpl, tags, obj["Tags"])
+			}
+		}
+	}
+
+	for _, name := range cfnTagProperties(resourceType, schema) {
+		resolver.addTags(tmpl, tags, properties[name])
+	}
+	return tags
+}
+
+func (resolver *cfnReferenceResolver) addTags(
+	tmpl *cfnTemplate,
+	tags map[string]string,
+	value interface{},
+) {
+	if arr, ok := resolver.evaluateArray(value); ok {
+		for _, elem := range arr {
+			tag, ok := resolver.evaluateObject(elem)
+			if !ok || tmpl.usesNoEcho(elem) {
+				continue
+			}
+			key, ok1 := resolver.evaluateString(tag["Key"])
+			value, ok2 := resolver.evaluateString(tag["Value"])
+			if !ok1 {
+				key, ok1 = resolver.evaluateString(tag["TagKey"])
+				value, ok2 = resolver.evaluateString(tag["TagValue"])
+			}
+			if ok1 && ok2 {
+				tags[key] = value
+			}
+		}
+	} else if obj, ok := resolver.evaluateObject(value); ok {
+		for key, elem := range obj {
+			if tmpl.usesNoEcho(elem) {
+				continue
+			}
+			if value, ok := resolver.evaluateString(elem); ok {
+				tags[key] = value
+			}
+		}
+	}
+}
+
+// evaluateArray, evaluateObject and evaluateString evaluate a value that
+// may be given by an intrinsic function, without requiring the elements of
+// arrays and objects to be known.
+func (resolver *cfnReferenceResolver) evaluateArray(value interface{}) ([]interface{}, bool) {
+	if obj, ok := value.(map[string]interface{}); ok {
+		if fn, args, ok := isCfnIntrinsic(obj); ok {
+			value = resolver.evaluateIntrinsic(fn, args).value
+		}
+	}
+	arr, ok := value.([]interface{})
+	return arr, ok
+}
+
+func (resolver *cfnReferenceResolver) evaluateObject(value interface{}) (map[string]interface{}, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if fn, args, ok := isCfnIntrinsic(obj); ok {
+		obj, ok = resolver.evaluateIntrinsic(fn, args).value.(map[string]interface{})
+		return obj, ok
+	}
+	return obj, true
+}
+
+func (resolver *cfnReferenceResolver) evaluateString(value interface{}) (string, bool) {
+	r := resolver.evaluate(value)
+	if !r.known {
+		return "", false
+	}
+	return cfnString(r.value)
+}
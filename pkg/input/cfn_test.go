@@ -98,3 +98,403 @@ func TestCfnDetectorNotYAML(t *testing.T) {
 	assert.True(t, errors.Is(err, input.FailedToParseInput))
 	assert.Nil(t, cfn)
 }
+
+func TestCfnDetectorPseudoParameters(t *testing.T) {
+	detector := &input.CfnDetector{}
+	f := makeMockFile("cfn.yaml", []byte(`
+Conditions:
+  IsChina: !Equals [!Ref AWS::Partition, aws-cn]
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub "logs-${AWS::AccountId}-${AWS::Region}"
+      Tags:
+        - Key: Zone
+          Value: !Select [1, !GetAZs ""]
+        - Key: Suffix
+          Value: !If [IsChina, !Ref AWS::URLSuffix, global]
+`))
+	cfn, err := detector.DetectFile(f, input.DetectOptions{
+		CfnPseudoParameters: map[string]string{
+			"AWS::AccountId": "123456789012",
+			"AWS::Region":    "cn-north-1",
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, cfn)
+
+	bucket := cfn.ToState().Resources["AWS::S3::Bucket"]["Bucket"]
+	assert.Equal(t, map[string]interface{}{
+		"BucketName": "logs-123456789012-cn-north-1",
+		"Tags": []interface{}{
+			map[string]interface{}{"Key": "Zone", "Value": "cn-north-1b"},
+			map[string]interface{}{"Key": "Suffix", "Value": "amazonaws.com.cn"},
+		},
+	}, bucket.Attributes)
+}
+
+func TestCfnDetectorParameterFiles(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	afero.WriteFile(fsys, "stack/template.yaml", []byte(`
+Parameters:
+  Environment:
+    Type: String
+    Default: dev
+  Password:
+    Type: String
+    NoEcho: true
+  Subnets:
+    Type: List<AWS::EC2::Subnet::Id>
+  Port:
+    Type: Number
+    Default: 80
+Resources:
+  Instance:
+    Type: AWS::EC2::Instance
+    Properties:
+      SubnetId: !Select [1, !Ref Subnets]
+      Tags:
+        - Key: Environment
+          Value: !Ref Environment
+        - Key: Password
+          Value: !Ref Password
+`), 0644)
+	afero.WriteFile(fsys, "cli.json", []byte(`[
+  {"ParameterKey": "Environment", "ParameterValue": "staging"},
+  {"ParameterKey": "Password", "ParameterValue": "hunter2"},
+  {"ParameterKey": "Port", "UsePreviousValue": true}
+]`), 0644)
+	afero.WriteFile(fsys, "pipeline.json", []byte(`{
+  "Parameters": {"Environment": "prod", "Subnets": "subnet-1, subnet-2"},
+  "Tags": {"Team": "platform"}
+}`), 0644)
+	afero.WriteFile(fsys, "other.json", []byte(`{"Environment": "other"}`), 0644)
+
+	detector := &input.CfnDetector{}
+	cfn, err := detector.DetectFile(&input.File{Path: "stack/template.yaml", Fs: fsys}, input.DetectOptions{
+		CfnParameterFiles: []string{
+			"cli.json",
+			"stack/template.yaml=pipeline.json",
+			"other/template.yaml=other.json",
+			"missing.json",
+		},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, cfn)
+
+	errs := cfn.Errors()
+	assert.Len(t, errs, 1)
+	assert.True(t, errors.Is(errs[0], input.UnableToReadFile))
+
+	state := cfn.ToState()
+	assert.Equal(t, map[string]interface{}{
+		"Environment": map[string]interface{}{"value": "prod", "source": "pipeline.json"},
+		"Password":    map[string]interface{}{"value": "****", "source": "cli.json"},
+		"Port":        map[string]interface{}{"value": 80, "source": "default"},
+		"Subnets": map[string]interface{}{
+			"value":  []interface{}{"subnet-1", "subnet-2"},
+			"source": "pipeline.json",
+		},
+	}, state.Meta["cfn"].(map[string]interface{})["parameters"])
+
+	instance := state.Resources["AWS::EC2::Instance"]["Instance"]
+	assert.Equal(t, map[string]interface{}{
+		"SubnetId": "subnet-2",
+		"Tags": []interface{}{
+			map[string]interface{}{"Key": "Environment", "Value": "prod"},
+			map[string]interface{}{"Key": "Password", "Value": "hunter2"},
+		},
+	}, instance.Attributes)
+	assert.Equal(t, []interface{}{
+		[]interface{}{"Tags", 1, "Value"},
+	}, instance.Meta["sensitive_attributes"])
+}
+
+func TestCfnDetectorNestedStacks(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	afero.WriteFile(fsys, "stack/main.yaml", []byte(`
+Parameters:
+  Environment:
+    Type: String
+    Default: prod
+Resources:
+  Network:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: nested/network.yaml
+      Parameters:
+        Environment: !Ref Environment
+        CidrBlock: 10.0.0.0/16
+  Remote:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: https://s3.amazonaws.com/bucket/remote.yaml
+  Missing:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: nested/missing.yaml
+`), 0644)
+	afero.WriteFile(fsys, "stack/nested/network.yaml", []byte(`
+Parameters:
+  Environment:
+    Type: String
+    Default: dev
+  CidrBlock:
+    Type: String
+Resources:
+  Vpc:
+    Type: AWS::EC2::VPC
+    Properties:
+      CidrBlock: !Ref CidrBlock
+      Tags:
+        - Key: Environment
+          Value: !Ref Environment
+  Subnet:
+    Type: AWS::EC2::Subnet
+    Properties:
+      VpcId: !Ref Vpc
+`), 0644)
+
+	detector := &input.CfnDetector{}
+	cfn, err := detector.DetectFile(&input.File{Path: "stack/main.yaml", Fs: fsys}, input.DetectOptions{})
+	assert.Nil(t, err)
+	assert.NotNil(t, cfn)
+
+	errs := cfn.Errors()
+	assert.Len(t, errs, 1)
+	assert.True(t, errors.Is(errs[0], input.UnableToReadFile))
+	assert.Equal(t, []string{"stack/main.yaml", "stack/nested/network.yaml"}, cfn.LoadedFiles())
+
+	state := cfn.ToState()
+	assert.Len(t, state.Resources["AWS::CloudFormation::Stack"], 3)
+	vpc := state.Resources["AWS::EC2::VPC"]["Network.Vpc"]
+	assert.Equal(t, "Network.Vpc", vpc.Id)
+	assert.Equal(t, "stack/main.yaml", vpc.Namespace)
+	assert.Equal(t, map[string]interface{}{
+		"CidrBlock": "10.0.0.0/16",
+		"Tags": []interface{}{
+			map[string]interface{}{"Key": "Environment", "Value": "prod"},
+		},
+	}, vpc.Attributes)
+	assert.Equal(t, map[string]interface{}{
+		"logical_id": "Vpc",
+		"stack": map[string]interface{}{
+			"id":       "Network",
+			"template": "stack/nested/network.yaml",
+		},
+	}, vpc.Meta["cfn"])
+	subnet := state.Resources["AWS::EC2::Subnet"]["Network.Subnet"]
+	assert.Equal(t, "Network.Vpc", subnet.Attributes["VpcId"])
+
+	loc, err := cfn.Location([]interface{}{
+		"stack/main.yaml",
+		"AWS::EC2::VPC",
+		"Network.Vpc",
+		"CidrBlock",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, input.LocationStack{
+		{Path: "stack/nested/network.yaml", Line: 12, Col: 7},
+		{Path: "stack/main.yaml", Line: 7, Col: 3},
+	}, loc)
+}
+
+func TestCfnDetectorCrossStack(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	afero.WriteFile(fsys, "stacks/network.yaml", []byte(`
+Resources:
+  Vpc:
+    Type: AWS::EC2::VPC
+    Properties:
+      CidrBlock: 10.0.0.0/16
+Outputs:
+  VpcId:
+    Value: !Ref Vpc
+    Export:
+      Name: !Sub ${AWS::StackName}-VpcId
+  Cidr:
+    Value: 10.0.0.0/16
+    Export:
+      Name: network-cidr
+`), 0644)
+	afero.WriteFile(fsys, "stacks/app.yaml", []byte(`
+Parameters:
+  NetworkStack:
+    Type: String
+    Default: network
+Resources:
+  SecurityGroup:
+    Type: AWS::EC2::SecurityGroup
+    Properties:
+      GroupDescription: app
+      VpcId: !ImportValue
+        Fn::Sub: ${NetworkStack}-VpcId
+      SecurityGroupIngress:
+        - CidrIp: !ImportValue network-cidr
+          IpProtocol: tcp
+          FromPort: 443
+          ToPort: 443
+        - CidrIp: !ImportValue missing-cidr
+          IpProtocol: tcp
+          FromPort: 80
+          ToPort: 80
+`), 0644)
+	afero.WriteFile(fsys, "stacks/README.md", []byte("# Stacks\n"), 0644)
+
+	detector := &input.CfnDetector{}
+	file := &input.File{Path: "stacks/app.yaml", Fs: fsys}
+
+	cfn, err := detector.DetectFile(file, input.DetectOptions{})
+	assert.Nil(t, err)
+	sg := cfn.ToState().Resources["AWS::EC2::SecurityGroup"]["SecurityGroup"]
+	assert.Equal(t, map[string]interface{}{"Fn::ImportValue": "network-VpcId"}, sg.Attributes["VpcId"])
+	assert.Nil(t, sg.Meta["cfn"])
+
+	cfn, err = detector.DetectFile(file, input.DetectOptions{CfnCrossStack: true})
+	assert.Nil(t, err)
+	sg = cfn.ToState().Resources["AWS::EC2::SecurityGroup"]["SecurityGroup"]
+	assert.Equal(t, "Vpc", sg.Attributes["VpcId"])
+	ingress := sg.Attributes["SecurityGroupIngress"].([]interface{})
+	assert.Equal(t, "10.0.0.0/16", ingress[0].(map[string]interface{})["CidrIp"])
+	assert.Equal(t, map[string]interface{}{"Fn::ImportValue": "missing-cidr"}, ingress[1].(map[string]interface{})["CidrIp"])
+	assert.Equal(t, map[string]interface{}{
+		"imports": []interface{}{
+			map[string]interface{}{
+				"attribute": []interface{}{"SecurityGroupIngress", int64(0), "CidrIp"},
+				"export":    "network-cidr",
+				"template":  "stacks/network.yaml",
+				"output":    "Cidr",
+			},
+			map[string]interface{}{
+				"attribute": []interface{}{"VpcId"},
+				"export":    "network-VpcId",
+				"template":  "stacks/network.yaml",
+				"output":    "VpcId",
+				"resources": []interface{}{"Vpc"},
+			},
+		},
+	}, sg.Meta["cfn"])
+
+	// The exports of the directory are reused for other templates in it, but
+	// templates don't import their own exports.
+	cfn, err = detector.DetectFile(&input.File{Path: "stacks/network.yaml", Fs: fsys}, input.DetectOptions{CfnCrossStack: true})
+	assert.Nil(t, err)
+	vpc := cfn.ToState().Resources["AWS::EC2::VPC"]["Vpc"]
+	assert.Nil(t, vpc.Meta["cfn"])
+}
+
+func TestCfnDetectorCidr(t *testing.T) {
+	detector := &input.CfnDetector{}
+	f := makeMockFile("cfn.yaml", []byte(`
+Resources:
+  Subnet:
+    Type: AWS::EC2::Subnet
+    Properties:
+      VpcId: vpc-123
+      CidrBlock: !Select [2, !Cidr [10.0.0.0/16, 256, 8]]
+  NoBlocks:
+    Type: AWS::EC2::Subnet
+    Properties:
+      VpcId: vpc-123
+      CidrBlock: !Select [0, !Cidr [10.0.0.0/16, 0, 8]]
+  TooManyBlocks:
+    Type: AWS::EC2::Subnet
+    Properties:
+      VpcId: vpc-123
+      CidrBlock: !Select [0, !Cidr [10.0.0.0/8, 1000000000, 8]]
+`))
+	cfn, err := detector.DetectFile(f, input.DetectOptions{})
+	assert.Nil(t, err)
+
+	subnets := cfn.ToState().Resources["AWS::EC2::Subnet"]
+	assert.Equal(t, "10.0.2.0/24", subnets["Subnet"].Attributes["CidrBlock"])
+	// Invalid counts are left unevaluated.
+	assert.Equal(t, map[string]interface{}{
+		"Fn::Select": []interface{}{0, map[string]interface{}{
+			"Fn::Cidr": []interface{}{"10.0.0.0/16", 0, 8},
+		}},
+	}, subnets["NoBlocks"].Attributes["CidrBlock"])
+	assert.Equal(t, map[string]interface{}{
+		"Fn::Select": []interface{}{0, map[string]interface{}{
+			"Fn::Cidr": []interface{}{"10.0.0.0/8", 1000000000, 8},
+		}},
+	}, subnets["TooManyBlocks"].Attributes["CidrBlock"])
+}
+
+func TestCfnDetectorTags(t *testing.T) {
+	detector := &input.CfnDetector{}
+	f := makeMockFile("cfn.yaml", []byte(`
+Parameters:
+  Topic:
+    Type: String
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      Tags:
+        - Key: Owner
+          Value: !Sub "${AWS::Partition}-team"
+        - Key: Unknown
+          Value: !ImportValue owner
+        - Key: Topic
+          Value: !Ref Topic
+        - Key: Queue
+          Value: !Ref Queue
+        - Key: !Ref Topic
+          Value: topic
+  Parameter:
+    Type: AWS::SSM::Parameter
+    Properties:
+      Type: String
+      Value: example
+      Tags:
+        Owner: team
+  Application:
+    Type: AWS::AppStream::Application
+    Properties:
+      Tags:
+        - TagKey: Owner
+          TagValue: team
+  FileSystem:
+    Type: AWS::EFS::FileSystem
+    Properties:
+      FileSystemTags:
+        - Key: Owner
+          Value: team
+  LaunchTemplate:
+    Type: AWS::EC2::LaunchTemplate
+    Properties:
+      LaunchTemplateData:
+        TagSpecifications:
+          - ResourceType: instance
+            Tags:
+              - Key: Owner
+                Value: instances
+              - Key: Role
+                Value: web
+      TagSpecifications:
+        - ResourceType: launch-template
+          Tags:
+            - Key: Owner
+              Value: team
+  Queue:
+    Type: AWS::SQS::Queue
+`))
+	cfn, err := detector.DetectFile(f, input.DetectOptions{})
+	assert.Nil(t, err)
+	assert.NotNil(t, cfn)
+
+	resources := cfn.ToState().Resources
+	assert.Equal(t, map[string]string{"Owner": "aws-team"},
+		resources["AWS::S3::Bucket"]["Bucket"].Tags)
+	assert.Equal(t, map[string]string{"Owner": "team"},
+		resources["AWS::SSM::Parameter"]["Parameter"].Tags)
+	assert.Equal(t, map[string]string{"Owner": "team"},
+		resources["AWS::AppStream::Application"]["Application"].Tags)
+	assert.Equal(t, map[string]string{"Owner": "team"},
+		resources["AWS::EFS::FileSystem"]["FileSystem"].Tags)
+	assert.Equal(t, map[string]string{"Owner": "team", "Role": "web"},
+		resources["AWS::EC2::LaunchTemplate"]["LaunchTemplate"].Tags)
+	assert.Nil(t, resources["AWS::SQS::Queue"]["Queue"].Tags)
+}
@@ -40,6 +40,15 @@ type IACConfiguration interface {
 	Type() *Type
 }
 
+// MultiStateConfiguration is implemented by configurations that produce more
+// than one State, such as a Terraform configuration that is evaluated once for
+// every variable set.  The Loader uses ToStates() rather than ToState() for
+// these.
+type MultiStateConfiguration interface {
+	IACConfiguration
+	ToStates() []models.State
+}
+
 // Location is a filepath, line and column.
 type Location struct {
 	Path string `json:"path"`
@@ -71,6 +80,65 @@ type DetectOptions struct {
 	// VarFiles contains paths to variable files that should be included in the
 	// configurations that the detector parses.
 	VarFiles []string
+	// Vars contains "name=value" variable assignments, like Terraform's `-var`
+	// option.  These take precedence over VarFiles.
+	Vars []string
+	// Env contains environment variables in "key=value" form.  Variables
+	// prefixed with TF_VAR_ set Terraform variables, with the lowest
+	// precedence.
+	Env []string
+	// VariableSets, if not empty, causes Terraform configurations to be
+	// evaluated once for every set, producing one state per set.  VarFiles,
+	// Vars and Env apply to all sets.
+	VariableSets []VariableSet
+	// Workspace sets terraform.workspace in Terraform configurations.  If
+	// empty, TF_WORKSPACE from Env is used, and otherwise "default".
+	Workspace string
+	// PathRoot and PathCwd set path.root and path.cwd in Terraform
+	// configurations.  Both default to the directory of the root module.
+	PathRoot string
+	PathCwd  string
+	// PlanConfigurationDir is the directory of the Terraform configuration
+	// that plans were generated from.  When set, source locations of plan
+	// resources point to the HCL source rather than to the JSON plan.
+	PlanConfigurationDir string
+	// CfnPseudoParameters sets the values of CloudFormation pseudo
+	// parameters, such as "AWS::Region" or "AWS::AccountId".  Unset pseudo
+	// parameters are treated as unknown values, except for "AWS::Partition"
+	// and "AWS::URLSuffix", which are derived from the region.
+	CfnPseudoParameters map[string]string
+	// CfnParameterFiles contains paths to CloudFormation parameter files, in
+	// the format used by the AWS CLI, CodePipeline template configurations or
+	// plain JSON objects.  An entry of the form "template=path" only applies
+	// to the given template.  Later files take precedence.
+	CfnParameterFiles []string
+	// CfnCrossStack resolves Fn::ImportValue in CloudFormation templates
+	// using the exports of the other templates in the same directory.
+	CfnCrossStack bool
+	// ArmContext describes the deployment of ARM templates.  The supported
+	// keys are "subscriptionId", "tenantId", "resourceGroup", "location" and
+	// "deploymentName", which set the values returned by subscription(),
+	// resourceGroup() and deployment().  Unset values are unknown.
+	ArmContext map[string]string
+	// ArmParameterFiles contains paths to ARM parameter files.  An entry of
+	// the form "template=path" only applies to the given template.  These
+	// take precedence over the file named after the template, like
+	// azuredeploy.parameters.json for azuredeploy.json.
+	ArmParameterFiles []string
+
+	// cfnExports caches the exports of CloudFormation templates between
+	// the templates loaded by a detector.
+	cfnExports *cfnExportsCache
+}
+
+// VariableSet is a named set of Terraform variable inputs, typically
+// corresponding to an environment such as "dev" or "prod".
+type VariableSet struct {
+	Name string
+	// VarFiles and Vars are applied after the VarFiles and Vars in
+	// DetectOptions, and take precedence over them.
+	VarFiles []string
+	Vars     []string
 }
 
 // Detector implements the visitor part of the visitor pattern for the concrete
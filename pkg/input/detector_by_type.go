@@ -23,8 +23,11 @@ func detectorByInputType(inputType *Type) (Detector, error) {
 	switch inputType.Name {
 	case Auto.Name:
 		return NewMultiDetector(
+			&StateDetector{},
+			&CdkDetector{},
 			&CfnDetector{},
 			&TfPlanDetector{},
+			&TerragruntDetector{},
 			&TfDetector{},
 			&TfStateDetector{},
 			&KubernetesDetector{},
@@ -32,12 +35,18 @@ func detectorByInputType(inputType *Type) (Detector, error) {
 		), nil
 	case CloudFormation.Name:
 		return &CfnDetector{}, nil
+	case Cdk.Name:
+		return &CdkDetector{}, nil
 	case TerraformPlan.Name:
 		return &TfPlanDetector{}, nil
 	case TerraformHCL.Name:
 		return &TfDetector{}, nil
+	case Terragrunt.Name:
+		return &TerragruntDetector{}, nil
 	case TerraformState.Name:
 		return &TfStateDetector{}, nil
+	case State.Name:
+		return &StateDetector{}, nil
 	case StreamlinedState.Name:
 		return &StreamlinedStateDetector{}, nil
 	case Kubernetes.Name:
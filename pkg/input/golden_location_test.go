@@ -96,6 +96,51 @@ var goldenLocationTests = []goldenLocationTest{
 			},
 		},
 	},
+	{
+		directory: "golden_test/arm/copy-conditions",
+		cases: []goldenLocationTestCase{
+			{
+				path: []interface{}{
+					"golden_test/arm/copy-conditions",
+					"Microsoft.Storage/storageAccounts",
+					"Microsoft.Storage/storageAccounts/storage2dev",
+					"properties",
+					"supportsHttpsTrafficOnly",
+				},
+				expected: LocationStack{Location{
+					Path: "template.json",
+					Line: 46,
+					Col:  9,
+				}},
+			},
+		},
+	},
+	// CDK
+	{
+		directory: "golden_test/cdk/app",
+		cases: []goldenLocationTestCase{
+			{
+				path: []interface{}{
+					"golden_test/cdk/app/AppStack.template.json",
+					"AWS::S3::Bucket",
+					"Uploads",
+					"BucketName",
+				},
+				expected: LocationStack{
+					Location{
+						Path: "AppStack.template.json",
+						Line: 6,
+						Col:  9,
+					},
+					Location{
+						Path: "manifest.json",
+						Line: 29,
+						Col:  9,
+					},
+				},
+			},
+		},
+	},
 	// CFN
 	{
 		directory: "golden_test/cfn/example-01",
@@ -114,6 +159,37 @@ var goldenLocationTests = []goldenLocationTest{
 			},
 		},
 	},
+	{
+		directory: "golden_test/cfn/sam",
+		cases: []goldenLocationTestCase{
+			{
+				path: []interface{}{
+					"golden_test/cfn/sam",
+					"AWS::Lambda::Function",
+					"ItemsFunction",
+					"Handler",
+				},
+				expected: LocationStack{Location{
+					Path: "template.yaml",
+					Line: 30,
+					Col:  7,
+				}},
+			},
+			{
+				path: []interface{}{
+					"golden_test/cfn/sam",
+					"AWS::IAM::Role",
+					"ItemsFunctionRole",
+					"AssumeRolePolicyDocument",
+				},
+				expected: LocationStack{Location{
+					Path: "template.yaml",
+					Line: 27,
+					Col:  3,
+				}},
+			},
+		},
+	},
 	{
 		directory: "golden_test/cfn/json-01",
 		cases: []goldenLocationTestCase{
@@ -163,6 +239,43 @@ var goldenLocationTests = []goldenLocationTest{
 			},
 		},
 	},
+	// State
+	{
+		directory: "golden_test/state/inventory",
+		cases: []goldenLocationTestCase{
+			{
+				path: []interface{}{
+					"us-east-1",
+					"aws_security_group",
+					"sg-0123",
+				},
+				expected: LocationStack{
+					{
+						Path: "inventory.json",
+						Line: 30,
+						Col:  7,
+					},
+				},
+			},
+			{
+				path: []interface{}{
+					"us-east-1",
+					"aws_security_group",
+					"sg-0123",
+					"ingress",
+					0,
+					"from_port",
+				},
+				expected: LocationStack{
+					{
+						Path: "inventory.json",
+						Line: 38,
+						Col:  15,
+					},
+				},
+			},
+		},
+	},
 	// Terraform
 	{
 		directory: "golden_test/tf/example-terraform-modules",
@@ -367,6 +480,127 @@ var goldenLocationTests = []goldenLocationTest{
 			},
 		},
 	},
+	{
+		directory: "golden_test/tfplan/modules",
+		cases: []goldenLocationTestCase{
+			{
+				path: []interface{}{
+					"golden_test/tfplan/modules/plan.json",
+					"aws_vpc",
+					"module.child1.module.grandchild1.aws_vpc.grandchild",
+				},
+				expected: LocationStack{
+					{
+						Path: "plan.json",
+						Line: 86,
+						Col:  17,
+					},
+				},
+			},
+			{
+				path: []interface{}{
+					"golden_test/tfplan/modules/plan.json",
+					"aws_vpc",
+					"module.child1.module.grandchild1.aws_vpc.grandchild",
+					"cidr_block",
+				},
+				expected: LocationStack{
+					{
+						Path: "plan.json",
+						Line: 95,
+						Col:  21,
+					},
+				},
+			},
+		},
+	},
+	{
+		directory: "golden_test/tfstate/instances-v4",
+		cases: []goldenLocationTestCase{
+			{
+				path: []interface{}{
+					"aws",
+					"aws_s3_bucket",
+					`module.logs.aws_s3_bucket.bucket["audit"]`,
+				},
+				expected: LocationStack{
+					{
+						Path: "terraform.tfstate.json",
+						Line: 69,
+						Col:  9,
+					},
+				},
+			},
+			{
+				path: []interface{}{
+					"aws",
+					"aws_s3_bucket",
+					`module.logs.aws_s3_bucket.bucket["audit"]`,
+					"bucket",
+				},
+				expected: LocationStack{
+					{
+						Path: "terraform.tfstate.json",
+						Line: 74,
+						Col:  13,
+					},
+				},
+			},
+		},
+	},
+	{
+		directory: "golden_test/tfstate/v3-01",
+		cases: []goldenLocationTestCase{
+			{
+				path: []interface{}{
+					"aws",
+					"aws_security_group",
+					"aws_security_group.web",
+				},
+				expected: LocationStack{
+					{
+						Path: "terraform.tfstate.json",
+						Line: 14,
+						Col:  11,
+					},
+				},
+			},
+			{
+				path: []interface{}{
+					"aws",
+					"aws_security_group",
+					"aws_security_group.web",
+					"tags",
+					"kubernetes.io/cluster",
+				},
+				expected: LocationStack{
+					{
+						Path: "terraform.tfstate.json",
+						Line: 26,
+						Col:  15,
+					},
+				},
+			},
+			{
+				// Set elements are keyed by a hash in flat attributes.
+				path: []interface{}{
+					"aws",
+					"aws_security_group",
+					"aws_security_group.web",
+					"ingress",
+					0,
+					"from_port",
+				},
+				expected: LocationStack{
+					{
+						Path: "terraform.tfstate.json",
+						Line: 19,
+						Col:  15,
+					},
+				},
+			},
+		},
+	},
 }
 
 // Tests for attribute locations.  These use the same input files as the
@@ -0,0 +1,10 @@
+locals {
+  environment = "prod"
+}
+
+inputs = {
+  environment = local.environment
+  tags = {
+    Owner = "platform"
+  }
+}
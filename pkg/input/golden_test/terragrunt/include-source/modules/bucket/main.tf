@@ -0,0 +1,21 @@
+variable "bucket_name" {}
+variable "environment" {}
+variable "kms_key_arn" {}
+variable "tags" {
+  type = map(string)
+}
+
+resource "aws_s3_bucket" "this" {
+  bucket = var.bucket_name
+  tags   = merge(var.tags, { Environment = var.environment })
+}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "this" {
+  bucket = aws_s3_bucket.this.id
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm     = "aws:kms"
+      kms_master_key_id = var.kms_key_arn
+    }
+  }
+}
@@ -0,0 +1,27 @@
+include "common" {
+  path   = "${get_terragrunt_dir()}/common.hcl"
+  expose = true
+}
+
+terraform {
+  source = "./modules//bucket"
+}
+
+locals {
+  name = "${include.common.locals.environment}-logs"
+}
+
+dependency "kms" {
+  config_path = "../kms"
+  mock_outputs = {
+    key_arn = "arn:aws:kms:us-east-1:111122223333:key/mock"
+  }
+}
+
+inputs = {
+  bucket_name = local.name
+  kms_key_arn = dependency.kms.outputs.key_arn
+  tags = {
+    Owner = "security"
+  }
+}
@@ -0,0 +1,47 @@
+variable "bucket_id" {
+  type    = string
+  default = "my-bucket"
+}
+
+variable "settings" {
+  type = object({
+    acl        = optional(string, "private")
+    versioning = optional(bool)
+  })
+  default = {}
+}
+
+moved {
+  from = aws_s3_bucket.old
+  to   = aws_s3_bucket.new
+}
+
+import {
+  id = var.bucket_id
+  to = aws_s3_bucket.new
+}
+
+import {
+  id = "child-bucket"
+  to = module.child.aws_s3_bucket.b
+}
+
+resource "aws_s3_bucket" "new" {
+  bucket = var.bucket_id
+  acl    = var.settings.acl
+}
+
+module "child" {
+  source = "./child"
+}
+
+check "health" {
+  data "http" "site" {
+    url = "https://example.com"
+  }
+
+  assert {
+    condition     = data.http.site.status_code == 200
+    error_message = "down"
+  }
+}
@@ -0,0 +1,20 @@
+variable "buckets" {
+  type = list(object({
+    name       = string
+    versioning = optional(bool, false)
+  }))
+}
+
+resource "aws_s3_bucket" "a" {
+  bucket = var.buckets[0].name
+  versioning {
+    enabled = var.buckets[0].versioning
+  }
+}
+
+resource "aws_s3_bucket" "b" {
+  bucket = var.buckets[1].name
+  versioning {
+    enabled = var.buckets[1].versioning
+  }
+}
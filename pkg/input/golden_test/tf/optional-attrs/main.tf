@@ -0,0 +1,25 @@
+variable "settings" {
+  type = object({
+    name = string
+    acl  = optional(string, "private")
+    tags = optional(map(string), {})
+    lock = optional(object({
+      enabled = optional(bool, true)
+    }), {})
+  })
+  default = {
+    name = "root"
+  }
+}
+
+module "child" {
+  source  = "./child"
+  buckets = [{ name = "a" }, { name = "b", versioning = true }]
+}
+
+resource "aws_s3_bucket" "root" {
+  bucket              = var.settings.name
+  acl                 = var.settings.acl
+  tags                = var.settings.tags
+  object_lock_enabled = var.settings.lock.enabled
+}
@@ -0,0 +1,29 @@
+provider "aws" {
+  region              = "us-east-1"
+  allowed_account_ids = ["111111111111"]
+}
+
+provider "aws" {
+  alias  = "west"
+  region = "us-west-2"
+  assume_role {
+    role_arn = "arn:aws:iam::222222222222:role/deploy"
+  }
+}
+
+resource "aws_s3_bucket" "east" {}
+
+resource "aws_s3_bucket" "west" {
+  provider = aws.west
+}
+
+module "inherit" {
+  source = "./child"
+}
+
+module "passed" {
+  source = "./child"
+  providers = {
+    aws = aws.west
+  }
+}
@@ -0,0 +1,8 @@
+variable "token" {
+  sensitive = true
+}
+resource "aws_ssm_parameter" "p" {
+  name  = "token"
+  value = var.token
+  count = 1
+}
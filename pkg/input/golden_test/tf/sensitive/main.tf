@@ -0,0 +1,27 @@
+variable "password" {
+  type      = string
+  sensitive = true
+  default   = "hunter22"
+}
+
+variable "creds" {
+  type = object({ user = string, pass = string })
+  default = { user = "admin", pass = "secret" }
+  sensitive = true
+}
+
+resource "aws_db_instance" "db" {
+  password = var.password
+  username = var.creds.user
+  tags = {
+    Name   = "db"
+    Secret = "x-${var.password}"
+    Other  = sensitive("y")
+  }
+  engine = "postgres"
+}
+
+module "child" {
+  source = "./child"
+  token  = "plain"
+}
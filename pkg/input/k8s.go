@@ -112,6 +112,8 @@ func (l *k8s_Configuration) ToState() models.State {
 	}
 
 	return models.State{
+		Format:              stateFormat,
+		FormatVersion:       stateFormatVersion,
 		InputType:           Kubernetes.Name,
 		EnvironmentProvider: "iac",
 		Meta: map[string]interface{}{
@@ -42,6 +42,10 @@ type Loader struct {
 	// input path, "src/vpc".
 	loadedPaths map[string]string
 
+	// Paths that are part of another configuration and must not be loaded
+	// on their own.  See nestedConfiguration.
+	nestedPaths map[string]struct{}
+
 	locationCache map[string]cachedLocation
 }
 
@@ -51,15 +55,27 @@ func NewLoader(detector Detector) Loader {
 		detector:       detector,
 		configurations: map[string]IACConfiguration{},
 		loadedPaths:    map[string]string{},
+		nestedPaths:    map[string]struct{}{},
 		locationCache:  map[string]cachedLocation{},
 	}
 }
 
+// nestedConfiguration is implemented by configurations that include other
+// inputs, such as the templates of nested CloudFormation stacks.  These inputs
+// are only loaded as part of the configuration that includes them.
+type nestedConfiguration interface {
+	nestedFiles() []string
+}
+
 // Load invokes this Loader's detector on an input and stores any resulting
-// configuration. This method will return true if a configuration is detected and loaded
-// and false otherwise.
+// configuration. This method will return true if a configuration is detected and loaded,
+// or if the input is already included in another configuration that implements
+// nestedConfiguration, and false otherwise.
 func (l *Loader) Load(detectable Detectable, detectOpts DetectOptions) (bool, error) {
 	path := detectable.GetPath()
+	if _, ok := l.nestedPaths[path]; ok {
+		return true, nil
+	}
 	conf, err := detectable.DetectType(l.detector, detectOpts)
 	if err != nil {
 		return false, err
@@ -70,12 +86,34 @@ func (l *Loader) Load(detectable Detectable, detectOpts DetectOptions) (bool, er
 		for _, p := range conf.LoadedFiles() {
 			l.loadedPaths[p] = path
 		}
+		if nested, ok := conf.(nestedConfiguration); ok {
+			for _, p := range nested.nestedFiles() {
+				if p != path {
+					l.nestedPaths[p] = struct{}{}
+					l.subsume(p, path)
+				}
+			}
+		}
 		return true, nil
 	} else {
 		return false, nil
 	}
 }
 
+// subsume replaces a configuration that was loaded on its own by the
+// configuration that includes it.
+func (l *Loader) subsume(path string, by string) {
+	if _, ok := l.configurations[path]; !ok {
+		return
+	}
+	delete(l.configurations, path)
+	for p, canonical := range l.loadedPaths {
+		if canonical == path {
+			l.loadedPaths[p] = by
+		}
+	}
+}
+
 // ToStates will convert the configurations in this Loader to State structs which can be
 // used by the engine package.
 func (l *Loader) ToStates() []models.State {
@@ -86,7 +124,11 @@ func (l *Loader) ToStates() []models.State {
 	sort.Strings(keys)
 	states := []models.State{}
 	for _, k := range keys {
-		states = append(states, l.configurations[k].ToState())
+		if multi, ok := l.configurations[k].(MultiStateConfiguration); ok {
+			states = append(states, multi.ToStates()...)
+		} else {
+			states = append(states, l.configurations[k].ToState())
+		}
 	}
 	return states
 }
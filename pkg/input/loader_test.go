@@ -16,9 +16,13 @@ package input_test
 
 import (
 	"fmt"
+	"testing"
 
-	"github.com/snyk/policy-engine/pkg/input"
 	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/snyk/policy-engine/pkg/input"
 )
 
 func ExampleLoader_Load() {
@@ -39,3 +43,72 @@ func ExampleLoader_Load() {
 	fmt.Println(loader.Count())
 	// Output: 7
 }
+
+func TestLoaderNestedStacks(t *testing.T) {
+	// The templates of nested stacks are sorted both before and after the
+	// parent template, and are only loaded as part of the parent.
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "stack/parent.yaml", []byte(`
+Resources:
+  Network:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: network.yaml
+  Zones:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: zones.yaml
+`), 0644)
+	afero.WriteFile(fs, "stack/network.yaml", []byte(`
+Resources:
+  Vpc:
+    Type: AWS::EC2::VPC
+    Properties:
+      CidrBlock: 10.0.0.0/16
+`), 0644)
+	afero.WriteFile(fs, "stack/zones.yaml", []byte(`
+Resources:
+  Zone:
+    Type: AWS::Route53::HostedZone
+    Properties:
+      Name: example.com
+`), 0644)
+
+	detector, err := input.DetectorByInputTypes(input.Types{input.CloudFormation})
+	require.NoError(t, err)
+	loader := input.NewLoader(detector)
+	dir := &input.Directory{Fs: fs, Path: "stack"}
+	require.NoError(t, dir.Walk(func(d input.Detectable, depth int) (bool, error) {
+		return loader.Load(d, input.DetectOptions{})
+	}))
+
+	assert.Equal(t, 1, loader.Count())
+	states := loader.ToStates()
+	require.Len(t, states, 1)
+	assert.Contains(t, states[0].Resources["AWS::EC2::VPC"], "Network.Vpc")
+	assert.Len(t, states[0].Resources["AWS::EC2::VPC"], 1)
+	assert.Contains(t, states[0].Resources["AWS::Route53::HostedZone"], "Zones.Zone")
+	assert.Len(t, states[0].Resources["AWS::Route53::HostedZone"], 1)
+}
+
+func TestLoaderTerraformFiles(t *testing.T) {
+	// Only nested stacks are skipped, other inputs that are part of a loaded
+	// configuration can still be loaded on their own.
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "src/main.tf", []byte(`
+resource "aws_s3_bucket" "bucket" {
+  bucket_prefix = "bucket"
+}
+`), 0644)
+
+	detector, err := input.DetectorByInputTypes(input.Types{input.TerraformHCL})
+	require.NoError(t, err)
+	loader := input.NewLoader(detector)
+	loaded, err := loader.Load(&input.Directory{Fs: fs, Path: "src"}, input.DetectOptions{})
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	loaded, err = loader.Load(&input.File{Fs: fs, Path: "src/main.tf"}, input.DetectOptions{})
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, 2, loader.Count())
+}
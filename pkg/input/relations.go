@@ -0,0 +1,101 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/snyk/policy-engine/pkg/models"
+)
+
+// relation is an edge in the resource dependency graph: the attribute at
+// the given path in the "from" resource references the "to" resource.  Loaders
+// that are able to compute these store them in the state meta under
+// "relations", using relationsMeta.
+type relation struct {
+	from      string
+	to        string
+	attribute []interface{}
+}
+
+// relationsMeta converts relations to their representation in the state meta:
+//
+//     {
+//       "from": {"id": "aws_s3_bucket_policy.policy", "resource_type": "aws_s3_bucket_policy"},
+//       "to": {"id": "aws_s3_bucket.bucket", "resource_type": "aws_s3_bucket"},
+//       "attribute": ["bucket"]
+//     }
+//
+// Relations referring to resources that are not present are dropped, as are
+// duplicates and self-references.
+func relationsMeta(
+	resources map[string]map[string]models.ResourceState,
+	relations []relation,
+) []interface{} {
+	resourceTypes := map[string]string{}
+	for resourceType, byId := range resources {
+		for id := range byId {
+			resourceTypes[id] = resourceType
+		}
+	}
+
+	type edge struct {
+		relation
+		key string
+	}
+	edges := []edge{}
+	seen := map[string]struct{}{}
+	for _, r := range relations {
+		if r.from == r.to {
+			continue
+		}
+		if _, ok := resourceTypes[r.from]; !ok {
+			continue
+		}
+		if _, ok := resourceTypes[r.to]; !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s\x00%s\x00%v", r.from, r.to, r.attribute)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		edges = append(edges, edge{r, key})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].key < edges[j].key
+	})
+
+	meta := make([]interface{}, len(edges))
+	for i, e := range edges {
+		attribute := e.attribute
+		if attribute == nil {
+			attribute = []interface{}{}
+		}
+		meta[i] = map[string]interface{}{
+			"from": map[string]interface{}{
+				"id":            e.from,
+				"resource_type": resourceTypes[e.from],
+			},
+			"to": map[string]interface{}{
+				"id":            e.to,
+				"resource_type": resourceTypes[e.to],
+			},
+			"attribute": attribute,
+		}
+	}
+	return meta
+}
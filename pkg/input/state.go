@@ -0,0 +1,249 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/snyk/policy-engine/pkg/models"
+	"github.com/snyk/policy-engine/schemas"
+)
+
+// StateDetector loads documents in the policy engine's own state format, as
+// well as the input states embedded in results documents.  Documents are
+// validated against the JSON Schemas in the schemas directory.  Unlike the
+// other detectors, the input type and environment provider are taken from the
+// document.
+type StateDetector struct{}
+
+// The format and version of states, as set by all loaders.
+const (
+	stateFormat        = "state"
+	stateFormatVersion = "1.0.0"
+)
+
+type stateDocument struct {
+	Format string `json:"format"`
+}
+
+func (t *StateDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration, error) {
+	if !opts.IgnoreExt && i.Ext() != ".json" {
+		return nil, fmt.Errorf("%w: %v", UnrecognizedFileExtension, i.Ext())
+	}
+	contents, err := i.Contents()
+	if err != nil {
+		return nil, err
+	}
+	doc := stateDocument{}
+	if err := json.Unmarshal(contents, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
+	}
+
+	var schema *gojsonschema.Schema
+	switch doc.Format {
+	case "state":
+		schema, err = stateSchema()
+	case "results":
+		schema, err = resultsSchema()
+	default:
+		return nil, fmt.Errorf("%w", InvalidInput)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSchema(schema, contents); err != nil {
+		return nil, err
+	}
+
+	// sourcePaths holds the path to each state in the document.
+	states := []models.State{}
+	sourcePaths := [][]interface{}{}
+	if doc.Format == "state" {
+		state := models.State{}
+		if err := json.Unmarshal(contents, &state); err != nil {
+			return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
+		}
+		states = append(states, state)
+		sourcePaths = append(sourcePaths, []interface{}{})
+	} else {
+		results := models.Results{}
+		if err := json.Unmarshal(contents, &results); err != nil {
+			return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
+		}
+		for idx, result := range results.Results {
+			states = append(states, result.Input)
+			sourcePaths = append(sourcePaths, []interface{}{"results", idx, "input"})
+		}
+		if len(states) == 0 {
+			return nil, fmt.Errorf("%w: results do not contain any inputs", InvalidInput)
+		}
+	}
+
+	for idx := range states {
+		if states[idx].Meta == nil {
+			states[idx].Meta = map[string]interface{}{}
+		}
+		if _, ok := states[idx].Meta["filepath"]; !ok {
+			states[idx].Meta["filepath"] = i.Path
+		}
+		for _, resources := range states[idx].Resources {
+			for key, resource := range resources {
+				if resource.Meta == nil {
+					resource.Meta = map[string]interface{}{}
+					resources[key] = resource
+				}
+			}
+		}
+	}
+
+	// Don't consider source code locations essential.
+	source, _ := LoadSourceInfoNode(contents)
+
+	return &stateLoader{
+		path:        i.Path,
+		states:      states,
+		sourcePaths: sourcePaths,
+		source:      source,
+	}, nil
+}
+
+func (t *StateDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConfiguration, error) {
+	return nil, nil
+}
+
+var (
+	stateSchemaOnce sync.Once
+	stateSchemaVal  *gojsonschema.Schema
+	stateSchemaErr  error
+
+	resultsSchemaOnce sync.Once
+	resultsSchemaVal  *gojsonschema.Schema
+	resultsSchemaErr  error
+)
+
+func stateSchema() (*gojsonschema.Schema, error) {
+	stateSchemaOnce.Do(func() {
+		stateSchemaVal, stateSchemaErr = gojsonschema.NewSchema(
+			gojsonschema.NewBytesLoader(schemas.StateSchema),
+		)
+	})
+	return stateSchemaVal, stateSchemaErr
+}
+
+func resultsSchema() (*gojsonschema.Schema, error) {
+	resultsSchemaOnce.Do(func() {
+		// The results schema refers to the state schema by its ID.
+		loader := gojsonschema.NewSchemaLoader()
+		if err := loader.AddSchemas(gojsonschema.NewBytesLoader(schemas.StateSchema)); err != nil {
+			resultsSchemaErr = err
+			return
+		}
+		resultsSchemaVal, resultsSchemaErr = loader.Compile(
+			gojsonschema.NewBytesLoader(schemas.ResultsSchema),
+		)
+	})
+	return resultsSchemaVal, resultsSchemaErr
+}
+
+func validateSchema(schema *gojsonschema.Schema, contents []byte) error {
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(contents))
+	if err != nil {
+		return fmt.Errorf("%w: %v", FailedToParseInput, err)
+	}
+	if !result.Valid() {
+		messages := []string{}
+		for _, e := range result.Errors() {
+			messages = append(messages, e.String())
+		}
+		return fmt.Errorf("%w: %s", InvalidInput, strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+type stateLoader struct {
+	path        string
+	states      []models.State
+	sourcePaths [][]interface{}
+	source      *SourceInfoNode
+}
+
+func (l *stateLoader) LoadedFiles() []string {
+	return []string{l.path}
+}
+
+func (l *stateLoader) Location(path []interface{}) (LocationStack, error) {
+	// Format is {resourceNamespace, resourceType, resourceId, attributePath...}
+	// Resources are keyed by resource type and resource key, which does not
+	// need to be equal to the ID, so we need to look them up first.
+	if l.source == nil || len(path) < 3 {
+		return nil, nil
+	}
+
+	resourceNamespace, ok1 := path[0].(string)
+	resourceType, ok2 := path[1].(string)
+	resourceId, ok3 := path[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf(
+			"%w: Expected string resource namespace, type and ID in path: %v",
+			UnableToResolveLocation,
+			path,
+		)
+	}
+
+	for idx, state := range l.states {
+		for key, resource := range state.Resources[resourceType] {
+			if resource.Id != resourceId || resource.Namespace != resourceNamespace {
+				continue
+			}
+			fullPath := []interface{}{}
+			fullPath = append(fullPath, l.sourcePaths[idx]...)
+			fullPath = append(fullPath, "resources", resourceType, key)
+			if len(path) > 3 {
+				fullPath = append(fullPath, "attributes")
+				fullPath = append(fullPath, path[3:]...)
+			}
+			node, err := l.source.GetPath(fullPath)
+			line, column := node.Location()
+			return []Location{{Path: l.path, Line: line, Col: column}}, err
+		}
+	}
+
+	return nil, fmt.Errorf(
+		"%w: Unable to find resource with ID: %s",
+		UnableToResolveLocation,
+		resourceId,
+	)
+}
+
+func (l *stateLoader) ToState() models.State {
+	return l.states[0]
+}
+
+func (l *stateLoader) ToStates() []models.State {
+	return l.states
+}
+
+func (l *stateLoader) Errors() []error {
+	return []error{}
+}
+
+func (l *stateLoader) Type() *Type {
+	return State
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/snyk/policy-engine/pkg/engine"
+	"github.com/snyk/policy-engine/pkg/input"
+	"github.com/snyk/policy-engine/pkg/models"
+)
+
+func TestStateDetectorResults(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/main.tf", []byte(`resource "aws_s3_bucket" "logs" {
+  bucket = "logs"
+}
+`), 0644)
+	afero.WriteFile(fs, "/pod.yaml", []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  containers:
+  - name: web
+    image: nginx
+`), 0644)
+
+	// Evaluate the inputs and feed the engine's output back into the
+	// detector, so the results are those the run command would write.
+	tf, err := (&input.TfDetector{}).DetectFile(&input.File{Fs: fs, Path: "/main.tf"}, input.DetectOptions{})
+	require.NoError(t, err)
+	k8s, err := (&input.KubernetesDetector{}).DetectFile(&input.File{Fs: fs, Path: "/pod.yaml"}, input.DetectOptions{})
+	require.NoError(t, err)
+	ctx := context.Background()
+	eng, err := engine.NewEngine(ctx, &engine.EngineOptions{})
+	require.NoError(t, err)
+	results := eng.Eval(ctx, &engine.EvalOptions{
+		Inputs: []models.State{tf.ToState(), k8s.ToState()},
+	})
+	bytes, err := json.MarshalIndent(results, "", "  ")
+	require.NoError(t, err)
+	afero.WriteFile(fs, "/results.json", bytes, 0644)
+
+	detector := &input.StateDetector{}
+	conf, err := detector.DetectFile(&input.File{Fs: fs, Path: "/results.json"}, input.DetectOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, conf)
+	assert.Equal(t, input.State, conf.Type())
+
+	multi, ok := conf.(input.MultiStateConfiguration)
+	require.True(t, ok)
+	states := multi.ToStates()
+	require.Len(t, states, 2)
+	assert.Equal(t, "tf_hcl", states[0].InputType)
+	assert.Equal(t, "/main.tf", states[0].Meta["filepath"])
+	assert.Equal(t, "k8s", states[1].InputType)
+	assert.Equal(t, "/pod.yaml", states[1].Meta["filepath"])
+
+	// Locations point to the attribute in the results document.
+	lines := strings.Split(string(bytes), "\n")
+	line, col := 0, 0
+	for i, l := range lines {
+		if c := strings.Index(l, `"bucket": "logs"`); c >= 0 {
+			line, col = i+1, c+1
+			break
+		}
+	}
+	require.NotZero(t, line)
+	location, err := conf.Location([]interface{}{"/main.tf", "aws_s3_bucket", "aws_s3_bucket.logs", "bucket"})
+	require.NoError(t, err)
+	assert.Equal(t, input.LocationStack{{Path: "/results.json", Line: line, Col: col}}, location)
+}
+
+func TestStateDetectorInvalid(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/state.json", []byte(`{
+  "format": "state",
+  "format_version": "1.0.0",
+  "input_type": "cloud_scan",
+  "resources": {
+    "aws_s3_bucket": {
+      "logs": {"id": "logs", "attributes": {}}
+    }
+  }
+}`), 0644)
+	afero.WriteFile(fs, "/other.json", []byte(`{"resources": {}}`), 0644)
+
+	detector := &input.StateDetector{}
+	_, err := detector.DetectFile(&input.File{Fs: fs, Path: "/state.json"}, input.DetectOptions{})
+	assert.ErrorIs(t, err, input.InvalidInput)
+	assert.Contains(t, err.Error(), "environment_provider is required")
+	assert.Contains(t, err.Error(), "resource_type is required")
+
+	_, err = detector.DetectFile(&input.File{Fs: fs, Path: "/other.json"}, input.DetectOptions{})
+	assert.ErrorIs(t, err, input.InvalidInput)
+}
@@ -75,10 +75,14 @@ func (t *StreamlinedStateDetector) DetectFile(i *File, opts DetectOptions) (IACC
 		}
 	}
 
+	// Don't consider source code locations essential.
+	source, _ := LoadSourceInfoNode(contents)
+
 	return &streamlinedStateLoader{
 		path:                i.Path,
 		environmentProvider: environmentProvider,
 		resourcesByType:     resourcesByType,
+		source:              source,
 	}, nil
 }
 
@@ -90,24 +94,66 @@ type streamlinedStateLoader struct {
 	path                string
 	environmentProvider string
 	resourcesByType     map[string]map[string]models.ResourceState
+	source              *SourceInfoNode
 }
 
 func (l *streamlinedStateLoader) LoadedFiles() []string {
 	return []string{l.path}
 }
 
-func (l *streamlinedStateLoader) Location(attributePath []interface{}) (LocationStack, error) {
-	return nil, nil
+func (l *streamlinedStateLoader) Location(path []interface{}) (LocationStack, error) {
+	// Format is {resourceNamespace, resourceType, resourceId, attributePath...}
+	// Resources are keyed by their resource key rather than their ID, so we
+	// need to look them up first.
+	if l.source == nil || len(path) < 3 {
+		return nil, nil
+	}
+
+	resourceType, ok1 := path[1].(string)
+	resourceId, ok2 := path[2].(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf(
+			"%w: Expected string resource type and ID in path: %v",
+			UnableToResolveLocation,
+			path,
+		)
+	}
+
+	resourceKey := ""
+	for key, resource := range l.resourcesByType[resourceType] {
+		if resource.Id == resourceId {
+			resourceKey = key
+			break
+		}
+	}
+	if resourceKey == "" {
+		return nil, fmt.Errorf(
+			"%w: Unable to find resource with ID: %s",
+			UnableToResolveLocation,
+			resourceId,
+		)
+	}
+
+	fullPath := []interface{}{"resources", resourceKey}
+	fullPath = append(fullPath, path[3:]...)
+	node, err := l.source.GetPath(fullPath)
+	line, column := node.Location()
+	return []Location{{Path: l.path, Line: line, Col: column}}, err
 }
 
 func (l *streamlinedStateLoader) ToState() models.State {
 	return models.State{
+		Format:        stateFormat,
+		FormatVersion: stateFormatVersion,
 		// Note that this is outputting the CloudScan input type, because this type is
 		// intended to be a stand-in for cloud scan until we're able to produce cloud
 		// scan inputs without using the streamlined state format.
 		InputType:           CloudScan.Name,
 		EnvironmentProvider: l.environmentProvider,
-		Resources:           l.resourcesByType,
+		Meta: map[string]interface{}{
+			"filepath": l.path,
+		},
+		Resources: l.resourcesByType,
 	}
 }
 
@@ -0,0 +1,164 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/snyk/policy-engine/pkg/hcl_interpreter"
+	"github.com/snyk/policy-engine/pkg/models"
+	"github.com/spf13/afero"
+)
+
+// TerragruntDetector loads `terragrunt.hcl` files.  The Terragrunt
+// configuration is evaluated to find the Terraform module and its inputs, and
+// the module is then evaluated like a regular Terraform configuration.
+type TerragruntDetector struct {
+	// ModuleResolver is an optional resolver that is used to fetch remote
+	// modules called by the Terraform module.
+	ModuleResolver hcl_interpreter.ModuleResolver
+}
+
+func (t *TerragruntDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration, error) {
+	if !opts.IgnoreExt && filepath.Base(i.Path) != hcl_interpreter.TerragruntFilename {
+		return nil, fmt.Errorf("%w: %v", UnrecognizedFileExtension, i.Ext())
+	}
+	return t.detect(i.Fs, i.Path, i.Path, opts)
+}
+
+func (t *TerragruntDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConfiguration, error) {
+	path := filepath.Join(i.Path, hcl_interpreter.TerragruntFilename)
+	if exists, err := afero.Exists(i.Fs, path); err != nil || !exists {
+		return nil, nil
+	}
+	return t.detect(i.Fs, i.Path, path, opts)
+}
+
+func (t *TerragruntDetector) detect(
+	fs afero.Fs,
+	inputPath string,
+	path string,
+	opts DetectOptions,
+) (IACConfiguration, error) {
+	terragrunt, err := hcl_interpreter.ParseTerragrunt(fs, path, opts.Env)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
+	}
+
+	// Configurations that are only included by others, such as a root
+	// terragrunt.hcl, do not have a module.
+	tfExists := false
+	entries, err := afero.ReadDir(fs, terragrunt.ModuleDir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", UnableToReadDir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".tf" {
+			tfExists = true
+		}
+	}
+	if !tfExists {
+		return nil, nil
+	}
+
+	moduleRegister := hcl_interpreter.NewTerraformRegister(fs, terragrunt.ModuleDir)
+	moduleRegister.Resolver = t.ModuleResolver
+	configuration, err := detectHcl(opts, func(inputs hcl_interpreter.VariableInputs) (*hcl_interpreter.ModuleTree, error) {
+		inputs.Values = terragrunt.Inputs
+		return hcl_interpreter.ParseDirectory(moduleRegister, fs, terragrunt.ModuleDir, inputs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TerragruntConfiguration{
+		configuration: configuration,
+		path:          inputPath,
+		terragrunt:    terragrunt,
+	}, nil
+}
+
+// TerragruntConfiguration wraps the configuration of the Terraform module
+// used by a Terragrunt configuration.  The states are regular TerraformHCL
+// states, but they use the path of the Terragrunt configuration and record
+// it in `meta.terragrunt`.
+type TerragruntConfiguration struct {
+	configuration IACConfiguration
+	path          string
+	terragrunt    *hcl_interpreter.TerragruntConfig
+}
+
+func (c *TerragruntConfiguration) ToState() models.State {
+	return c.annotate(c.configuration.ToState())
+}
+
+func (c *TerragruntConfiguration) ToStates() []models.State {
+	multi, ok := c.configuration.(MultiStateConfiguration)
+	if !ok {
+		return []models.State{c.ToState()}
+	}
+	states := multi.ToStates()
+	for i := range states {
+		states[i] = c.annotate(states[i])
+	}
+	return states
+}
+
+func (c *TerragruntConfiguration) annotate(state models.State) models.State {
+	includes := []interface{}{}
+	for _, include := range c.terragrunt.Includes {
+		includes = append(includes, include)
+	}
+	terragrunt := map[string]interface{}{
+		"filepath":   c.terragrunt.Path,
+		"module_dir": c.terragrunt.ModuleDir,
+		"includes":   includes,
+	}
+	if c.terragrunt.Source != "" {
+		terragrunt["source"] = c.terragrunt.Source
+	}
+	state.Meta["filepath"] = c.path
+	state.Meta["terragrunt"] = terragrunt
+	state.Scope["filepath"] = c.path
+
+	for resourceType, resources := range state.Resources {
+		for id, resource := range resources {
+			resource.Namespace = c.path
+			state.Resources[resourceType][id] = resource
+		}
+	}
+	return state
+}
+
+func (c *TerragruntConfiguration) LoadedFiles() []string {
+	files := []string{c.terragrunt.Path}
+	files = append(files, c.terragrunt.Includes...)
+	return append(files, c.configuration.LoadedFiles()...)
+}
+
+func (c *TerragruntConfiguration) Location(path []interface{}) (LocationStack, error) {
+	return c.configuration.Location(path)
+}
+
+func (c *TerragruntConfiguration) Errors() []error {
+	errors := []error{}
+	errors = append(errors, c.terragrunt.Errors...)
+	return append(errors, c.configuration.Errors()...)
+}
+
+func (c *TerragruntConfiguration) Type() *Type {
+	return Terragrunt
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input_test
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/snyk/policy-engine/pkg/input"
+)
+
+func TestTerragruntDetector(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/repo/live/terragrunt.hcl", []byte(`
+locals {
+  region = get_env("AWS_REGION", "us-east-1")
+}
+inputs = {
+  region = local.region
+  acl    = "private"
+}
+`), 0644)
+	afero.WriteFile(fs, "/repo/live/prod/bucket/terragrunt.hcl", []byte(`
+include {
+  path = find_in_parent_folders()
+}
+terraform {
+  source = "../../../modules/bucket"
+}
+inputs = {
+  acl    = "public-read"
+  bucket = path_relative_to_include()
+}
+`), 0644)
+	afero.WriteFile(fs, "/repo/modules/bucket/main.tf", []byte(`
+variable "acl" {}
+variable "bucket" {}
+variable "region" {}
+resource "aws_s3_bucket" "bucket" {
+  acl    = var.acl
+  bucket = "${var.bucket}-${var.region}"
+}
+`), 0644)
+
+	detector := &input.TerragruntDetector{}
+	opts := input.DetectOptions{Env: []string{"AWS_REGION=eu-west-1"}}
+
+	// The root configuration has no module of its own.
+	conf, err := detector.DetectDirectory(&input.Directory{Fs: fs, Path: "/repo/live"}, opts)
+	require.NoError(t, err)
+	assert.Nil(t, conf)
+
+	conf, err = detector.DetectDirectory(&input.Directory{Fs: fs, Path: "/repo/live/prod/bucket"}, opts)
+	require.NoError(t, err)
+	require.NotNil(t, conf)
+	assert.Equal(t, input.Terragrunt, conf.Type())
+	assert.Empty(t, conf.Errors())
+	assert.Contains(t, conf.LoadedFiles(), "/repo/live/terragrunt.hcl")
+	assert.Contains(t, conf.LoadedFiles(), "/repo/modules/bucket/main.tf")
+
+	state := conf.ToState()
+	assert.Equal(t, input.TerraformHCL.Name, state.InputType)
+	assert.Equal(t, "/repo/live/prod/bucket", state.Scope["filepath"])
+	assert.Equal(t, "/repo/modules/bucket", state.Meta["terragrunt"].(map[string]interface{})["module_dir"])
+	bucket := state.Resources["aws_s3_bucket"]["aws_s3_bucket.bucket"]
+	assert.Equal(t, "/repo/live/prod/bucket", bucket.Namespace)
+	assert.Equal(t, map[string]interface{}{
+		"acl":    "public-read",
+		"bucket": "prod/bucket-eu-west-1",
+	}, bucket.Attributes)
+}
+
+func TestTerragruntDetectorMultipleIncludes(t *testing.T) {
+	// Paths are relative, and resolved relative to the configuration rather
+	// than to the working directory.  Functions return paths relative to the
+	// configuration as well.
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "repo/root.hcl", []byte(`
+inputs = {
+  bucket = path_relative_to_include()
+}
+`), 0644)
+	afero.WriteFile(fs, "repo/live/env.hcl", []byte(`
+inputs = {
+  env_dir = get_parent_terragrunt_dir()
+}
+`), 0644)
+	afero.WriteFile(fs, "repo/live/prod/bucket/terragrunt.hcl", []byte(`
+include "root" {
+  path = find_in_parent_folders("root.hcl")
+}
+include "env" {
+  path = find_in_parent_folders("env.hcl")
+}
+terraform {
+  source = "../../../modules/bucket"
+}
+inputs = {
+  acl      = path_relative_to_include("env")
+  root_dir = get_parent_terragrunt_dir("root")
+}
+`), 0644)
+	afero.WriteFile(fs, "repo/modules/bucket/main.tf", []byte(`
+variable "acl" {}
+variable "bucket" {}
+variable "env_dir" {}
+variable "root_dir" {}
+resource "aws_s3_bucket" "bucket" {
+  acl    = var.acl
+  bucket = var.bucket
+  tags = {
+    env_dir  = var.env_dir
+    root_dir = var.root_dir
+  }
+}
+`), 0644)
+
+	detector := &input.TerragruntDetector{}
+	conf, err := detector.DetectDirectory(&input.Directory{Fs: fs, Path: "repo/live/prod/bucket"}, input.DetectOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, conf)
+	assert.Empty(t, conf.Errors())
+	assert.Contains(t, conf.LoadedFiles(), "repo/root.hcl")
+	assert.Contains(t, conf.LoadedFiles(), "repo/live/env.hcl")
+
+	state := conf.ToState()
+	assert.Equal(t, "repo/modules/bucket", state.Meta["terragrunt"].(map[string]interface{})["module_dir"])
+	bucket := state.Resources["aws_s3_bucket"]["aws_s3_bucket.bucket"]
+	assert.Equal(t, map[string]interface{}{
+		"acl":    "prod/bucket",
+		"bucket": "live/prod/bucket",
+		"tags": map[string]interface{}{
+			"env_dir":  "../..",
+			"root_dir": "../../..",
+		},
+	}, bucket.Attributes)
+}
+
+func TestTerragruntDetectorRemoteSource(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/repo/terragrunt.hcl", []byte(`
+terraform {
+  source = "git::https://example.com/modules.git//vpc?ref=v1.0.0"
+}
+`), 0644)
+
+	detector := &input.TerragruntDetector{}
+	_, err := detector.DetectFile(&input.File{Fs: fs, Path: "/repo/terragrunt.hcl"}, input.DetectOptions{})
+	assert.ErrorIs(t, err, input.FailedToParseInput)
+}
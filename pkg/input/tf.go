@@ -18,6 +18,7 @@ package input
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/snyk/policy-engine/pkg/hcl_interpreter"
 	"github.com/snyk/policy-engine/pkg/models"
@@ -27,19 +28,21 @@ import (
 // files.  The implementation is in the `./pkg/hcl_interpreter/` package in this
 // repository: this file just wraps that.  That directory also contains a
 // README explaining how everything fits together.
-type TfDetector struct{}
+type TfDetector struct {
+	// ModuleResolver is an optional resolver that is used to fetch remote
+	// modules that were not installed using `terraform init`.  Without one,
+	// these modules are skipped.
+	ModuleResolver hcl_interpreter.ModuleResolver
+}
 
 func (t *TfDetector) DetectFile(i *File, opts DetectOptions) (IACConfiguration, error) {
 	if !opts.IgnoreExt && i.Ext() != ".tf" {
 		return nil, fmt.Errorf("%w: %v", UnrecognizedFileExtension, i.Ext())
 	}
 	dir := filepath.Dir(i.Path)
-	moduleTree, err := hcl_interpreter.ParseFiles(nil, i.Fs, false, dir, []string{i.Path}, opts.VarFiles)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
-	}
-
-	return newHclConfiguration(moduleTree)
+	return detectHcl(opts, func(inputs hcl_interpreter.VariableInputs) (*hcl_interpreter.ModuleTree, error) {
+		return hcl_interpreter.ParseFiles(nil, i.Fs, false, dir, []string{i.Path}, inputs)
+	})
 }
 
 func (t *TfDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConfiguration, error) {
@@ -59,23 +62,87 @@ func (t *TfDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConfi
 	}
 
 	moduleRegister := hcl_interpreter.NewTerraformRegister(i.Fs, i.Path)
-	moduleTree, err := hcl_interpreter.ParseDirectory(moduleRegister, i.Fs, i.Path, opts.VarFiles)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
+	moduleRegister.Resolver = t.ModuleResolver
+	return detectHcl(opts, func(inputs hcl_interpreter.VariableInputs) (*hcl_interpreter.ModuleTree, error) {
+		return hcl_interpreter.ParseDirectory(moduleRegister, i.Fs, i.Path, inputs)
+	})
+}
+
+// detectHcl parses and evaluates a configuration once, or once per variable
+// set if any are given.
+func detectHcl(
+	opts DetectOptions,
+	parse func(hcl_interpreter.VariableInputs) (*hcl_interpreter.ModuleTree, error),
+) (IACConfiguration, error) {
+	if len(opts.VariableSets) == 0 {
+		moduleTree, err := parse(variableInputs(opts))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", FailedToParseInput, err)
+		}
+		return newHclConfiguration(moduleTree, evaluationOptions(opts), "")
+	}
+
+	configurations := []*HclConfiguration{}
+	for _, set := range opts.VariableSets {
+		inputs := variableInputs(opts)
+		inputs.VarFiles = append(append([]string{}, opts.VarFiles...), set.VarFiles...)
+		inputs.Vars = append(append([]string{}, opts.Vars...), set.Vars...)
+		moduleTree, err := parse(inputs)
+		if err != nil {
+			return nil, fmt.Errorf("%w: variable set '%s': %v", FailedToParseInput, set.Name, err)
+		}
+		configuration, err := newHclConfiguration(moduleTree, evaluationOptions(opts), set.Name)
+		if err != nil {
+			return nil, err
+		}
+		configurations = append(configurations, configuration)
+	}
+	return &HclVariableSetsConfiguration{configurations}, nil
+}
+
+func variableInputs(opts DetectOptions) hcl_interpreter.VariableInputs {
+	return hcl_interpreter.VariableInputs{
+		VarFiles: opts.VarFiles,
+		Vars:     opts.Vars,
+		Env:      opts.Env,
 	}
+}
 
-	return newHclConfiguration(moduleTree)
+func evaluationOptions(opts DetectOptions) hcl_interpreter.EvaluationOptions {
+	workspace := opts.Workspace
+	if workspace == "" {
+		for _, kv := range opts.Env {
+			if strings.HasPrefix(kv, tfWorkspaceEnv+"=") {
+				workspace = strings.TrimPrefix(kv, tfWorkspaceEnv+"=")
+			}
+		}
+	}
+	return hcl_interpreter.EvaluationOptions{
+		Workspace: workspace,
+		PathRoot:  opts.PathRoot,
+		PathCwd:   opts.PathCwd,
+	}
 }
 
+// Environment variable that selects the workspace, like in terraform.
+const tfWorkspaceEnv = "TF_WORKSPACE"
+
 type HclConfiguration struct {
 	moduleTree *hcl_interpreter.ModuleTree
 	evaluation *hcl_interpreter.Evaluation
 	resources  map[string]map[string]models.ResourceState
+
+	// Name of the variable set used to evaluate this configuration, if any.
+	variableSet string
 }
 
-func newHclConfiguration(moduleTree *hcl_interpreter.ModuleTree) (*HclConfiguration, error) {
+func newHclConfiguration(
+	moduleTree *hcl_interpreter.ModuleTree,
+	options hcl_interpreter.EvaluationOptions,
+	variableSet string,
+) (*HclConfiguration, error) {
 	analysis := hcl_interpreter.AnalyzeModuleTree(moduleTree)
-	evaluation, err := hcl_interpreter.EvaluateAnalysis(analysis)
+	evaluation, err := hcl_interpreter.EvaluateAnalysis(analysis, options)
 	if err != nil {
 		return nil, err
 	}
@@ -87,9 +154,10 @@ func newHclConfiguration(moduleTree *hcl_interpreter.ModuleTree) (*HclConfigurat
 	}
 
 	return &HclConfiguration{
-		moduleTree: moduleTree,
-		evaluation: evaluation,
-		resources:  groupResourcesByType(resources),
+		moduleTree:  moduleTree,
+		evaluation:  evaluation,
+		resources:   groupResourcesByType(resources),
+		variableSet: variableSet,
 	}, nil
 }
 
@@ -121,16 +189,43 @@ func (c *HclConfiguration) Location(path []interface{}) (LocationStack, error) {
 }
 
 func (c *HclConfiguration) ToState() models.State {
+	meta := map[string]interface{}{
+		"filepath": c.moduleTree.FilePath(),
+	}
+	scope := map[string]interface{}{
+		"filepath": c.moduleTree.FilePath(),
+	}
+	tfmeta := map[string]interface{}{
+		"workspace": c.evaluation.Options.Workspace,
+		"path": map[string]interface{}{
+			"root": c.evaluation.Options.PathRoot,
+			"cwd":  c.evaluation.Options.PathCwd,
+		},
+	}
+	if unset := c.moduleTree.UnsetVariables(); len(unset) > 0 {
+		tfmeta["unset_variables"] = unset
+	}
+	if c.variableSet != "" {
+		tfmeta["variable_set"] = c.variableSet
+		scope["variable_set"] = c.variableSet
+	}
+	meta["terraform"] = tfmeta
+	relations := []relation{}
+	for _, r := range c.evaluation.Analysis.Relations() {
+		relations = append(relations, relation{r.From, r.To, r.Attribute})
+	}
+	if edges := relationsMeta(c.resources, relations); len(edges) > 0 {
+		meta["relations"] = edges
+	}
+
 	return models.State{
+		Format:              stateFormat,
+		FormatVersion:       stateFormatVersion,
 		InputType:           TerraformHCL.Name,
 		EnvironmentProvider: "iac",
-		Meta: map[string]interface{}{
-			"filepath": c.moduleTree.FilePath(),
-		},
-		Resources: c.resources,
-		Scope: map[string]interface{}{
-			"filepath": c.moduleTree.FilePath(),
-		},
+		Meta:                meta,
+		Resources:           c.resources,
+		Scope:               scope,
 	}
 }
 
@@ -144,3 +239,68 @@ func (c *HclConfiguration) Errors() []error {
 func (l *HclConfiguration) Type() *Type {
 	return TerraformHCL
 }
+
+// HclVariableSetsConfiguration is a Terraform configuration that was evaluated
+// for several variable sets.  It produces one State per set.
+type HclVariableSetsConfiguration struct {
+	configurations []*HclConfiguration
+}
+
+// ToState returns the State for the first variable set.  Use ToStates to
+// obtain all of them.
+func (c *HclVariableSetsConfiguration) ToState() models.State {
+	return c.configurations[0].ToState()
+}
+
+func (c *HclVariableSetsConfiguration) ToStates() []models.State {
+	states := make([]models.State, len(c.configurations))
+	for i, configuration := range c.configurations {
+		states[i] = configuration.ToState()
+	}
+	return states
+}
+
+func (c *HclVariableSetsConfiguration) LoadedFiles() []string {
+	seen := map[string]struct{}{}
+	files := []string{}
+	for _, configuration := range c.configurations {
+		for _, file := range configuration.LoadedFiles() {
+			if _, ok := seen[file]; !ok {
+				seen[file] = struct{}{}
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+// Location resolves locations using the first variable set that has the
+// resource.  The source code is the same for all sets, but the resources that
+// are present may differ, e.g. due to count.
+func (c *HclVariableSetsConfiguration) Location(path []interface{}) (LocationStack, error) {
+	for _, configuration := range c.configurations {
+		locs, err := configuration.Location(path)
+		if err != nil || len(locs) > 0 {
+			return locs, err
+		}
+	}
+	return nil, nil
+}
+
+func (c *HclVariableSetsConfiguration) Errors() []error {
+	errors := []error{}
+	for _, configuration := range c.configurations {
+		for _, err := range configuration.Errors() {
+			errors = append(errors, fmt.Errorf(
+				"variable set '%s': %w",
+				configuration.variableSet,
+				err,
+			))
+		}
+	}
+	return errors
+}
+
+func (c *HclVariableSetsConfiguration) Type() *Type {
+	return TerraformHCL
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input_test
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/snyk/policy-engine/pkg/input"
+)
+
+func TestTfDetectorVariableSets(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "src/main.tf", []byte(`
+variable "acl" {}
+resource "aws_s3_bucket" "bucket" {
+  acl = var.acl
+}
+`), 0644)
+	afero.WriteFile(fs, "dev.tfvars", []byte(`acl = "private"`), 0644)
+	afero.WriteFile(fs, "prod.tfvars", []byte(`acl = "public-read"`), 0644)
+
+	loader := input.NewLoader(&input.TfDetector{})
+	loaded, err := loader.Load(&input.Directory{Fs: fs, Path: "src"}, input.DetectOptions{
+		VariableSets: []input.VariableSet{
+			{Name: "dev", VarFiles: []string{"dev.tfvars"}},
+			{Name: "prod", VarFiles: []string{"prod.tfvars"}},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, loaded)
+
+	states := loader.ToStates()
+	require.Len(t, states, 2)
+	acls := map[string]interface{}{}
+	for _, state := range states {
+		set := state.Scope["variable_set"].(string)
+		assert.Equal(t, set, state.Meta["terraform"].(map[string]interface{})["variable_set"])
+		bucket := state.Resources["aws_s3_bucket"]["aws_s3_bucket.bucket"]
+		acls[set] = bucket.Attributes["acl"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"dev":  "private",
+		"prod": "public-read",
+	}, acls)
+}
+
+func TestTfDetectorWorkspaceAndPaths(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "src/main.tf", []byte(`
+module "child" {
+  source = "./child"
+}
+`), 0644)
+	afero.WriteFile(fs, "src/child/main.tf", []byte(`
+resource "aws_s3_bucket" "bucket" {
+  count  = terraform.workspace == "prod" ? 1 : 0
+  bucket = "${path.root}:${path.module}:${path.cwd}"
+}
+`), 0644)
+
+	detector := &input.TfDetector{}
+	configuration, err := detector.DetectDirectory(
+		&input.Directory{Fs: fs, Path: "src"},
+		input.DetectOptions{Env: []string{"TF_WORKSPACE=dev"}},
+	)
+	require.NoError(t, err)
+	state := configuration.ToState()
+	assert.Empty(t, state.Resources["aws_s3_bucket"])
+	assert.Equal(t, "dev", state.Meta["terraform"].(map[string]interface{})["workspace"])
+
+	configuration, err = detector.DetectDirectory(
+		&input.Directory{Fs: fs, Path: "src"},
+		input.DetectOptions{
+			Env:       []string{"TF_WORKSPACE=dev"},
+			Workspace: "prod",
+			PathCwd:   "/work",
+		},
+	)
+	require.NoError(t, err)
+	state = configuration.ToState()
+	bucket := state.Resources["aws_s3_bucket"]["module.child.aws_s3_bucket.bucket"]
+	assert.Equal(t, "src:src/child:/work", bucket.Attributes["bucket"])
+	assert.Equal(t, map[string]interface{}{
+		"workspace": "prod",
+		"path": map[string]interface{}{
+			"root": "src",
+			"cwd":  "/work",
+		},
+	}, state.Meta["terraform"])
+}
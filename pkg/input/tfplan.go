@@ -20,8 +20,10 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/snyk/policy-engine/pkg/hcl_interpreter"
 	"github.com/snyk/policy-engine/pkg/interfacetricks"
 	"github.com/snyk/policy-engine/pkg/models"
+	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
 
@@ -45,12 +47,43 @@ func (t *TfPlanDetector) DetectFile(i *File, opts DetectOptions) (IACConfigurati
 		return nil, fmt.Errorf("%w", InvalidInput)
 	}
 
+	// Don't consider source code locations essential.
+	source, _ := LoadSourceInfoNode(contents)
+	var configuration *HclConfiguration
+	if opts.PlanConfigurationDir != "" {
+		configuration = tfPlanConfiguration(i.Fs, opts)
+	}
+
 	return &tfPlan{
-		path: i.Path,
-		plan: rawPlan,
+		path:          i.Path,
+		plan:          rawPlan,
+		source:        source,
+		resourcePaths: rawPlan.resourcePaths(),
+		configuration: configuration,
 	}, nil
 }
 
+// tfPlanConfiguration loads the Terraform configuration that a plan was
+// generated from.  This is only used for source locations, so errors are
+// ignored.
+func tfPlanConfiguration(fs afero.Fs, opts DetectOptions) *HclConfiguration {
+	moduleRegister := hcl_interpreter.NewTerraformRegister(fs, opts.PlanConfigurationDir)
+	moduleTree, err := hcl_interpreter.ParseDirectory(
+		moduleRegister,
+		fs,
+		opts.PlanConfigurationDir,
+		variableInputs(opts),
+	)
+	if err != nil {
+		return nil
+	}
+	configuration, err := newHclConfiguration(moduleTree, evaluationOptions(opts), "")
+	if err != nil {
+		return nil
+	}
+	return configuration
+}
+
 func (t *TfPlanDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConfiguration, error) {
 	return nil, nil
 }
@@ -58,24 +91,110 @@ func (t *TfPlanDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACC
 type tfPlan struct {
 	path string
 	plan *tfplan_Plan
+
+	// source and resourcePaths are used to find the locations of resources
+	// and attributes in the JSON plan.
+	source        *SourceInfoNode
+	resourcePaths map[string][]interface{}
+
+	// configuration is the Terraform configuration the plan was generated
+	// from, if it is available.  It takes precedence for source locations.
+	configuration *HclConfiguration
 }
 
 func (l *tfPlan) LoadedFiles() []string {
 	return []string{l.path}
 }
 
-func (l *tfPlan) Location(_ []interface{}) (LocationStack, error) {
-	return []Location{{Path: l.path}}, nil
+func (l *tfPlan) Location(path []interface{}) (LocationStack, error) {
+	// Format is {resourceNamespace, resourceType, resourceId, attributePath...}
+	if len(path) < 3 {
+		return []Location{{Path: l.path}}, nil
+	}
+
+	resourceId, ok := path[2].(string)
+	if !ok {
+		return nil, fmt.Errorf(
+			"%w: Expected string resource ID in path: %v",
+			UnableToResolveLocation,
+			path,
+		)
+	}
+
+	// Addresses of instances in the plan include index keys, such as
+	// `module.child["a"].aws_s3_bucket.bucket[0]`, but the configuration only
+	// has the resource itself.
+	if l.configuration != nil {
+		configurationPath := []interface{}{path[0], path[1], tfplanConfigurationAddress(resourceId)}
+		configurationPath = append(configurationPath, path[3:]...)
+		if locs, err := l.configuration.Location(configurationPath); err == nil && len(locs) > 0 {
+			return locs, nil
+		}
+	}
+
+	resourcePath, ok := l.resourcePaths[resourceId]
+	if !ok || l.source == nil {
+		return []Location{{Path: l.path}}, nil
+	}
+
+	fullPath := make([]interface{}, len(resourcePath))
+	copy(fullPath, resourcePath)
+	if len(path) > 3 {
+		fullPath = append(fullPath, "values")
+		fullPath = append(fullPath, path[3:]...)
+	}
+	node, err := l.source.GetPath(fullPath)
+	line, column := node.Location()
+	return []Location{{Path: l.path, Line: line, Col: column}}, err
+}
+
+// tfplanConfigurationAddress strips the index keys from a resource instance
+// address.
+func tfplanConfigurationAddress(address string) string {
+	var builder strings.Builder
+	depth := 0
+	inString := false
+	for i := 0; i < len(address); i++ {
+		c := address[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"' && depth > 0:
+			inString = true
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
 }
 
 func (l *tfPlan) ToState() models.State {
+	resources := groupResourcesByType(l.plan.resources(l.path))
+	meta := map[string]interface{}{
+		"filepath": l.path,
+	}
+	if edges := relationsMeta(resources, l.plan.relations()); len(edges) > 0 {
+		meta["relations"] = edges
+	}
+	if tfplanMeta := l.plan.meta(); len(tfplanMeta) > 0 {
+		meta["tfplan"] = tfplanMeta
+	}
+
 	return models.State{
+		Format:              stateFormat,
+		FormatVersion:       stateFormatVersion,
 		InputType:           TerraformPlan.Name,
 		EnvironmentProvider: "iac",
-		Meta: map[string]interface{}{
-			"filepath": l.path,
-		},
-		Resources: groupResourcesByType(l.plan.resources(l.path)),
+		Meta:                meta,
+		Resources:           resources,
 		Scope: map[string]interface{}{
 			"filepath": l.path,
 		},
@@ -93,18 +212,31 @@ func (l *tfPlan) Type() *Type {
 // This (among with other types prefixed with tfplan_) matches the JSON
 // format exactly.
 type tfplan_Plan struct {
-	TerraformVersion string                   `yaml:"terraform_version"`
-	FormatVersion    string                   `yaml:"format_version"`
-	PlannedValues    *tfplan_PlannedValues    `yaml:"planned_values"`
-	ResourceChanges  []*tfplan_ResourceChange `yaml:"resource_changes"`
-	Configuration    *tfplan_Configuration    `yaml:"configuration"`
-	PriorState       *tfplan_PriorState       `yaml:"prior_state"`
+	TerraformVersion string                          `yaml:"terraform_version"`
+	FormatVersion    string                          `yaml:"format_version"`
+	PlannedValues    *tfplan_PlannedValues           `yaml:"planned_values"`
+	ResourceChanges  []*tfplan_ResourceChange        `yaml:"resource_changes"`
+	Configuration    *tfplan_Configuration           `yaml:"configuration"`
+	PriorState       *tfplan_PriorState              `yaml:"prior_state"`
+	Variables        map[string]*tfplan_Variable     `yaml:"variables"`
+	OutputChanges    map[string]*tfplan_OutputChange `yaml:"output_changes"`
+	ResourceDrift    []*tfplan_ResourceChange        `yaml:"resource_drift"`
+}
+
+type tfplan_Variable struct {
+	Value interface{} `yaml:"value"`
 }
 
 type tfplan_PlannedValues struct {
+	Outputs    map[string]*tfplan_Output   `yaml:"outputs"`
 	RootModule *tfplan_PlannedValuesModule `yaml:"root_module"`
 }
 
+type tfplan_Output struct {
+	Sensitive bool        `yaml:"sensitive"`
+	Value     interface{} `yaml:"value"`
+}
+
 type tfplan_PlannedValuesModule struct {
 	Address      string                          `yaml:"address"`
 	Resources    []*tfplan_PlannedValuesResource `yaml:"resources"`
@@ -112,21 +244,39 @@ type tfplan_PlannedValuesModule struct {
 }
 
 type tfplan_PlannedValuesResource struct {
-	Address string                 `yaml:"address"`
-	Mode    string                 `yaml:"mode"`
-	Type    string                 `yaml:"type"`
-	Values  map[string]interface{} `yaml:"values"`
+	Address         string                 `yaml:"address"`
+	Mode            string                 `yaml:"mode"`
+	Type            string                 `yaml:"type"`
+	Values          map[string]interface{} `yaml:"values"`
+	SensitiveValues interface{}            `yaml:"sensitive_values"`
 }
 
 type tfplan_ResourceChange struct {
-	Address string                      `yaml:"address"`
-	Change  tfplan_ResourceChangeChange `yaml:"change"`
+	Address      string                      `yaml:"address"`
+	ActionReason string                      `yaml:"action_reason"`
+	Change       tfplan_ResourceChangeChange `yaml:"change"`
 }
 
 type tfplan_ResourceChangeChange struct {
 	// One of: "create", "no-op", "update", "delete"
-	Actions      []string               `yaml:"actions"`
-	AfterUnknown map[string]interface{} `yaml:"after_unknown"`
+	Actions         []string               `yaml:"actions"`
+	Before          interface{}            `yaml:"before"`
+	After           interface{}            `yaml:"after"`
+	AfterUnknown    map[string]interface{} `yaml:"after_unknown"`
+	BeforeSensitive interface{}            `yaml:"before_sensitive"`
+	AfterSensitive  interface{}            `yaml:"after_sensitive"`
+	ReplacePaths    []interface{}          `yaml:"replace_paths"`
+}
+
+// Output changes have the same format as resource changes, but the values
+// may be of any type.
+type tfplan_OutputChange struct {
+	Actions         []string    `yaml:"actions"`
+	Before          interface{} `yaml:"before"`
+	After           interface{} `yaml:"after"`
+	AfterUnknown    interface{} `yaml:"after_unknown"`
+	BeforeSensitive interface{} `yaml:"before_sensitive"`
+	AfterSensitive  interface{} `yaml:"after_sensitive"`
 }
 
 type tfplan_Configuration struct {
@@ -143,6 +293,11 @@ type tfplan_ConfigurationModule struct {
 	Outputs     map[string]tfplan_ConfigurationOutput      `yaml:"outputs"`
 	Resources   []*tfplan_ConfigurationResource            `yaml:"resources"`
 	ModuleCalls map[string]*tfplan_ConfigurationModuleCall `yaml:"module_calls"`
+	Variables   map[string]*tfplan_ConfigurationVariable   `yaml:"variables"`
+}
+
+type tfplan_ConfigurationVariable struct {
+	Sensitive bool `yaml:"sensitive"`
 }
 
 type tfplan_ConfigurationOutput struct {
@@ -159,6 +314,7 @@ type tfplan_ConfigurationResource struct {
 	Address           string                                     `yaml:"address"`
 	ProviderConfigKey string                                     `yaml:"provider_config_key"`
 	Expressions       map[string]*tfplan_ConfigurationExpression `yaml:"expressions"`
+	DependsOn         []string                                   `yaml:"depends_on"`
 }
 
 type tfplan_ConfigurationExpression struct {
@@ -243,6 +399,36 @@ type tfplan_ConfigurationExpression_References struct {
 	References []string `yaml:"references"`
 }
 
+// resourcePaths maps resource addresses to their paths in the JSON plan.
+// Resources in planned values take precedence over resources in the prior
+// state.
+func (plan *tfplan_Plan) resourcePaths() map[string][]interface{} {
+	paths := map[string][]interface{}{}
+	var walk func([]interface{}, *tfplan_PlannedValuesModule)
+	walk = func(path []interface{}, module *tfplan_PlannedValuesModule) {
+		if module == nil {
+			return
+		}
+		for i, resource := range module.Resources {
+			if _, ok := paths[resource.Address]; !ok {
+				resourcePath := make([]interface{}, len(path))
+				copy(resourcePath, path)
+				paths[resource.Address] = append(resourcePath, "resources", i)
+			}
+		}
+		for i, child := range module.ChildModules {
+			childPath := make([]interface{}, len(path))
+			copy(childPath, path)
+			walk(append(childPath, "child_modules", i), child)
+		}
+	}
+	walk([]interface{}{"planned_values", "root_module"}, plan.PlannedValues.RootModule)
+	if plan.PriorState != nil && plan.PriorState.Values != nil {
+		walk([]interface{}{"prior_state", "values", "root_module"}, plan.PriorState.Values.RootModule)
+	}
+	return paths
+}
+
 // Helper to iterate through all modules.
 func (plan *tfplan_Plan) visitModules(
 	visitPlannedValuesModule func(string, *tfplan_PlannedValuesModule),
@@ -281,10 +467,10 @@ func (plan *tfplan_Plan) visitModules(
 // Generate a full map of outputs, assuming they reference a resource.
 // This ends up looking like e.g.:
 //
-//     module.child1.grandchild_vpc: module.child1.module.grandchild1.grandchild_vpc
-//     module.child1.module.grandchild1.grandchild_vpc: module.child1.module.grandchild1.aws_vpc.grandchild
-//     parent_vpc: aws_vpc.parent
-//     module.child2.var.child_vpc_id: module.child1.grandchild_vpc
+//	module.child1.grandchild_vpc: module.child1.module.grandchild1.grandchild_vpc
+//	module.child1.module.grandchild1.grandchild_vpc: module.child1.module.grandchild1.aws_vpc.grandchild
+//	parent_vpc: aws_vpc.parent
+//	module.child2.var.child_vpc_id: module.child1.grandchild_vpc
 //
 // Then returns a function which can (recursively) resolve pointers in this
 // variable map.
@@ -409,6 +595,18 @@ func (plan *tfplan_Plan) visitResources(
 	}
 }
 
+// When resolving references, take the module name into account.
+func resolveInModule(resolveGlobally func(string) *string, module string) func(string) *string {
+	return func(variable string) *string {
+		qualified := joinDot(module, variable)
+		if result := resolveGlobally(qualified); result != nil {
+			return result
+		} else {
+			return &qualified
+		}
+	}
+}
+
 // Figure out which variables or resources are referenced.  A resolver function
 // can be passed in.
 func (resource *tfplan_ConfigurationResource) references(resolve func(string) *string) interface{} {
@@ -489,6 +687,12 @@ func (plan *tfplan_Plan) resources(resourceNamespace string) []models.ResourceSt
 	// Calculate outputs
 	resolveGlobally := plan.pointers()
 
+	// Changes made outside of Terraform since the last apply.
+	resourceDrift := map[string]*tfplan_ResourceChange{}
+	for _, drift := range plan.ResourceDrift {
+		resourceDrift[drift.Address] = drift
+	}
+
 	resources := []models.ResourceState{}
 	plan.visitResources(func(
 		module string,
@@ -510,15 +714,7 @@ func (plan *tfplan_Plan) resources(resourceNamespace string) []models.ResourceSt
 			refs := interfacetricks.Copy(rc.Change.AfterUnknown)
 			refs = interfacetricks.IntersectWith(
 				refs,
-				cr.references(func(variable string) *string {
-					// When resolving references, take the module name into account.
-					qualified := joinDot(module, variable)
-					if result := resolveGlobally(qualified); result != nil {
-						return result
-					} else {
-						return &qualified
-					}
-				}),
+				cr.references(resolveInModule(resolveGlobally, module)),
 				// Intersect using a function that replaces all the "true"s on the
 				// left hand side (in the AfterUnknown structure) with the
 				// references we found.
@@ -586,11 +782,57 @@ func (plan *tfplan_Plan) resources(resourceNamespace string) []models.ResourceSt
 			}
 		}
 		if rc != nil {
-			resourceActions := []interface{}{}
-			for _, action := range rc.Change.Actions {
-				resourceActions = append(resourceActions, action)
+			unknown := []interface{}{}
+			markedPaths(rc.Change.AfterUnknown, []interface{}{}, &unknown)
+			if len(unknown) > 0 {
+				metaTerraform["unknown_attributes"] = unknown
+			}
+		}
+		if rc != nil {
+			metaTfplan["resource_actions"] = stringsToInterfaces(rc.Change.Actions)
+			if rc.ActionReason != "" {
+				metaTfplan["action_reason"] = rc.ActionReason
+			}
+			if rc.Change.Before != nil {
+				metaTfplan["before"] = rc.Change.Before
+			}
+			if len(rc.Change.ReplacePaths) > 0 {
+				metaTfplan["replace_paths"] = rc.Change.ReplacePaths
+			}
+			beforeSensitive := []interface{}{}
+			markedPaths(rc.Change.BeforeSensitive, []interface{}{}, &beforeSensitive)
+			if len(beforeSensitive) > 0 {
+				metaTfplan["before_sensitive"] = beforeSensitive
+			}
+		}
+		// Older plans only have after_sensitive in the resource change.
+		sensitiveValues := pvr.SensitiveValues
+		if sensitiveValues == nil && rc != nil {
+			sensitiveValues = rc.Change.AfterSensitive
+		}
+		sensitive := []interface{}{}
+		markedPaths(sensitiveValues, []interface{}{}, &sensitive)
+		if len(sensitive) > 0 {
+			meta["sensitive_attributes"] = sensitive
+		}
+
+		if drift, ok := resourceDrift[id]; ok {
+			metaDrift := map[string]interface{}{
+				"actions": stringsToInterfaces(drift.Change.Actions),
+				"before":  drift.Change.Before,
+				"after":   drift.Change.After,
+			}
+			beforeSensitive := []interface{}{}
+			markedPaths(drift.Change.BeforeSensitive, []interface{}{}, &beforeSensitive)
+			if len(beforeSensitive) > 0 {
+				metaDrift["before_sensitive"] = beforeSensitive
+			}
+			afterSensitive := []interface{}{}
+			markedPaths(drift.Change.AfterSensitive, []interface{}{}, &afterSensitive)
+			if len(afterSensitive) > 0 {
+				metaDrift["after_sensitive"] = afterSensitive
 			}
-			metaTfplan["resource_actions"] = resourceActions
+			metaTfplan["drift"] = metaDrift
 		}
 		if len(metaTerraform) > 0 {
 			meta["terraform"] = metaTerraform
@@ -618,6 +860,72 @@ func (plan *tfplan_Plan) resources(resourceNamespace string) []models.ResourceSt
 	return resources
 }
 
+// Computes the references between resources from the configuration
+// expressions.  References to a resource using count or for_each point to all
+// of its instances.
+func (plan *tfplan_Plan) relations() []relation {
+	resolveGlobally := plan.pointers()
+
+	instances := map[string][]string{}
+	plan.visitResources(func(
+		module string,
+		id string,
+		pvr *tfplan_PlannedValuesResource,
+		rc *tfplan_ResourceChange,
+		cr *tfplan_ConfigurationResource,
+	) {
+		instances[id] = append(instances[id], id)
+		if idx := strings.Index(id, "["); idx > 0 {
+			instances[id[:idx]] = append(instances[id[:idx]], id)
+		}
+	})
+
+	relations := []relation{}
+	plan.visitResources(func(
+		module string,
+		id string,
+		pvr *tfplan_PlannedValuesResource,
+		rc *tfplan_ResourceChange,
+		cr *tfplan_ConfigurationResource,
+	) {
+		if cr == nil {
+			return
+		}
+		resolve := resolveInModule(resolveGlobally, module)
+		var walk func(path []interface{}, refs interface{})
+		walk = func(path []interface{}, refs interface{}) {
+			switch r := refs.(type) {
+			case string:
+				for _, target := range instances[r] {
+					attribute := make([]interface{}, len(path))
+					copy(attribute, path)
+					relations = append(relations, relation{id, target, attribute})
+				}
+			case []string:
+				for _, ref := range r {
+					walk(path, ref)
+				}
+			case []interface{}:
+				for i, elem := range r {
+					walk(append(path, int64(i)), elem)
+				}
+			case map[string]interface{}:
+				for k, elem := range r {
+					walk(append(path, k), elem)
+				}
+			}
+		}
+		walk([]interface{}{}, cr.references(resolve))
+
+		for _, dependency := range cr.DependsOn {
+			for _, target := range instances[*resolve(dependency)] {
+				relations = append(relations, relation{id, target, []interface{}{"depends_on"}})
+			}
+		}
+	})
+	return relations
+}
+
 // interfacetricks.TopDownWalker implementation that can replace a boolean.
 type replaceBoolTopDownWalker struct {
 	replaceBool func(bool) interface{}
@@ -680,6 +988,128 @@ func filterReferences(refs []string) []string {
 	return resources
 }
 
+// meta returns information about the plan as a whole: the values of input
+// variables, the planned outputs and their changes, and resources that
+// drifted since the last apply.
+func (plan *tfplan_Plan) meta() map[string]interface{} {
+	meta := map[string]interface{}{}
+
+	if len(plan.Variables) > 0 {
+		variables := map[string]interface{}{}
+		for name, variable := range plan.Variables {
+			if variable != nil {
+				variables[name] = variable.Value
+			}
+		}
+		meta["variables"] = variables
+
+		sensitive := []string{}
+		if plan.Configuration != nil && plan.Configuration.RootModule != nil {
+			for name, variable := range plan.Configuration.RootModule.Variables {
+				if _, ok := variables[name]; ok && variable != nil && variable.Sensitive {
+					sensitive = append(sensitive, name)
+				}
+			}
+		}
+		if len(sensitive) > 0 {
+			sort.Strings(sensitive)
+			meta["sensitive_variables"] = stringsToInterfaces(sensitive)
+		}
+	}
+
+	if len(plan.PlannedValues.Outputs) > 0 {
+		outputs := map[string]interface{}{}
+		for name, output := range plan.PlannedValues.Outputs {
+			if output == nil {
+				continue
+			}
+			obj := map[string]interface{}{
+				"sensitive": output.Sensitive,
+			}
+			if output.Value != nil {
+				obj["value"] = output.Value
+			}
+			outputs[name] = obj
+		}
+		meta["outputs"] = outputs
+	}
+
+	if len(plan.OutputChanges) > 0 {
+		outputChanges := map[string]interface{}{}
+		for name, change := range plan.OutputChanges {
+			if change == nil {
+				continue
+			}
+			obj := map[string]interface{}{
+				"actions": stringsToInterfaces(change.Actions),
+			}
+			if change.Before != nil {
+				obj["before"] = change.Before
+			}
+			if change.After != nil {
+				obj["after"] = change.After
+			}
+			if unknown, ok := change.AfterUnknown.(bool); ok && unknown {
+				obj["after_unknown"] = true
+			}
+			beforeSensitive, _ := change.BeforeSensitive.(bool)
+			afterSensitive, _ := change.AfterSensitive.(bool)
+			if beforeSensitive || afterSensitive {
+				obj["sensitive"] = true
+			}
+			outputChanges[name] = obj
+		}
+		meta["output_changes"] = outputChanges
+	}
+
+	if len(plan.ResourceDrift) > 0 {
+		drift := []interface{}{}
+		for _, rc := range plan.ResourceDrift {
+			drift = append(drift, map[string]interface{}{
+				"address": rc.Address,
+				"actions": stringsToInterfaces(rc.Change.Actions),
+			})
+		}
+		meta["resource_drift"] = drift
+	}
+
+	return meta
+}
+
+func stringsToInterfaces(strs []string) []interface{} {
+	result := make([]interface{}, len(strs))
+	for i, str := range strs {
+		result[i] = str
+	}
+	return result
+}
+
+// markedPaths collects the paths to values marked with `true` in the
+// after_unknown or sensitive values structures of a change.
+func markedPaths(marks interface{}, path []interface{}, paths *[]interface{}) {
+	switch v := marks.(type) {
+	case bool:
+		if v {
+			unknown := make([]interface{}, len(path))
+			copy(unknown, path)
+			*paths = append(*paths, unknown)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			markedPaths(elem, append(path, int64(i)), paths)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			markedPaths(v[k], append(path, k), paths)
+		}
+	}
+}
+
 func joinDot(parts ...string) string {
 	result := ""
 	for _, part := range parts {
@@ -19,7 +19,9 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/snyk/policy-engine/pkg/input"
 	inputs "github.com/snyk/policy-engine/pkg/input/test_inputs"
@@ -88,3 +90,55 @@ func TestTfPlanDetectorNotYAML(t *testing.T) {
 	assert.True(t, errors.Is(err, input.FailedToParseInput))
 	assert.Nil(t, tfplan)
 }
+
+func TestTfPlanLocation(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/project/main.tf", []byte(`resource "aws_s3_bucket" "bucket" {
+  count  = 2
+  bucket = "bucket-${count.index}"
+}
+`), 0644)
+	afero.WriteFile(fs, "/project/plan.json", []byte(`{
+  "format_version": "1.0",
+  "terraform_version": "1.2.5",
+  "planned_values": {
+    "root_module": {
+      "resources": [
+        {
+          "address": "aws_s3_bucket.bucket[1]",
+          "mode": "managed",
+          "type": "aws_s3_bucket",
+          "values": {
+            "bucket": "bucket-1"
+          }
+        }
+      ]
+    }
+  },
+  "configuration": {
+    "root_module": {}
+  }
+}
+`), 0644)
+	path := []interface{}{"/project/plan.json", "aws_s3_bucket", "aws_s3_bucket.bucket[1]", "bucket"}
+	detector := &input.TfPlanDetector{}
+
+	// Without the configuration, locations point into the plan.
+	plan, err := detector.DetectFile(&input.File{Fs: fs, Path: "/project/plan.json"}, input.DetectOptions{})
+	require.NoError(t, err)
+	loc, err := plan.Location(path)
+	require.NoError(t, err)
+	assert.Equal(t, input.LocationStack{{Path: "/project/plan.json", Line: 12, Col: 13}}, loc)
+	loc, err = plan.Location(path[:3])
+	require.NoError(t, err)
+	assert.Equal(t, input.LocationStack{{Path: "/project/plan.json", Line: 7, Col: 9}}, loc)
+
+	// With the configuration, locations point into the HCL source.
+	plan, err = detector.DetectFile(&input.File{Fs: fs, Path: "/project/plan.json"}, input.DetectOptions{
+		PlanConfigurationDir: "/project",
+	})
+	require.NoError(t, err)
+	loc, err = plan.Location(path)
+	require.NoError(t, err)
+	assert.Equal(t, input.LocationStack{{Path: "/project/main.tf", Line: 3, Col: 3}}, loc)
+}
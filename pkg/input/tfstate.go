@@ -18,6 +18,8 @@ package input
 import (
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/snyk/policy-engine/pkg/models"
@@ -42,11 +44,23 @@ func (t *TfStateDetector) DetectFile(i *File, opts DetectOptions) (IACConfigurat
 	if tfstate.TerraformVersion == "" || tfstate.Lineage == "" {
 		return nil, fmt.Errorf("%w", InvalidInput)
 	}
+	if tfstate.Version != 3 && tfstate.Version != 4 {
+		return nil, fmt.Errorf("%w: unsupported state version %d", InvalidInput, tfstate.Version)
+	}
+
+	// Don't consider source code locations essential.
+	source, _ := LoadSourceInfoNode(contents)
 
-	return &tfstateLoader{
-		path:  i.Path,
-		state: tfstate,
-	}, nil
+	loader := &tfstateLoader{
+		path:   i.Path,
+		state:  tfstate,
+		source: source,
+	}
+	loader.instancesByAddress = map[string]tfstateInstance{}
+	for _, instance := range loader.instances() {
+		loader.instancesByAddress[instance.address()] = instance
+	}
+	return loader, nil
 }
 
 func (t *TfStateDetector) DetectDirectory(i *Directory, opts DetectOptions) (IACConfiguration, error) {
@@ -54,8 +68,12 @@ func (t *TfStateDetector) DetectDirectory(i *Directory, opts DetectOptions) (IAC
 }
 
 type tfstateLoader struct {
-	path  string
-	state tfstate_State
+	path   string
+	state  tfstate_State
+	source *SourceInfoNode
+
+	// instancesByAddress is used to find source locations.
+	instancesByAddress map[string]tfstateInstance
 }
 
 type tfstate_State struct {
@@ -63,18 +81,118 @@ type tfstate_State struct {
 	TerraformVersion string             `yaml:"terraform_version"`
 	Resources        []tfstate_Resource `yaml:"resources"`
 	Lineage          string             `yaml:"lineage"`
+
+	// Modules is only used in version 3 of the format.
+	Modules []tfstate_V3Module `yaml:"modules"`
 }
 
 type tfstate_Resource struct {
+	Module    string                     `yaml:"module"`
 	Mode      string                     `yaml:"mode"`
 	Type      string                     `yaml:"type"`
 	Name      string                     `yaml:"name"`
+	Each      string                     `yaml:"each"`
 	Provider  string                     `yaml:"provider"`
 	Instances []tfstate_ResourceInstance `yaml:"instances"`
 }
 
 type tfstate_ResourceInstance struct {
-	Attributes map[string]interface{} `yaml:"attributes"`
+	IndexKey       interface{}            `yaml:"index_key"`
+	Deposed        string                 `yaml:"deposed"`
+	Attributes     map[string]interface{} `yaml:"attributes"`
+	AttributesFlat map[string]string      `yaml:"attributes_flat"`
+	Dependencies   []string               `yaml:"dependencies"`
+	DependsOn      []string               `yaml:"depends_on"`
+
+	// SensitiveAttributes holds paths as lists of steps, such as
+	// `{"type": "get_attr", "value": "password"}`.
+	SensitiveAttributes []tfstate_Path `yaml:"sensitive_attributes"`
+}
+
+type tfstate_Path []struct {
+	Type  string      `yaml:"type"`
+	Value interface{} `yaml:"value"`
+}
+
+// attributePath converts the path to an attribute path.  Index steps hold a
+// typed value, like `{"value": 0, "type": "number"}`.
+func (path tfstate_Path) attributePath() []interface{} {
+	attributePath := []interface{}{}
+	for _, step := range path {
+		switch step.Type {
+		case "get_attr":
+			attributePath = append(attributePath, step.Value)
+		case "index":
+			if index, ok := step.Value.(map[string]interface{}); ok {
+				switch v := index["value"].(type) {
+				case int:
+					attributePath = append(attributePath, int64(v))
+				case string:
+					attributePath = append(attributePath, v)
+				default:
+					// Elements of sets cannot be addressed.
+					return attributePath
+				}
+			}
+		}
+	}
+	return attributePath
+}
+
+type tfstate_V3Module struct {
+	Path      []string                      `yaml:"path"`
+	Resources map[string]tfstate_V3Resource `yaml:"resources"`
+}
+
+type tfstate_V3Resource struct {
+	Type      string              `yaml:"type"`
+	DependsOn []string            `yaml:"depends_on"`
+	Primary   *tfstate_V3Instance `yaml:"primary"`
+	Provider  string              `yaml:"provider"`
+}
+
+type tfstate_V3Instance struct {
+	Id         string            `yaml:"id"`
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// tfstateInstance is a single resource instance, independent of the version
+// of the state format.
+type tfstateInstance struct {
+	module       string
+	mode         string
+	resourceType string
+	name         string
+	indexKey     interface{}
+	provider     string
+	dependencies []string
+	attributes   map[string]interface{}
+	sensitive    []interface{}
+
+	// attributesPath is the path to the attributes in the JSON state.  If
+	// flat is set, these are flatmap attributes whose keys join the
+	// attribute path with dots.
+	attributesPath []interface{}
+	flat           bool
+}
+
+// address returns the Terraform address of the instance, which is unique
+// within a state.
+func (i *tfstateInstance) address() string {
+	address := i.resourceType + "." + i.name
+	if i.mode == "data" {
+		address = "data." + address
+	}
+	if i.module != "" {
+		address = i.module + "." + address
+	}
+	switch k := i.indexKey.(type) {
+	case int:
+		address += fmt.Sprintf("[%d]", k)
+	case string:
+		address += fmt.Sprintf("[%q]", k)
+	}
+	return address
 }
 
 func (l *tfstateLoader) LoadedFiles() []string {
@@ -89,68 +207,337 @@ func (l *tfstateLoader) Type() *Type {
 	return TerraformState
 }
 
-func (l *tfstateLoader) Location(attributePath []interface{}) (LocationStack, error) {
-	return nil, nil
+func (l *tfstateLoader) Location(path []interface{}) (LocationStack, error) {
+	// Format is {resourceNamespace, resourceType, resourceId, attributePath...}
+	if l.source == nil || len(path) < 3 {
+		return nil, nil
+	}
+
+	resourceId, ok := path[2].(string)
+	if !ok {
+		return nil, fmt.Errorf(
+			"%w: Expected string resource ID in path: %v",
+			UnableToResolveLocation,
+			path,
+		)
+	}
+
+	instance, ok := l.instancesByAddress[resourceId]
+	if !ok {
+		return nil, fmt.Errorf(
+			"%w: Unable to find resource with ID: %s",
+			UnableToResolveLocation,
+			resourceId,
+		)
+	}
+
+	fullPath := make([]interface{}, len(instance.attributesPath))
+	copy(fullPath, instance.attributesPath)
+	if len(path) == 3 {
+		// Point to the instance rather than its attributes.
+		fullPath = fullPath[:len(fullPath)-1]
+	} else if !instance.flat {
+		fullPath = append(fullPath, path[3:]...)
+	}
+	node, err := l.source.GetPath(fullPath)
+	if err == nil && len(path) > 3 && instance.flat {
+		node, err = tfstateFlatLocation(node, path[3:])
+	}
+	line, column := node.Location()
+	return []Location{{Path: l.path, Line: line, Col: column}}, err
+}
+
+// tfstateFlatLocation finds an attribute in flatmap attributes.  Elements of
+// sets are keyed by a hash rather than an index, so we fall back to the
+// closest enclosing attribute, which may be a count (`.#` or `.%`) key.
+func tfstateFlatLocation(attributes *SourceInfoNode, path []interface{}) (*SourceInfoNode, error) {
+	keys := make([]string, len(path))
+	for i, k := range path {
+		keys[i] = fmt.Sprint(k)
+	}
+	for n := len(keys); n > 0; n-- {
+		key := strings.Join(keys[:n], ".")
+		for _, candidate := range []string{key, key + ".#", key + ".%"} {
+			if node, err := attributes.GetKey(candidate); err == nil {
+				return node, nil
+			}
+		}
+	}
+	return attributes, fmt.Errorf("Key %s not found", strings.Join(keys, "."))
+}
+
+// Matches provider addresses such as:
+//
+//	provider["registry.terraform.io/hashicorp/aws"].west
+//	module.child.provider.aws.west
+var tfstateProviderRegex = regexp.MustCompile(
+	`^(?:module\.[^\[\]]+\.)?provider(?:\["(?:.*/)?([^/"]*)"\]|\.([^.]+))(?:\.(.+))?$`,
+)
+
+// parseTfstateProvider returns the provider type and alias of a provider
+// address.
+func parseTfstateProvider(provider string) (string, string) {
+	matches := tfstateProviderRegex.FindStringSubmatch(provider)
+	if matches == nil {
+		return provider, ""
+	}
+	name := matches[1]
+	if name == "" {
+		name = matches[2]
+	}
+	return name, matches[3]
+}
+
+func (l *tfstateLoader) instances() []tfstateInstance {
+	if l.state.Version == 3 {
+		return l.v3Instances()
+	}
+
+	instances := []tfstateInstance{}
+	for i, resource := range l.state.Resources {
+		for j, instance := range resource.Instances {
+			// Deposed objects are pending destruction.
+			if instance.Deposed != "" {
+				continue
+			}
+			attributes := instance.Attributes
+			attributesPath := []interface{}{"resources", i, "instances", j, "attributes"}
+			flat := false
+			if attributes == nil && instance.AttributesFlat != nil {
+				attributes = unflattenTfstateAttributes(instance.AttributesFlat)
+				attributesPath[4] = "attributes_flat"
+				flat = true
+			}
+			dependencies := instance.Dependencies
+			if dependencies == nil {
+				dependencies = instance.DependsOn
+			}
+			sensitive := []interface{}{}
+			for _, path := range instance.SensitiveAttributes {
+				sensitive = append(sensitive, path.attributePath())
+			}
+			instances = append(instances, tfstateInstance{
+				module:         resource.Module,
+				mode:           resource.Mode,
+				resourceType:   resource.Type,
+				name:           resource.Name,
+				indexKey:       instance.IndexKey,
+				provider:       resource.Provider,
+				dependencies:   dependencies,
+				attributes:     attributes,
+				sensitive:      sensitive,
+				attributesPath: attributesPath,
+				flat:           flat,
+			})
+		}
+	}
+	return instances
+}
+
+// v3Instances reads the instances in a version 3 state.  These only have
+// flat attributes, whose values are all strings.
+func (l *tfstateLoader) v3Instances() []tfstateInstance {
+	instances := []tfstateInstance{}
+	for i, module := range l.state.Modules {
+		modulePath := []string{}
+		for _, name := range module.Path {
+			if name != "root" {
+				modulePath = append(modulePath, "module."+name)
+			}
+		}
+
+		keys := []string{}
+		for key := range module.Resources {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			resource := module.Resources[key]
+			if resource.Primary == nil {
+				continue
+			}
+
+			// Keys look like `aws_s3_bucket.bucket`, `aws_s3_bucket.bucket.1`
+			// or `data.aws_iam_policy_document.policy`.
+			instance := tfstateInstance{
+				module:         strings.Join(modulePath, "."),
+				mode:           "managed",
+				provider:       resource.Provider,
+				dependencies:   resource.DependsOn,
+				attributesPath: []interface{}{"modules", i, "resources", key, "primary", "attributes"},
+				flat:           true,
+			}
+			parts := strings.Split(key, ".")
+			if parts[0] == "data" {
+				instance.mode = "data"
+				parts = parts[1:]
+			}
+			if len(parts) < 2 {
+				continue
+			}
+			instance.resourceType = parts[0]
+			instance.name = parts[1]
+			if len(parts) > 2 {
+				if index, err := strconv.Atoi(parts[2]); err == nil {
+					instance.indexKey = index
+				}
+			}
+
+			attributes := unflattenTfstateAttributes(resource.Primary.Attributes)
+			if _, ok := attributes["id"]; !ok && resource.Primary.Id != "" {
+				attributes["id"] = resource.Primary.Id
+			}
+			instance.attributes = attributes
+			instances = append(instances, instance)
+		}
+	}
+	return instances
 }
 
 func (l *tfstateLoader) ToState() models.State {
 	resources := []models.ResourceState{}
 	environmentProvider := ""
 
-	for _, resource := range l.state.Resources {
+	for _, instance := range l.instances() {
 		// Set resource type
-		resourceType := resource.Type
-		if resource.Mode == "data" {
+		resourceType := instance.resourceType
+		if instance.mode == "data" {
 			resourceType = "data." + resourceType
 		}
 
 		// Parse env provider
 		if environmentProvider == "" {
-			environmentProvider = strings.SplitN(resource.Type, "_", 2)[0]
+			environmentProvider = strings.SplitN(instance.resourceType, "_", 2)[0]
 		}
 
-		// Parse resource provider
-		resourceProvider := resource.Provider
-		resourceProviderRegex := regexp.MustCompile(`^provider\[\".*/([^/]*)\"\]$`)
-		resourceProviderMatches := resourceProviderRegex.FindAllStringSubmatch(resourceProvider, 1)
-		if len(resourceProviderMatches) > 0 {
-			resourceProvider = resourceProviderMatches[0][1]
-		}
+		resourceProvider, providerAlias := parseTfstateProvider(instance.provider)
 
-		// Ensure attributes are available
-		if len(resource.Instances) < 0 {
-			continue
+		attributes := instance.attributes
+		if attributes == nil {
+			attributes = map[string]interface{}{}
 		}
-		instance := resource.Instances[0]
 
-		// Parse ID
-		id := ""
-		if val, ok := instance.Attributes["id"]; ok {
-			if v, ok := val.(string); ok {
-				id = v
+		address := instance.address()
+		tfstateMeta := map[string]interface{}{
+			"name":    instance.name,
+			"address": address,
+		}
+		if instance.module != "" {
+			tfstateMeta["module"] = instance.module
+		}
+		if instance.indexKey != nil {
+			tfstateMeta["index_key"] = instance.indexKey
+		}
+		if providerAlias != "" {
+			tfstateMeta["provider_alias"] = providerAlias
+		}
+		if len(instance.dependencies) > 0 {
+			dependencies := make([]interface{}, len(instance.dependencies))
+			for i, dep := range instance.dependencies {
+				dependencies[i] = dep
 			}
+			tfstateMeta["dependencies"] = dependencies
 		}
-		if id == "" {
-			continue
+
+		meta := map[string]interface{}{
+			"tfstate": tfstateMeta,
+		}
+		if len(instance.sensitive) > 0 {
+			meta["sensitive_attributes"] = instance.sensitive
 		}
 
 		// Put it all together
 		resources = append(resources, models.ResourceState{
-			Id:           id,
+			Id:           address,
 			ResourceType: resourceType,
 			Namespace:    resourceProvider,
-			Attributes:   instance.Attributes,
-			Meta: map[string]interface{}{
-				"tfstate": map[string]interface{}{
-					"name": resource.Name,
-				},
-			},
+			Attributes:   attributes,
+			Meta:         meta,
 		})
 	}
 
 	return models.State{
+		Format:              stateFormat,
+		FormatVersion:       stateFormatVersion,
 		InputType:           TerraformState.Name,
 		EnvironmentProvider: environmentProvider,
-		Resources:           groupResourcesByType(resources),
+		Meta: map[string]interface{}{
+			"filepath": l.path,
+		},
+		Resources: groupResourcesByType(resources),
+		Scope: map[string]interface{}{
+			"filepath": l.path,
+		},
+	}
+}
+
+// unflattenTfstateAttributes converts the flat attributes used by older
+// versions of the state format, such as `tags.%`, `tags.Name` and
+// `ingress.1234.from_port`, to nested values.  Since these do not carry type
+// information, all values are left as strings.
+func unflattenTfstateAttributes(flat map[string]string) map[string]interface{} {
+	obj := map[string]interface{}{}
+	for _, key := range flatChildKeys(flat, "") {
+		obj[key] = unflattenTfstateValue(flat, key)
 	}
+	return obj
+}
+
+func unflattenTfstateValue(flat map[string]string, prefix string) interface{} {
+	if _, ok := flat[prefix+".#"]; ok {
+		list := []interface{}{}
+		for _, key := range flatChildKeys(flat, prefix+".") {
+			if key != "#" {
+				list = append(list, unflattenTfstateValue(flat, prefix+"."+key))
+			}
+		}
+		return list
+	}
+
+	if _, ok := flat[prefix+".%"]; ok {
+		// Map keys may contain dots, so we use the entire remainder as key.
+		m := map[string]interface{}{}
+		for key, val := range flat {
+			if strings.HasPrefix(key, prefix+".") && key != prefix+".%" {
+				m[strings.TrimPrefix(key, prefix+".")] = val
+			}
+		}
+		return m
+	}
+
+	if val, ok := flat[prefix]; ok {
+		return val
+	}
+
+	obj := map[string]interface{}{}
+	for _, key := range flatChildKeys(flat, prefix+".") {
+		obj[key] = unflattenTfstateValue(flat, prefix+"."+key)
+	}
+	return obj
+}
+
+// flatChildKeys returns the distinct next path segments of flat keys with the
+// given prefix, sorting numeric segments numerically.
+func flatChildKeys(flat map[string]string, prefix string) []string {
+	seen := map[string]struct{}{}
+	keys := []string{}
+	for key := range flat {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		child := strings.SplitN(strings.TrimPrefix(key, prefix), ".", 2)[0]
+		if _, ok := seen[child]; !ok {
+			seen[child] = struct{}{}
+			keys = append(keys, child)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, aErr := strconv.Atoi(keys[i])
+		b, bErr := strconv.Atoi(keys[j])
+		if aErr == nil && bErr == nil {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
 }
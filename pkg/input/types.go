@@ -108,6 +108,13 @@ var CloudFormation = &Type{
 	Aliases: []string{"cloudformation"},
 }
 
+// Cdk represents AWS CDK cloud assemblies.  The stacks in an assembly are
+// loaded as CloudFormation states.
+var Cdk = &Type{
+	Name:    "cdk",
+	Aliases: []string{"cloud_assembly", "cloud-assembly"},
+}
+
 // CloudScan represents inputs from a Snyk Cloud Scan.
 var CloudScan = &Type{
 	Name:    "cloud_scan",
@@ -141,6 +148,12 @@ var TerraformState = &Type{
 	Aliases: []string{"tf-state"},
 }
 
+// Terragrunt represents Terragrunt configuration inputs.  They are evaluated into
+// the same state as TerraformHCL.
+var Terragrunt = &Type{
+	Name: "terragrunt",
+}
+
 // StreamlinedState is a temporary addition until we're able to completely replace the
 // old streamlined state format.
 var StreamlinedState = &Type{
@@ -148,6 +161,14 @@ var StreamlinedState = &Type{
 	Aliases: []string{"streamlined-state"},
 }
 
+// State represents inputs in the policy engine's own state format, or the
+// inputs embedded in its results format.  The input type of the resulting
+// states is declared in the documents themselves.
+var State = &Type{
+	Name:    "state",
+	Aliases: []string{"policy-engine-state"},
+}
+
 // Terraform is an aggregate input type that encompasses all input types that contain
 // Terraform resource types.
 var Terraform = &Type{
@@ -157,6 +178,7 @@ var Terraform = &Type{
 		TerraformHCL,
 		TerraformPlan,
 		CloudScan,
+		Terragrunt,
 	},
 }
 
@@ -166,11 +188,14 @@ var Auto = &Type{
 	Name: "auto",
 	Children: Types{
 		Arm,
+		Cdk,
 		CloudFormation,
 		Kubernetes,
 		TerraformHCL,
 		TerraformPlan,
 		TerraformState,
+		Terragrunt,
+		State,
 	},
 }
 
@@ -191,9 +216,12 @@ var SupportedInputTypes = Types{
 	Auto,
 	Arm,
 	CloudFormation,
+	Cdk,
 	Kubernetes,
 	TerraformHCL,
 	TerraformPlan,
 	TerraformState,
+	Terragrunt,
+	State,
 	StreamlinedState,
 }
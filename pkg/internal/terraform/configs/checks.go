@@ -0,0 +1,124 @@
+package configs
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Check represents a "check" block, which contains assertions about the
+// infrastructure and may contain a single scoped data resource.
+type Check struct {
+	Name string
+
+	DataResource *Resource
+	Asserts      []*CheckRule
+
+	DeclRange hcl.Range
+}
+
+// CheckRule is an "assert" block within a check block.
+type CheckRule struct {
+	Condition    hcl.Expression
+	ErrorMessage hcl.Expression
+
+	DeclRange hcl.Range
+}
+
+func decodeCheckBlock(block *hcl.Block) (*Check, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	check := &Check{
+		Name:      block.Labels[0],
+		DeclRange: block.DefRange,
+	}
+
+	if !hclsyntax.ValidIdentifier(check.Name) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid check block name",
+			Detail:   badIdentifierDetail,
+			Subject:  &block.LabelRanges[0],
+		})
+	}
+
+	content, moreDiags := block.Body.Content(checkBlockSchema)
+	diags = append(diags, moreDiags...)
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "data":
+			if check.DataResource != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Multiple data resource blocks",
+					Detail:   fmt.Sprintf("This check block already has a data resource defined at %s.", check.DataResource.DeclRange.Ptr()),
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			}
+			data, dataDiags := decodeDataBlock(block)
+			diags = append(diags, dataDiags...)
+			check.DataResource = data
+
+		case "assert":
+			rule, ruleDiags := decodeCheckRuleBlock(block)
+			diags = append(diags, ruleDiags...)
+			check.Asserts = append(check.Asserts, rule)
+		}
+	}
+
+	if len(check.Asserts) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Zero assert blocks",
+			Detail:   "Check blocks must have at least one assert block.",
+			Subject:  check.DeclRange.Ptr(),
+		})
+	}
+
+	return check, diags
+}
+
+func decodeCheckRuleBlock(block *hcl.Block) (*CheckRule, hcl.Diagnostics) {
+	rule := &CheckRule{
+		DeclRange: block.DefRange,
+	}
+
+	content, diags := block.Body.Content(checkRuleBlockSchema)
+
+	if attr, exists := content.Attributes["condition"]; exists {
+		rule.Condition = attr.Expr
+	}
+
+	if attr, exists := content.Attributes["error_message"]; exists {
+		rule.ErrorMessage = attr.Expr
+	}
+
+	return rule, diags
+}
+
+var checkBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type:       "data",
+			LabelNames: []string{"type", "name"},
+		},
+		{
+			Type: "assert",
+		},
+	},
+}
+
+var checkRuleBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "condition",
+			Required: true,
+		},
+		{
+			Name:     "error_message",
+			Required: true,
+		},
+	},
+}
@@ -0,0 +1,61 @@
+package configs
+
+import (
+	"github.com/hashicorp/hcl/v2"
+)
+
+// Import represents an "import" block, which declares that an existing
+// object should be imported into the resource at the given address.
+type Import struct {
+	// ID is an expression since it may refer to variables and locals.
+	ID hcl.Expression
+	To hcl.Traversal
+
+	ProviderConfigRef *ProviderConfigRef
+
+	DeclRange hcl.Range
+}
+
+func decodeImportBlock(block *hcl.Block) (*Import, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	imp := &Import{
+		DeclRange: block.DefRange,
+	}
+
+	content, moreDiags := block.Body.Content(importBlockSchema)
+	diags = append(diags, moreDiags...)
+
+	if attr, exists := content.Attributes["id"]; exists {
+		imp.ID = attr.Expr
+	}
+
+	if attr, exists := content.Attributes["to"]; exists {
+		to, traversalDiags := hcl.AbsTraversalForExpr(attr.Expr)
+		diags = append(diags, traversalDiags...)
+		imp.To = to
+	}
+
+	if attr, exists := content.Attributes["provider"]; exists {
+		ref, refDiags := decodeProviderConfigRef(attr.Expr, "provider")
+		diags = append(diags, refDiags...)
+		imp.ProviderConfigRef = ref
+	}
+
+	return imp, diags
+}
+
+var importBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "id",
+			Required: true,
+		},
+		{
+			Name:     "to",
+			Required: true,
+		},
+		{
+			Name: "provider",
+		},
+	},
+}
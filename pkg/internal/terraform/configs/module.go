@@ -42,6 +42,10 @@ type Module struct {
 
 	ManagedResources map[string]*Resource
 	DataResources    map[string]*Resource
+
+	Moved  []*Moved
+	Import []*Import
+	Checks map[string]*Check
 }
 
 // File describes the contents of a single configuration file.
@@ -73,6 +77,10 @@ type File struct {
 
 	ManagedResources []*Resource
 	DataResources    []*Resource
+
+	Moved  []*Moved
+	Import []*Import
+	Checks []*Check
 }
 
 // NewModule takes a list of primary files and a list of override files and
@@ -94,6 +102,7 @@ func NewModule(primaryFiles, overrideFiles []*File) (*Module, hcl.Diagnostics) {
 		ModuleCalls:        map[string]*ModuleCall{},
 		ManagedResources:   map[string]*Resource{},
 		DataResources:      map[string]*Resource{},
+		Checks:             map[string]*Check{},
 		ProviderMetas:      map[addrs.Provider]*ProviderMeta{},
 	}
 
@@ -328,6 +337,22 @@ func (m *Module) appendFile(file *File) hcl.Diagnostics {
 		}
 	}
 
+	m.Moved = append(m.Moved, file.Moved...)
+	m.Import = append(m.Import, file.Import...)
+
+	for _, c := range file.Checks {
+		if existing, exists := m.Checks[c.Name]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Duplicate check %q configuration", existing.Name),
+				Detail:   fmt.Sprintf("A check block named %q was already declared at %s. Check blocks must be unique within each module.", existing.Name, existing.DeclRange),
+				Subject:  &c.DeclRange,
+			})
+			continue
+		}
+		m.Checks[c.Name] = c
+	}
+
 	return diags
 }
 
@@ -52,6 +52,7 @@ func (v *Variable) merge(ov *Variable) hcl.Diagnostics {
 	if ov.Type != cty.NilType {
 		v.Type = ov.Type
 		v.ConstraintType = ov.ConstraintType
+		v.TypeDefaults = ov.TypeDefaults
 	}
 	if ov.ParsingMode != 0 {
 		v.ParsingMode = ov.ParsingMode
@@ -98,7 +99,7 @@ func (v *Variable) merge(ov *Variable) hcl.Diagnostics {
 				})
 			}
 		} else {
-			v.Default = val
+			v.Default = v.TypeDefaults.Apply(val)
 		}
 	}
 
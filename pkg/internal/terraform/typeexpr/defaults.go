@@ -0,0 +1,138 @@
+package typeexpr
+
+import (
+	"strconv"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// Defaults represents a type tree which may contain default values for
+// optional object attributes at any level. This is used to apply nested
+// defaults to a given cty.Value before converting it to a concrete type.
+type Defaults struct {
+	// Type of the node for which these defaults apply. This is necessary in
+	// order to determine how to inspect the Defaults and Children collections.
+	Type cty.Type
+
+	// DefaultValues contains the default values for each object attribute,
+	// indexed by attribute name.
+	DefaultValues map[string]cty.Value
+
+	// Children is a map of Defaults for elements contained in this type. This
+	// only applies to structural and collection types.
+	//
+	// The map is indexed by string instead of cty.Value because cty.Number
+	// instances are non-comparable, due to embedding a *big.Float.
+	//
+	// Collections have a single element type, which is stored at key "".
+	Children map[string]*Defaults
+}
+
+// collectionDefaults wraps the defaults of the element type of a collection,
+// if there are any.
+func collectionDefaults(ty cty.Type, elem *Defaults) *Defaults {
+	if elem == nil {
+		return nil
+	}
+	return &Defaults{
+		Type:     ty,
+		Children: map[string]*Defaults{"": elem},
+	}
+}
+
+// Apply walks the given value, filling in default values for object
+// attributes that are null.  The value is expected to already be converted
+// to the type constraint the defaults were obtained from, so that optional
+// attributes that were omitted are present as null values.
+func (d *Defaults) Apply(val cty.Value) cty.Value {
+	if d == nil || val.IsNull() || !val.IsKnown() {
+		return val
+	}
+	val, marks := val.Unmark()
+	return d.apply(val).WithMarks(marks)
+}
+
+func (d *Defaults) apply(val cty.Value) cty.Value {
+	ty := val.Type()
+	switch {
+	case ty.IsObjectType():
+		attrs := val.AsValueMap()
+		if attrs == nil {
+			attrs = map[string]cty.Value{}
+		}
+		for name, defaultVal := range d.DefaultValues {
+			attr, ok := attrs[name]
+			if ok && !attr.IsNull() {
+				continue
+			}
+			if ok {
+				if converted, err := convert.Convert(defaultVal, attr.Type()); err == nil {
+					defaultVal = converted
+				}
+			}
+			attrs[name] = defaultVal
+		}
+		for name, child := range d.Children {
+			if attr, ok := attrs[name]; ok {
+				attrs[name] = child.Apply(attr)
+			}
+		}
+		return cty.ObjectVal(attrs)
+
+	case ty.IsTupleType():
+		elems := val.AsValueSlice()
+		for i := range elems {
+			if child, ok := d.Children[strconv.Itoa(i)]; ok {
+				elems[i] = child.Apply(elems[i])
+			}
+		}
+		return cty.TupleVal(elems)
+
+	case ty.IsListType(), ty.IsSetType():
+		child, ok := d.Children[""]
+		if !ok || val.LengthInt() == 0 {
+			return val
+		}
+		elems := val.AsValueSlice()
+		for i := range elems {
+			elems[i] = child.Apply(elems[i])
+		}
+		if !sameTypes(elems) {
+			return val
+		}
+		if ty.IsListType() {
+			return cty.ListVal(elems)
+		}
+		return cty.SetVal(elems)
+
+	case ty.IsMapType():
+		child, ok := d.Children[""]
+		if !ok || val.LengthInt() == 0 {
+			return val
+		}
+		elems := val.AsValueMap()
+		values := make([]cty.Value, 0, len(elems))
+		for k := range elems {
+			elems[k] = child.Apply(elems[k])
+			values = append(values, elems[k])
+		}
+		if !sameTypes(values) {
+			return val
+		}
+		return cty.MapVal(elems)
+	}
+
+	return val
+}
+
+// sameTypes checks that collection elements still have a single type after
+// applying defaults, which may not be the case for "any" attributes.
+func sameTypes(vals []cty.Value) bool {
+	for _, v := range vals {
+		if !v.Type().Equals(vals[0].Type()) {
+			return false
+		}
+	}
+	return true
+}
@@ -9,45 +9,47 @@ import (
 
 const invalidTypeSummary = "Invalid type specification"
 
-// getType is the internal implementation of both Type and TypeConstraint,
-// using the passed flag to distinguish. When constraint is false, the "any"
-// keyword will produce an error.
-func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
+// getType is the internal implementation of Type, TypeConstraint, and
+// TypeConstraintWithDefaults, using the passed flags to distinguish. When
+// constraint is false, the "any" keyword will produce an error. When
+// withDefaults is false, the optional(...) modifier does not accept a default
+// value.
+func getType(expr hcl.Expression, constraint, withDefaults bool) (cty.Type, *Defaults, hcl.Diagnostics) {
 	// First we'll try for one of our keywords
 	kw := hcl.ExprAsKeyword(expr)
 	switch kw {
 	case "bool":
-		return cty.Bool, nil
+		return cty.Bool, nil, nil
 	case "string":
-		return cty.String, nil
+		return cty.String, nil, nil
 	case "number":
-		return cty.Number, nil
+		return cty.Number, nil, nil
 	case "any":
 		if constraint {
-			return cty.DynamicPseudoType, nil
+			return cty.DynamicPseudoType, nil, nil
 		}
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   fmt.Sprintf("The keyword %q cannot be used in this type specification: an exact type is required.", kw),
 			Subject:  expr.Range().Ptr(),
 		}}
 	case "list", "map", "set":
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   fmt.Sprintf("The %s type constructor requires one argument specifying the element type.", kw),
 			Subject:  expr.Range().Ptr(),
 		}}
 	case "object":
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   "The object type constructor requires one argument specifying the attribute types and values as a map.",
 			Subject:  expr.Range().Ptr(),
 		}}
 	case "tuple":
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   "The tuple type constructor requires one argument specifying the element types as a list.",
@@ -56,7 +58,7 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 	case "":
 		// okay! we'll fall through and try processing as a call, then.
 	default:
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   fmt.Sprintf("The keyword %q is not a valid type specification.", kw),
@@ -68,7 +70,7 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 	// try to process it as a call instead.
 	call, diags := hcl.ExprCall(expr)
 	if diags.HasErrors() {
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   "A type specification is either a primitive type keyword (bool, number, string) or a complex type constructor call, like list(string).",
@@ -78,7 +80,7 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 
 	switch call.Name {
 	case "bool", "string", "number", "any":
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   fmt.Sprintf("Primitive type keyword %q does not expect arguments.", call.Name),
@@ -98,7 +100,7 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 
 		switch call.Name {
 		case "list", "set", "map":
-			return cty.DynamicPseudoType, hcl.Diagnostics{{
+			return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 				Severity: hcl.DiagError,
 				Summary:  invalidTypeSummary,
 				Detail:   fmt.Sprintf("The %s type constructor requires one argument specifying the element type.", call.Name),
@@ -106,7 +108,7 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 				Context:  &contextRange,
 			}}
 		case "object":
-			return cty.DynamicPseudoType, hcl.Diagnostics{{
+			return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 				Severity: hcl.DiagError,
 				Summary:  invalidTypeSummary,
 				Detail:   "The object type constructor requires one argument specifying the attribute types and values as a map.",
@@ -114,7 +116,7 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 				Context:  &contextRange,
 			}}
 		case "tuple":
-			return cty.DynamicPseudoType, hcl.Diagnostics{{
+			return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 				Severity: hcl.DiagError,
 				Summary:  invalidTypeSummary,
 				Detail:   "The tuple type constructor requires one argument specifying the element types as a list.",
@@ -127,18 +129,21 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 	switch call.Name {
 
 	case "list":
-		ety, diags := getType(call.Arguments[0], constraint)
-		return cty.List(ety), diags
+		ety, edefaults, diags := getType(call.Arguments[0], constraint, withDefaults)
+		ty := cty.List(ety)
+		return ty, collectionDefaults(ty, edefaults), diags
 	case "set":
-		ety, diags := getType(call.Arguments[0], constraint)
-		return cty.Set(ety), diags
+		ety, edefaults, diags := getType(call.Arguments[0], constraint, withDefaults)
+		ty := cty.Set(ety)
+		return ty, collectionDefaults(ty, edefaults), diags
 	case "map":
-		ety, diags := getType(call.Arguments[0], constraint)
-		return cty.Map(ety), diags
+		ety, edefaults, diags := getType(call.Arguments[0], constraint, withDefaults)
+		ty := cty.Map(ety)
+		return ty, collectionDefaults(ty, edefaults), diags
 	case "object":
 		attrDefs, diags := hcl.ExprMap(call.Arguments[0])
 		if diags.HasErrors() {
-			return cty.DynamicPseudoType, hcl.Diagnostics{{
+			return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 				Severity: hcl.DiagError,
 				Summary:  invalidTypeSummary,
 				Detail:   "Object type constructor requires a map whose keys are attribute names and whose values are the corresponding attribute types.",
@@ -148,6 +153,8 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 		}
 
 		atys := make(map[string]cty.Type)
+		defaultValues := make(map[string]cty.Value)
+		children := make(map[string]*Defaults)
 		var optAttrs []string
 		for _, attrDef := range attrDefs {
 			attrName := hcl.ExprAsKeyword(attrDef.Key)
@@ -180,7 +187,25 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 						continue
 					}
 					if constraint {
-						if len(call.Arguments) > 1 {
+						if withDefaults {
+							switch len(call.Arguments) {
+							case 2:
+								defaultVal, defaultDiags := call.Arguments[1].Value(nil)
+								diags = append(diags, defaultDiags...)
+								if !defaultDiags.HasErrors() {
+									defaultValues[attrName] = defaultVal
+								}
+							case 1:
+							default:
+								diags = append(diags, &hcl.Diagnostic{
+									Severity: hcl.DiagError,
+									Summary:  invalidTypeSummary,
+									Detail:   "Optional attribute modifier expects at most two arguments: the attribute type, and a default value.",
+									Subject:  call.ArgsRange.Ptr(),
+									Context:  atyExpr.Range().Ptr(),
+								})
+							}
+						} else if len(call.Arguments) > 1 {
 							diags = append(diags, &hcl.Diagnostic{
 								Severity: hcl.DiagError,
 								Summary:  invalidTypeSummary,
@@ -203,19 +228,31 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 				}
 			}
 
-			aty, attrDiags := getType(atyExpr, constraint)
+			aty, attrDefaults, attrDiags := getType(atyExpr, constraint, withDefaults)
 			diags = append(diags, attrDiags...)
 			atys[attrName] = aty
+			if attrDefaults != nil {
+				children[attrName] = attrDefaults
+			}
 		}
 		// NOTE: ObjectWithOptionalAttrs is experimental in cty at the
 		// time of writing, so this interface might change even in future
 		// minor versions of cty. We're accepting that because Terraform
 		// itself is considering optional attributes as experimental right now.
-		return cty.ObjectWithOptionalAttrs(atys, optAttrs), diags
+		ty := cty.ObjectWithOptionalAttrs(atys, optAttrs)
+		var defaults *Defaults
+		if len(defaultValues) > 0 || len(children) > 0 {
+			defaults = &Defaults{
+				Type:          ty,
+				DefaultValues: defaultValues,
+				Children:      children,
+			}
+		}
+		return ty, defaults, diags
 	case "tuple":
 		elemDefs, diags := hcl.ExprList(call.Arguments[0])
 		if diags.HasErrors() {
-			return cty.DynamicPseudoType, hcl.Diagnostics{{
+			return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 				Severity: hcl.DiagError,
 				Summary:  invalidTypeSummary,
 				Detail:   "Tuple type constructor requires a list of element types.",
@@ -224,14 +261,23 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 			}}
 		}
 		etys := make([]cty.Type, len(elemDefs))
+		children := make(map[string]*Defaults)
 		for i, defExpr := range elemDefs {
-			ety, elemDiags := getType(defExpr, constraint)
+			ety, elemDefaults, elemDiags := getType(defExpr, constraint, withDefaults)
 			diags = append(diags, elemDiags...)
 			etys[i] = ety
+			if elemDefaults != nil {
+				children[fmt.Sprintf("%d", i)] = elemDefaults
+			}
+		}
+		ty := cty.Tuple(etys)
+		var defaults *Defaults
+		if len(children) > 0 {
+			defaults = &Defaults{Type: ty, Children: children}
 		}
-		return cty.Tuple(etys), diags
+		return ty, defaults, diags
 	case "optional":
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   fmt.Sprintf("Keyword %q is valid only as a modifier for object type attributes.", call.Name),
@@ -240,7 +286,7 @@ func getType(expr hcl.Expression, constraint bool) (cty.Type, hcl.Diagnostics) {
 	default:
 		// Can't access call.Arguments in this path because we've not validated
 		// that it contains exactly one expression here.
-		return cty.DynamicPseudoType, hcl.Diagnostics{{
+		return cty.DynamicPseudoType, nil, hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  invalidTypeSummary,
 			Detail:   fmt.Sprintf("Keyword %q is not a valid type constructor.", call.Name),
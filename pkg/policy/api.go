@@ -106,6 +106,7 @@ const resourcesByTypeName = "__resources_by_type"
 const currentInputTypeName = "__current_input_type"
 const inputResourceTypesName = "__input_resource_types"
 const queryName = "__query"
+const relationsName = "__relations"
 
 var builtinDeclarations = map[string]*types.Function{
 	resourcesByTypeName: types.NewFunction(
@@ -151,6 +152,24 @@ var builtinDeclarations = map[string]*types.Function{
 			types.NewDynamicProperty(types.S, types.A),
 		)),
 	),
+	relationsName: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				[]*types.StaticProperty{
+					types.NewStaticProperty("id", types.S),
+					types.NewStaticProperty("_type", types.S),
+				},
+				types.NewDynamicProperty(types.S, types.A),
+			),
+		),
+		types.NewObject(
+			[]*types.StaticProperty{
+				types.NewStaticProperty("references", types.NewArray(nil, types.A)),
+				types.NewStaticProperty("referenced_by", types.NewArray(nil, types.A)),
+			},
+			nil,
+		),
+	),
 }
 
 // Capabilities returns a Capabilities that includes the the policy engine builtins.
@@ -306,6 +325,7 @@ func NewBuiltins(input *models.State, resourcesResolver ResourcesResolver) *Buil
 			&Query{ResourcesResolver: resolver},
 			&currentInputType{input},
 			&inputResourceTypes{input},
+			&relations{input: input, calledWith: inputResolver.calledWith},
 			resourcesByType,
 		},
 	}
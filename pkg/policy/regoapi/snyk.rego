@@ -25,3 +25,7 @@ input_resource_types := __input_resource_types()
 query(scope) = ret {
 	ret := __query(scope)
 }
+
+relations(resource) = ret {
+	ret := __relations(resource)
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/snyk/policy-engine/pkg/models"
+)
+
+// relations implements the __relations builtin, which looks up the edges
+// recorded by the input loaders in the "relations" state meta.  It returns
+// the resources that the given resource references, and the resources that
+// reference it, along with the attribute holding the reference.
+type relations struct {
+	calledWith map[string]bool
+	input      *models.State
+}
+
+func (r *relations) decl() *rego.Function {
+	return &rego.Function{
+		Name:    relationsName,
+		Decl:    builtinDeclarations[relationsName],
+		Memoize: true,
+	}
+}
+
+func (r *relations) impl(
+	bctx rego.BuiltinContext,
+	operands []*ast.Term,
+) (*ast.Term, error) {
+	if len(operands) != 2 {
+		return nil, fmt.Errorf("Expected one argument")
+	}
+	obj, err := builtins.ObjectOperand(operands[0].Value, 0)
+	if err != nil {
+		return nil, err
+	}
+	id, err := stringField(obj, "id")
+	if err != nil {
+		return nil, err
+	}
+	resourceType, err := stringField(obj, "_type")
+	if err != nil {
+		return nil, err
+	}
+
+	references := []interface{}{}
+	referencedBy := []interface{}{}
+	for _, edge := range stateRelations(r.input) {
+		if edge.from.id == id && edge.from.resourceType == resourceType {
+			if target, ok := r.lookup(edge.to); ok {
+				references = append(references, map[string]interface{}{
+					"resource":  resourceStateToRegoInput(target),
+					"attribute": edge.attribute,
+				})
+			}
+		}
+		if edge.to.id == id && edge.to.resourceType == resourceType {
+			if source, ok := r.lookup(edge.from); ok {
+				referencedBy = append(referencedBy, map[string]interface{}{
+					"resource":  resourceStateToRegoInput(source),
+					"attribute": edge.attribute,
+				})
+			}
+		}
+	}
+
+	val, err := ast.InterfaceToValue(map[string]interface{}{
+		"references":    references,
+		"referenced_by": referencedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewTerm(val), nil
+}
+
+func (r *relations) lookup(ref relationEndpoint) (models.ResourceState, bool) {
+	// Related resources are part of what the policy looked at.
+	r.calledWith[ref.resourceType] = true
+	if resources, ok := r.input.Resources[ref.resourceType]; ok {
+		resource, ok := resources[ref.id]
+		return resource, ok
+	}
+	return models.ResourceState{}, false
+}
+
+type relationEndpoint struct {
+	id           string
+	resourceType string
+}
+
+type relationEdge struct {
+	from      relationEndpoint
+	to        relationEndpoint
+	attribute []interface{}
+}
+
+// stateRelations parses the "relations" meta of a state.  Malformed entries
+// are skipped.
+func stateRelations(state *models.State) []relationEdge {
+	edges := []relationEdge{}
+	if state == nil || state.Meta == nil {
+		return edges
+	}
+	list, ok := state.Meta["relations"].([]interface{})
+	if !ok {
+		return edges
+	}
+	for _, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		from, ok := parseRelationEndpoint(obj["from"])
+		if !ok {
+			continue
+		}
+		to, ok := parseRelationEndpoint(obj["to"])
+		if !ok {
+			continue
+		}
+		attribute, _ := obj["attribute"].([]interface{})
+		if attribute == nil {
+			attribute = []interface{}{}
+		}
+		edges = append(edges, relationEdge{from, to, attribute})
+	}
+	return edges
+}
+
+func parseRelationEndpoint(value interface{}) (relationEndpoint, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return relationEndpoint{}, false
+	}
+	id, ok := obj["id"].(string)
+	if !ok {
+		return relationEndpoint{}, false
+	}
+	resourceType, ok := obj["resource_type"].(string)
+	if !ok {
+		return relationEndpoint{}, false
+	}
+	return relationEndpoint{id, resourceType}, true
+}
+
+func stringField(obj ast.Object, key string) (string, error) {
+	term := obj.Get(ast.StringTerm(key))
+	if term == nil {
+		return "", fmt.Errorf("Expected %s field in resource", key)
+	}
+	str, ok := term.Value.(ast.String)
+	if !ok {
+		return "", fmt.Errorf("Expected %s field to be a string", key)
+	}
+	return string(str), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/snyk/policy-engine/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelations(t *testing.T) {
+	bucket := models.ResourceState{
+		Id:           "aws_s3_bucket.bucket",
+		ResourceType: "aws_s3_bucket",
+		Attributes:   map[string]interface{}{},
+	}
+	policy := models.ResourceState{
+		Id:           "aws_s3_bucket_policy.policy",
+		ResourceType: "aws_s3_bucket_policy",
+		Attributes: map[string]interface{}{
+			"bucket": "aws_s3_bucket.bucket",
+		},
+	}
+	state := &models.State{
+		Meta: map[string]interface{}{
+			"relations": []interface{}{
+				map[string]interface{}{
+					"from": map[string]interface{}{
+						"id":            "aws_s3_bucket_policy.policy",
+						"resource_type": "aws_s3_bucket_policy",
+					},
+					"to": map[string]interface{}{
+						"id":            "aws_s3_bucket.bucket",
+						"resource_type": "aws_s3_bucket",
+					},
+					"attribute": []interface{}{"bucket"},
+				},
+			},
+		},
+		Resources: map[string]map[string]models.ResourceState{
+			"aws_s3_bucket":        {bucket.Id: bucket},
+			"aws_s3_bucket_policy": {policy.Id: policy},
+		},
+	}
+	builtin := &relations{input: state, calledWith: map[string]bool{}}
+
+	call := func(resource models.ResourceState) interface{} {
+		val, err := ast.InterfaceToValue(resourceStateToRegoInput(resource))
+		assert.NoError(t, err)
+		term, err := builtin.impl(
+			rego.BuiltinContext{},
+			[]*ast.Term{ast.NewTerm(val), ast.NullTerm()},
+		)
+		assert.NoError(t, err)
+		out, err := ast.JSON(term.Value)
+		assert.NoError(t, err)
+		return out
+	}
+
+	assert.Equal(t,
+		map[string]interface{}{
+			"references": []interface{}{
+				map[string]interface{}{
+					"resource": map[string]interface{}{
+						"id":         "aws_s3_bucket.bucket",
+						"_type":      "aws_s3_bucket",
+						"_namespace": "",
+						"_meta":      map[string]interface{}{},
+					},
+					"attribute": []interface{}{"bucket"},
+				},
+			},
+			"referenced_by": []interface{}{},
+		},
+		call(policy),
+	)
+	assert.Equal(t,
+		map[string]interface{}{
+			"references": []interface{}{},
+			"referenced_by": []interface{}{
+				map[string]interface{}{
+					"resource": map[string]interface{}{
+						"id":         "aws_s3_bucket_policy.policy",
+						"_type":      "aws_s3_bucket_policy",
+						"_namespace": "",
+						"_meta":      map[string]interface{}{},
+						"bucket":     "aws_s3_bucket.bucket",
+					},
+					"attribute": []interface{}{"bucket"},
+				},
+			},
+		},
+		call(bucket),
+	)
+	assert.Equal(t, map[string]bool{"aws_s3_bucket": true, "aws_s3_bucket_policy": true}, builtin.calledWith)
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postprocess
+
+import (
+	"github.com/snyk/policy-engine/pkg/interfacetricks"
+	"github.com/snyk/policy-engine/pkg/models"
+)
+
+// RedactedValue replaces sensitive values in redacted states.
+const RedactedValue = "(sensitive value)"
+
+// RedactSensitive redacts sensitive values from the input states embedded in
+// a report.  This should be done after evaluation, so policies still have
+// access to the values.
+func RedactSensitive(results *models.Results) {
+	for i := range results.Results {
+		RedactSensitiveState(&results.Results[i].Input)
+	}
+}
+
+// RedactSensitiveState replaces the values of sensitive attributes in a state
+// by RedactedValue.  These are the attributes listed in the
+// `sensitive_attributes` meta of each resource.  For Terraform plans, this
+// also redacts sensitive values in `meta.tfplan`.  The resource maps are
+// replaced rather than modified, so other references to them are unaffected.
+func RedactSensitiveState(state *models.State) {
+	redacted := make(map[string]map[string]models.ResourceState, len(state.Resources))
+	for resourceType, resources := range state.Resources {
+		redacted[resourceType] = make(map[string]models.ResourceState, len(resources))
+		for id, resource := range resources {
+			if sensitive, ok := resource.Meta["sensitive_attributes"].([]interface{}); ok {
+				attributes := interfacetricks.Copy(resource.Attributes)
+				for _, path := range sensitive {
+					if p, ok := path.([]interface{}); ok {
+						attributes = redactPath(attributes, p)
+					}
+				}
+				resource.Attributes, _ = attributes.(map[string]interface{})
+			}
+			if tfplan, ok := resource.Meta["tfplan"].(map[string]interface{}); ok {
+				resource.Meta = copyMeta(resource.Meta)
+				resource.Meta["tfplan"] = redactTfplanResourceMeta(tfplan)
+			}
+			redacted[resourceType][id] = resource
+		}
+	}
+	state.Resources = redacted
+
+	if tfplan, ok := state.Meta["tfplan"].(map[string]interface{}); ok {
+		state.Meta = copyMeta(state.Meta)
+		state.Meta["tfplan"] = redactTfplanMeta(tfplan)
+	}
+}
+
+func redactTfplanResourceMeta(tfplan map[string]interface{}) map[string]interface{} {
+	tfplan = copyMeta(tfplan)
+	redactChange(tfplan, "before", "before_sensitive")
+	if drift, ok := tfplan["drift"].(map[string]interface{}); ok {
+		drift = copyMeta(drift)
+		redactChange(drift, "before", "before_sensitive")
+		redactChange(drift, "after", "after_sensitive")
+		tfplan["drift"] = drift
+	}
+	return tfplan
+}
+
+// redactChange redacts the paths listed under sensitiveKey in the value
+// under key, as in the `before` and `before_sensitive` of a change.
+func redactChange(obj map[string]interface{}, key string, sensitiveKey string) {
+	sensitive, ok := obj[sensitiveKey].([]interface{})
+	if !ok || obj[key] == nil {
+		return
+	}
+	value := interfacetricks.Copy(obj[key])
+	for _, path := range sensitive {
+		if p, ok := path.([]interface{}); ok {
+			value = redactPath(value, p)
+		}
+	}
+	obj[key] = value
+}
+
+func redactTfplanMeta(tfplan map[string]interface{}) map[string]interface{} {
+	tfplan = copyMeta(tfplan)
+
+	if variables, ok := tfplan["variables"].(map[string]interface{}); ok {
+		if sensitive, ok := tfplan["sensitive_variables"].([]interface{}); ok {
+			variables = copyMeta(variables)
+			for _, name := range sensitive {
+				if n, ok := name.(string); ok {
+					if _, ok := variables[n]; ok {
+						variables[n] = RedactedValue
+					}
+				}
+			}
+			tfplan["variables"] = variables
+		}
+	}
+
+	// Outputs and output changes are redacted as a whole.
+	redactValues := func(key string, fields ...string) {
+		objs, ok := tfplan[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		objs = copyMeta(objs)
+		for name, obj := range objs {
+			o, ok := obj.(map[string]interface{})
+			if !ok || o["sensitive"] != true {
+				continue
+			}
+			o = copyMeta(o)
+			for _, field := range fields {
+				if _, ok := o[field]; ok {
+					o[field] = RedactedValue
+				}
+			}
+			objs[name] = o
+		}
+		tfplan[key] = objs
+	}
+	redactValues("outputs", "value")
+	redactValues("output_changes", "before", "after")
+
+	return tfplan
+}
+
+// redactPath replaces the value at the given path, if it exists.  Values are
+// modified in place.
+func redactPath(value interface{}, path []interface{}) interface{} {
+	if len(path) == 0 {
+		if value == nil {
+			return nil
+		}
+		return RedactedValue
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if key, ok := path[0].(string); ok {
+			if child, ok := v[key]; ok {
+				v[key] = redactPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		if index, ok := pathIndex(path[0]); ok && index >= 0 && index < len(v) {
+			v[index] = redactPath(v[index], path[1:])
+		}
+	}
+	return value
+}
+
+func pathIndex(step interface{}) (int, bool) {
+	switch i := step.(type) {
+	case int:
+		return i, true
+	case int64:
+		return int(i), true
+	case float64:
+		return int(i), true
+	}
+	return 0, false
+}
+
+func copyMeta(meta map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(meta))
+	for k, v := range meta {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 Snyk Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postprocess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snyk/policy-engine/pkg/models"
+)
+
+func TestRedactSensitiveState(t *testing.T) {
+	attributes := map[string]interface{}{
+		"engine":   "postgres",
+		"password": "hunter22",
+		"tags": map[string]interface{}{
+			"Name":  "db",
+			"Token": "secret",
+		},
+		"users": []interface{}{"admin", "root"},
+		"unset": nil,
+	}
+	resources := map[string]models.ResourceState{
+		"aws_db_instance.db": {
+			Id:           "aws_db_instance.db",
+			ResourceType: "aws_db_instance",
+			Attributes:   attributes,
+			Meta: map[string]interface{}{
+				"sensitive_attributes": []interface{}{
+					[]interface{}{"password"},
+					[]interface{}{"tags", "Token"},
+					[]interface{}{"users", int64(1)},
+					[]interface{}{"unset"},
+					[]interface{}{"missing", "path"},
+				},
+				"tfplan": map[string]interface{}{
+					"before": map[string]interface{}{
+						"password": "hunter2",
+					},
+					"before_sensitive": []interface{}{
+						[]interface{}{"password"},
+					},
+					"drift": map[string]interface{}{
+						"actions": []interface{}{"update"},
+						"before": map[string]interface{}{
+							"password": "hunter1",
+							"engine":   "mysql",
+						},
+						"after": map[string]interface{}{
+							"password": "hunter2",
+							"engine":   "postgres",
+						},
+						"before_sensitive": []interface{}{
+							[]interface{}{"password"},
+						},
+						"after_sensitive": []interface{}{
+							[]interface{}{"password"},
+						},
+					},
+				},
+			},
+		},
+	}
+	state := models.State{
+		Meta: map[string]interface{}{
+			"tfplan": map[string]interface{}{
+				"variables": map[string]interface{}{
+					"password": "hunter22",
+					"region":   "us-east-1",
+				},
+				"sensitive_variables": []interface{}{"password"},
+				"outputs": map[string]interface{}{
+					"password": map[string]interface{}{"sensitive": true, "value": "hunter22"},
+					"endpoint": map[string]interface{}{"sensitive": false, "value": "db:5432"},
+				},
+			},
+		},
+		Resources: map[string]map[string]models.ResourceState{
+			"aws_db_instance": resources,
+		},
+	}
+
+	RedactSensitiveState(&state)
+
+	resource := state.Resources["aws_db_instance"]["aws_db_instance.db"]
+	assert.Equal(t, map[string]interface{}{
+		"engine":   "postgres",
+		"password": RedactedValue,
+		"tags": map[string]interface{}{
+			"Name":  "db",
+			"Token": RedactedValue,
+		},
+		"users": []interface{}{"admin", RedactedValue},
+		"unset": nil,
+	}, resource.Attributes)
+	assert.Equal(t, map[string]interface{}{
+		"password": RedactedValue,
+	}, resource.Meta["tfplan"].(map[string]interface{})["before"])
+	drift := resource.Meta["tfplan"].(map[string]interface{})["drift"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"password": RedactedValue,
+		"engine":   "mysql",
+	}, drift["before"])
+	assert.Equal(t, map[string]interface{}{
+		"password": RedactedValue,
+		"engine":   "postgres",
+	}, drift["after"])
+
+	tfplan := state.Meta["tfplan"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"password": RedactedValue,
+		"region":   "us-east-1",
+	}, tfplan["variables"])
+	assert.Equal(t, map[string]interface{}{
+		"password": map[string]interface{}{"sensitive": true, "value": RedactedValue},
+		"endpoint": map[string]interface{}{"sensitive": false, "value": "db:5432"},
+	}, tfplan["outputs"])
+
+	// The original resources and attributes are left untouched.
+	assert.Equal(t, "hunter22", attributes["password"])
+	assert.Equal(t, "secret", attributes["tags"].(map[string]interface{})["Token"])
+	original := resources["aws_db_instance.db"]
+	assert.Equal(t, "hunter22", original.Attributes["password"])
+	originalDrift := original.Meta["tfplan"].(map[string]interface{})["drift"].(map[string]interface{})
+	assert.Equal(t, "hunter1", originalDrift["before"].(map[string]interface{})["password"])
+}
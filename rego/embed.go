@@ -23,3 +23,6 @@ var SnykRego []byte
 
 //go:embed snyk/terraform.rego
 var SnykTerraformRego []byte
+
+//go:embed snyk/sensitive.rego
+var SnykSensitiveRego []byte
@@ -50,3 +50,37 @@ query(q) = ret {
 	query_str := json.marshal(q)
 	ret := input._query[query_str]
 }
+
+# Pure implementation of relations() using the "relations" state meta.
+relations(resource) = ret {
+	edges := object.get(object.get(input, "meta", {}), "relations", [])
+	ret := {
+		"references": [ref |
+			edge := edges[_]
+			edge.from.id == resource.id
+			edge.from.resource_type == resource._type
+			target := _relation_resource(edge.to)
+			ref := {"resource": target, "attribute": edge.attribute}
+		],
+		"referenced_by": [ref |
+			edge := edges[_]
+			edge.to.id == resource.id
+			edge.to.resource_type == resource._type
+			source := _relation_resource(edge.from)
+			ref := {"resource": source, "attribute": edge.attribute}
+		],
+	}
+}
+
+_relation_resource(endpoint) = ret {
+	resource := input.resources[endpoint.resource_type][endpoint.id]
+	ret := object.union(
+		{
+			"id": resource.id,
+			"_type": endpoint.resource_type,
+			"_namespace": resource.namespace,
+			"_meta": object.get(resource, "meta", {}),
+		},
+		resource.attributes,
+	)
+}
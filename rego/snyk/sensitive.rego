@@ -0,0 +1,33 @@
+# Copyright 2022 Snyk Ltd
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+package snyk
+
+# Checks if an attribute holds a sensitive value, such as a value derived from
+# a sensitive Terraform variable or a NoEcho CloudFormation parameter.  The
+# attribute is given as a path, e.g. `["tags", "Name"]`, or as a single
+# attribute name.  Nested attributes of a sensitive attribute are sensitive as
+# well.
+attribute_sensitive(resource, attribute) {
+	meta := object.get(resource, "_meta", {})
+	sensitive := object.get(meta, "sensitive_attributes", [])
+	path := _attribute_path(attribute)
+	prefix := sensitive[_]
+	count(prefix) <= count(path)
+	array.slice(path, 0, count(prefix)) == prefix
+}
+
+_attribute_path(attribute) = [attribute] {
+	is_string(attribute)
+} else = attribute
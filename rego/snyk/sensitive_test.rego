@@ -0,0 +1,26 @@
+# Copyright 2022 Snyk Ltd
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+package snyk
+
+test_attribute_sensitive {
+	resource := {"_meta": {"sensitive_attributes": [["password"], ["tags", "Secret"]]}}
+	attribute_sensitive(resource, "password")
+	attribute_sensitive(resource, ["password"])
+	attribute_sensitive(resource, ["tags", "Secret"])
+	not attribute_sensitive(resource, "tags")
+	not attribute_sensitive(resource, ["tags", "Name"])
+	not attribute_sensitive(resource, "username")
+	not attribute_sensitive({}, "password")
+}
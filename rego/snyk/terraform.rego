@@ -25,6 +25,24 @@ resource_provider_version_constraint(resource, constraints) {
 	semver_constraints_intersect(resource_constraints, constraints)
 }
 
+# Checks if the value of an attribute could not be determined, for example
+# because it depends on a variable that was not set, or on a value that is only
+# known after apply.  The attribute is given as a path, e.g. `["tags", "Name"]`,
+# or as a single attribute name.
+attribute_unknown(resource, attribute) {
+	meta := object.get(resource, "_meta", {})
+	terraform := object.get(meta, "terraform", {})
+	unknown := object.get(terraform, "unknown_attributes", [])
+	path := attribute_path(attribute)
+	prefix := unknown[_]
+	count(prefix) <= count(path)
+	array.slice(path, 0, count(prefix)) == prefix
+}
+
+attribute_path(attribute) = [attribute] {
+	is_string(attribute)
+} else = attribute
+
 semver_constraints_intersect(constraints1, constraints2) {
 	lhs_constraints := parse_semver_constraints(constraints1)
 	rhs_constraints := parse_semver_constraints(constraints2)
@@ -20,6 +20,18 @@ test_resource_provider_version_constraint {
 	not resource_provider_version_constraint({"_meta": {"terraform": {"provider_version_constraint": "~> 3.0"}}}, ">=4")
 }
 
+test_attribute_unknown {
+	resource := {"_meta": {"terraform": {"unknown_attributes": [["bucket"], ["tags", "Name"]]}}}
+	attribute_unknown(resource, "bucket")
+	attribute_unknown(resource, ["bucket"])
+	attribute_unknown(resource, ["tags", "Name"])
+	attribute_unknown(resource, ["bucket", "nested", 0])
+	not attribute_unknown(resource, "tags")
+	not attribute_unknown(resource, ["tags", "Owner"])
+	not attribute_unknown(resource, "acl")
+	not attribute_unknown({}, "bucket")
+}
+
 test_semver_constraints_intersect {
 	do_intersect("=2.4", ">= 2.2, <2.5")
 	dont_intersect("=2.5", ">= 2.2, <2.5")